@@ -35,6 +35,8 @@ func main() {
 	// production workloads.
 	numCPU := runtime.NumCPU()
 	runtime.GOMAXPROCS(numCPU)
+	// Persist the buffered log entries leading up to a panic.
+	defer log.FlushOnPanic()
 	rand.Seed(util.NewPseudoSeed())
 	if log.V(1) {
 		log.Infof("running using %d processor cores", numCPU)
@@ -39,8 +39,14 @@ type LogEntry struct {
 	Method  *int32 `protobuf:"varint,11,opt,name=method" json:"method,omitempty"`
 	Key     Key    `protobuf:"bytes,12,opt,name=key,customtype=Key" json:"key"`
 	// Stack traces if requested.
-	Stacks           []byte `protobuf:"bytes,13,opt,name=stacks" json:"stacks"`
-	XXX_unrecognized []byte `json:"-"`
+	Stacks []byte `protobuf:"bytes,13,opt,name=stacks" json:"stacks"`
+	// Trace or correlation ID of the operation which logged the entry.
+	TraceID *string `protobuf:"bytes,14,opt,name=trace_id" json:"trace_id,omitempty"`
+	// Depth of the goroutine's stack at the logging call, if recorded.
+	StackDepth *int32 `protobuf:"varint,15,opt,name=stack_depth" json:"stack_depth,omitempty"`
+	// Structured key/value fields attached to the entry.
+	Fields           []LogEntry_Field `protobuf:"bytes,16,rep,name=fields" json:"fields,omitempty"`
+	XXX_unrecognized []byte           `json:"-"`
 }
 
 func (m *LogEntry) Reset()         { *m = LogEntry{} }
@@ -131,6 +137,27 @@ func (m *LogEntry) GetStacks() []byte {
 	return nil
 }
 
+func (m *LogEntry) GetTraceID() string {
+	if m != nil && m.TraceID != nil {
+		return *m.TraceID
+	}
+	return ""
+}
+
+func (m *LogEntry) GetStackDepth() int32 {
+	if m != nil && m.StackDepth != nil {
+		return *m.StackDepth
+	}
+	return 0
+}
+
+func (m *LogEntry) GetFields() []LogEntry_Field {
+	if m != nil {
+		return m.Fields
+	}
+	return nil
+}
+
 // Log format arguments.
 type LogEntry_Arg struct {
 	Type string `protobuf:"bytes,1,opt,name=type" json:"type"`
@@ -165,6 +192,31 @@ func (m *LogEntry_Arg) GetJson() []byte {
 	return nil
 }
 
+// Structured key/value fields attached to the entry.
+type LogEntry_Field struct {
+	Key              string `protobuf:"bytes,1,opt,name=key" json:"key"`
+	Value            string `protobuf:"bytes,2,opt,name=value" json:"value"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *LogEntry_Field) Reset()         { *m = LogEntry_Field{} }
+func (m *LogEntry_Field) String() string { return proto1.CompactTextString(m) }
+func (*LogEntry_Field) ProtoMessage()    {}
+
+func (m *LogEntry_Field) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *LogEntry_Field) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
 func init() {
 }
 func (m *LogEntry) Unmarshal(data []byte) error {
@@ -429,6 +481,71 @@ func (m *LogEntry) Unmarshal(data []byte) error {
 			}
 			m.Stacks = append([]byte{}, data[index:postIndex]...)
 			index = postIndex
+		case 14:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TraceID", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(data[index:postIndex])
+			m.TraceID = &s
+			index = postIndex
+		case 15:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StackDepth", wireType)
+			}
+			var v int32
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				v |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.StackDepth = &v
+		case 16:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Fields", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Fields = append(m.Fields, LogEntry_Field{})
+			if err := m.Fields[len(m.Fields)-1].Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
 		default:
 			var sizeOfWire int
 			for {
@@ -562,6 +679,93 @@ func (m *LogEntry_Arg) Unmarshal(data []byte) error {
 
 	return nil
 }
+func (m *LogEntry_Field) Unmarshal(data []byte) error {
+	l := len(data)
+	index := 0
+	for index < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if index >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[index]
+			index++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Key", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Key = string(data[index:postIndex])
+			index = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Value", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Value = string(data[index:postIndex])
+			index = postIndex
+		default:
+			var sizeOfWire int
+			for {
+				sizeOfWire++
+				wire >>= 7
+				if wire == 0 {
+					break
+				}
+			}
+			index -= sizeOfWire
+			skippy, err := github_com_gogo_protobuf_proto.Skip(data[index:])
+			if err != nil {
+				return err
+			}
+			if (index + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, data[index:index+skippy]...)
+			index += skippy
+		}
+	}
+
+	return nil
+}
 func (m *LogEntry) Size() (n int) {
 	var l int
 	_ = l
@@ -597,6 +801,19 @@ func (m *LogEntry) Size() (n int) {
 		l = len(m.Stacks)
 		n += 1 + l + sovLog(uint64(l))
 	}
+	if m.TraceID != nil {
+		l = len(*m.TraceID)
+		n += 1 + l + sovLog(uint64(l))
+	}
+	if m.StackDepth != nil {
+		n += 1 + sovLog(uint64(*m.StackDepth))
+	}
+	if len(m.Fields) > 0 {
+		for _, e := range m.Fields {
+			l = e.Size()
+			n += 2 + l + sovLog(uint64(l))
+		}
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -620,6 +837,19 @@ func (m *LogEntry_Arg) Size() (n int) {
 	return n
 }
 
+func (m *LogEntry_Field) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Key)
+	n += 1 + l + sovLog(uint64(l))
+	l = len(m.Value)
+	n += 1 + l + sovLog(uint64(l))
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
 func sovLog(x uint64) (n int) {
 	for {
 		n++
@@ -714,6 +944,31 @@ func (m *LogEntry) MarshalTo(data []byte) (n int, err error) {
 		i = encodeVarintLog(data, i, uint64(len(m.Stacks)))
 		i += copy(data[i:], m.Stacks)
 	}
+	if m.TraceID != nil {
+		data[i] = 0x72
+		i++
+		i = encodeVarintLog(data, i, uint64(len(*m.TraceID)))
+		i += copy(data[i:], *m.TraceID)
+	}
+	if m.StackDepth != nil {
+		data[i] = 0x78
+		i++
+		i = encodeVarintLog(data, i, uint64(*m.StackDepth))
+	}
+	if len(m.Fields) > 0 {
+		for _, msg := range m.Fields {
+			data[i] = 0x82
+			i++
+			data[i] = 0x1
+			i++
+			i = encodeVarintLog(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
@@ -755,6 +1010,35 @@ func (m *LogEntry_Arg) MarshalTo(data []byte) (n int, err error) {
 	return i, nil
 }
 
+func (m *LogEntry_Field) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *LogEntry_Field) MarshalTo(data []byte) (n int, err error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	data[i] = 0xa
+	i++
+	i = encodeVarintLog(data, i, uint64(len(m.Key)))
+	i += copy(data[i:], m.Key)
+	data[i] = 0x12
+	i++
+	i = encodeVarintLog(data, i, uint64(len(m.Value)))
+	i += copy(data[i:], m.Value)
+	if m.XXX_unrecognized != nil {
+		i += copy(data[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
 func encodeFixed64Log(data []byte, offset int, v uint64) int {
 	data[offset] = uint8(v)
 	data[offset+1] = uint8(v >> 8)
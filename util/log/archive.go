@@ -0,0 +1,160 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/util"
+)
+
+// GetLogReaderFromArchive returns a reader for the log file of the given
+// name inside a zip or tar archive, such as a support bundle, without
+// unpacking the archive. The kind of the archive is told by the suffix of
+// archivePath: .zip, .tar, or .tar.gz or .tgz for a gzip-compressed tar
+// archive. entryName is the path of the file within the archive or, if
+// it has no slashes, the base name of the first file so named. The base
+// name must be that of a log file, as for GetLogReader, and the file is
+// decompressed as its name says.
+func GetLogReaderFromArchive(archivePath, entryName string) (io.ReadCloser, error) {
+	if name, _ := splitCompressionSuffix(path.Base(entryName)); !logFileRE.MatchString(name) {
+		return nil, readerErrorf(ErrNotLogFile, "filename is not a cockroach log file: %s", entryName)
+	}
+	var rc io.ReadCloser
+	var err error
+	switch {
+	case strings.HasSuffix(archivePath, ".zip"):
+		rc, err = openZipEntry(archivePath, entryName)
+	case strings.HasSuffix(archivePath, ".tar"):
+		rc, err = openTarEntry(archivePath, entryName, false)
+	case strings.HasSuffix(archivePath, ".tar.gz"), strings.HasSuffix(archivePath, ".tgz"):
+		rc, err = openTarEntry(archivePath, entryName, true)
+	default:
+		return nil, util.Errorf("not a zip or tar archive: %s", archivePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decompress(entryName, rc)
+}
+
+// archiveEntryMatches returns whether the file of the given name in an
+// archive is the one GetLogReaderFromArchive looks for.
+func archiveEntryMatches(name, entryName string) bool {
+	name = strings.TrimPrefix(name, "./")
+	if strings.Contains(entryName, "/") {
+		return name == strings.TrimPrefix(entryName, "./")
+	}
+	return path.Base(name) == entryName
+}
+
+// archiveEntryNotFound returns the error for a file missing from an
+// archive.
+func archiveEntryNotFound(archivePath, entryName string) error {
+	return readerErrorf(os.ErrNotExist, "log file %s not found in archive %s", entryName, archivePath)
+}
+
+// zipEntry reads a file in a zip archive, closing the archive when
+// closed.
+type zipEntry struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (e zipEntry) Close() error {
+	e.ReadCloser.Close()
+	return e.archive.Close()
+}
+
+// openZipEntry opens the file of the given name in the zip archive.
+func openZipEntry(archivePath, entryName string) (io.ReadCloser, error) {
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || !archiveEntryMatches(file.Name, entryName) {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			archive.Close()
+			return nil, err
+		}
+		return zipEntry{rc, archive}, nil
+	}
+	archive.Close()
+	return nil, archiveEntryNotFound(archivePath, entryName)
+}
+
+// tarEntry reads a file in a tar archive, closing the archive when
+// closed.
+type tarEntry struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (e tarEntry) Close() error {
+	var err error
+	for i := len(e.closers) - 1; i >= 0; i-- {
+		if cErr := e.closers[i].Close(); err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
+
+// openTarEntry opens the file of the given name in the tar archive,
+// which is read up to the file.
+func openTarEntry(archivePath, entryName string, gzipped bool) (io.ReadCloser, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	entry := tarEntry{Reader: f, closers: []io.Closer{f}}
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		entry.Reader = gz
+		entry.closers = append(entry.closers, gz)
+	}
+	tr := tar.NewReader(entry.Reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			entry.Close()
+			return nil, archiveEntryNotFound(archivePath, entryName)
+		} else if err != nil {
+			entry.Close()
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
+			if archiveEntryMatches(header.Name, entryName) {
+				entry.Reader = tr
+				return entry, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func TestGetLogReaderFromArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var data bytes.Buffer
+	for _, msg := range []string{"bundled one", "bundled two"} {
+		if err := ProtoEncoding.EncodeEntry(&data, &proto.LogEntry{Time: 1, Format: msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const name = "cockroach.host.user.log.INFO.20150609-161048.1"
+	files := map[string][]byte{
+		"README":                            []byte("not a log file"),
+		"node1/logs/" + name + ".1":         []byte("another log file"),
+		"node1/logs/" + name:                data.Bytes(),
+		"node2/logs/" + name + "-unused":    nil,
+		"node2/logs/cockroach.host.WARNING": nil,
+	}
+
+	var zipData bytes.Buffer
+	zw := zip.NewWriter(&zipData)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var tarData bytes.Buffer
+	tw := tar.NewWriter(&tarData)
+	for name, contents := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var tgzData bytes.Buffer
+	gz := gzip.NewWriter(&tgzData)
+	if _, err := gz.Write(tarData.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for archive, contents := range map[string][]byte{
+		"bundle.zip":    zipData.Bytes(),
+		"bundle.tar":    tarData.Bytes(),
+		"bundle.tar.gz": tgzData.Bytes(),
+	} {
+		archivePath := filepath.Join(dir, archive)
+		if err := ioutil.WriteFile(archivePath, contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, entryName := range []string{name, "node1/logs/" + name} {
+			reader, err := GetLogReaderFromArchive(archivePath, entryName)
+			if err != nil {
+				t.Fatalf("%s: %s: %s", archive, entryName, err)
+			}
+			var msgs []string
+			decoder := NewEntryDecoder(reader)
+			for {
+				var entry proto.LogEntry
+				if err := decoder.Decode(&entry); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("%s: %s: %s", archive, entryName, err)
+				}
+				msgs = append(msgs, entry.Format)
+			}
+			if err := reader.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if exp := []string{"bundled one", "bundled two"}; !reflect.DeepEqual(msgs, exp) {
+				t.Errorf("%s: %s: expected %q; got %q", archive, entryName, exp, msgs)
+			}
+		}
+
+		for _, test := range []struct {
+			entryName string
+			cause     error
+		}{
+			{"README", ErrNotLogFile},
+			{"node1/logs/../../README", ErrNotLogFile},
+			{"cockroach.host.user.log.INFO.20150609-161048.2", os.ErrNotExist},
+			{"node2/logs/" + name, os.ErrNotExist},
+		} {
+			if _, err := GetLogReaderFromArchive(archivePath, test.entryName); !errors.Is(err, test.cause) {
+				t.Errorf("%s: %s: expected an error caused by %q; got %v", archive, test.entryName, test.cause, err)
+			}
+		}
+	}
+}
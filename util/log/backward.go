@@ -0,0 +1,216 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
+	"github.com/cockroachdb/cockroach/util/encoding"
+	gogoproto "github.com/gogo/protobuf/proto"
+)
+
+// Reading a log file backward relies on the following properties of its
+// format:
+//   - Entries are framed by a four-byte big-endian length prefix only,
+//     without separators or trailers, so each frame ends exactly where the
+//     next one starts, and the last one ends at the end of the file.
+//   - The payload of a frame is a non-empty encoded proto.LogEntry with a
+//     time, which a random byte sequence rarely is.
+//   - Entries are appended in increasing time order (see
+//     EntryDecoder.DecodeInRange).
+//   - Only the preamble of the file, which can be located from its start,
+//     precedes the first frame.
+//
+// The frame ending at a known frame boundary is thus found by searching
+// backward from the boundary for a position holding a length prefix which
+// spans exactly to the boundary and is followed by an entry which decodes
+// and is no newer than the entry after it. As payloads may contain such
+// frames themselves, a position is only accepted if a frame, found the
+// same way, ends there, or the preamble does. A file whose end isn't a frame
+// boundary, because its last entry is being written or was cut short, is
+// read forward instead, as are frames beyond maxBackwardScan bytes.
+const (
+	backwardChunkSize = 64 * 1024
+	maxBackwardScan   = 4 * 1024 * 1024
+)
+
+// backwardTimeSlack is how much newer than the entry after it an entry may
+// be, as the entries of goroutines writing concurrently can be out of
+// order by the time it takes to write one.
+const backwardTimeSlack = int64(time.Second)
+
+// ReadLastEntries returns the last n entries of the log file, newest
+// first, reading the file backward from its end in chunks, so that only
+// about the last n entries are read. See Logger.ReadLastEntries.
+func ReadLastEntries(file FileInfo, n int) ([]proto.LogEntry, error) {
+	return defaultLogger.ReadLastEntries(file, n)
+}
+
+// ReadLastEntries returns the last n entries of the Logger's log file,
+// newest first, as described by the package-level ReadLastEntries. Files
+// which can't be read backward are read forward, keeping only the last n
+// entries.
+func (lg *Logger) ReadLastEntries(file FileInfo, n int) ([]proto.LogEntry, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	reader, err := lg.GetLogReader(file.Name, false /* !allowAbsolute */)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var entries []proto.LogEntry
+	if f, ok := reader.(*os.File); ok {
+		entries, err = readLastEntries(f, n)
+	} else {
+		// Compressed files, and files on other fileSystems, can't be
+		// seeked in.
+		err = errNotBackwardReadable
+	}
+	if err == errNotBackwardReadable {
+		entries, err = lg.TailN(file.Name, n)
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	return entries, err
+}
+
+// errNotBackwardReadable is returned by readLastEntries for files it can't
+// read backward.
+var errNotBackwardReadable = util.Errorf("log file can't be read backward")
+
+// readLastEntries reads the last n entries of the file backward, newest
+// first.
+func readLastEntries(f *os.File, n int) ([]proto.LogEntry, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	start, err := preambleSize(f)
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		// The file starts with gzip-compressed data.
+		return nil, errNotBackwardReadable
+	}
+
+	var entries []proto.LogEntry
+	for end := info.Size(); len(entries) < n && end > start; {
+		var next *proto.LogEntry
+		if len(entries) > 0 {
+			next = &entries[len(entries)-1]
+		}
+		entry, frameStart, err := findFrameEndingAt(f, start, end, next, true /* verify */)
+		if err == errNotBackwardReadable && endsWithChecksumFooter(f, start, end) {
+			end -= checksumFooterSize
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		end = frameStart
+	}
+	return entries, nil
+}
+
+// preambleSize returns the size of the preamble of the file, or -1 if the
+// file is gzip-compressed.
+func preambleSize(f *os.File) (int64, error) {
+	var szBuf [4]byte
+	if _, err := f.ReadAt(szBuf[:], 0); err == io.EOF {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if szBuf[0] == gzipMagic[0] && szBuf[1] == gzipMagic[1] {
+		return -1, nil
+	}
+	size, _, err := readPreamble(szBuf[:], io.NewSectionReader(f, int64(len(szBuf)), maxHeaderLineLen))
+	return size, err
+}
+
+// endsWithChecksumFooter returns whether the data of the file between
+// start and end ends with a checksum footer.
+func endsWithChecksumFooter(f *os.File, start, end int64) bool {
+	if end-start < checksumFooterSize {
+		return false
+	}
+	var szBuf [4]byte
+	if _, err := f.ReadAt(szBuf[:], end-checksumFooterSize); err != nil {
+		return false
+	}
+	return isChecksumFooter(szBuf[:])
+}
+
+// findFrameEndingAt finds the frame which ends at the frame boundary end,
+// searching backward no further than start, and returns its entry and
+// where the frame starts. next is the entry of the frame after it, if
+// known. If verify is set, the frame is only accepted if it's preceded by
+// a frame or the preamble. errNotBackwardReadable is returned if no frame
+// is found.
+func findFrameEndingAt(f *os.File, start, end int64, next *proto.LogEntry, verify bool) (proto.LogEntry, int64, error) {
+	var entry proto.LogEntry
+	// checked is the lowest position already searched.
+	checked := end - 4 + 1
+	for chunk := int64(backwardChunkSize); ; chunk *= 2 {
+		if chunk > maxBackwardScan {
+			chunk = maxBackwardScan
+		}
+		lo := end - chunk
+		if lo < start {
+			lo = start
+		}
+		buf := make([]byte, end-lo)
+		if _, err := f.ReadAt(buf, lo); err != nil {
+			return entry, 0, err
+		}
+		for pos := checked - 1; pos >= lo; pos-- {
+			i := pos - lo
+			if _, sz := encoding.DecodeUint32(buf[i : i+4]); sz == 0 || int64(sz) != end-pos-4 {
+				continue
+			}
+			entry = proto.LogEntry{}
+			if err := gogoproto.Unmarshal(buf[i+4:], &entry); err != nil || entry.Time == 0 {
+				continue
+			}
+			if next != nil && entry.Time > next.Time+backwardTimeSlack {
+				continue
+			}
+			if verify && pos > start {
+				// A frame nested in the payload of the real one would
+				// pass the checks above, but isn't preceded by a frame.
+				prev := entry
+				if _, _, err := findFrameEndingAt(f, start, pos, &prev, false); err == errNotBackwardReadable {
+					continue
+				} else if err != nil {
+					return entry, 0, err
+				}
+			}
+			return entry, pos, nil
+		}
+		checked = lo
+		if lo == start || chunk == maxBackwardScan {
+			return entry, 0, errNotBackwardReadable
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func TestReadLastEntries(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	var data []byte
+	var exp []string
+	for i := 1; i <= 50; i++ {
+		entry := proto.LogEntry{
+			Severity: int32(infoLog),
+			Time:     int64(i),
+			Format:   fmt.Sprintf("entry %d", i),
+			// Payloads holding other encoded entries mustn't confuse
+			// the framing.
+			Stacks: encodeLogEntry(&proto.LogEntry{Time: int64(i), Format: strings.Repeat("x", i*1000)}),
+		}
+		data = append(data, encodeLogEntry(&entry)...)
+		exp = append([]string{entry.Format}, exp...)
+	}
+	dir := lg.logDirs()[0]
+	write := func(name string, data []byte) FileInfo {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		files, err := lg.ListLogFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			if file.Name == name {
+				return file
+			}
+		}
+		t.Fatalf("%s not listed", name)
+		return FileInfo{}
+	}
+
+	for i, test := range []struct {
+		data []byte
+		n    int
+		exp  []string
+	}{
+		{data, 3, exp[:3]},
+		{data, 100, exp},
+		// With the preamble of the current format.
+		{append(append([]byte(nil), filePrelude...), data...), 10, exp[:10]},
+		// A partially written last entry is skipped by the forward read.
+		{data[:len(data)-3], 2, exp[1:3]},
+		{nil, 2, nil},
+	} {
+		name := fmt.Sprintf("cockroach.host.user.log.INFO.20150609-161048.%d", i)
+		entries, err := lg.ReadLastEntries(write(name, test.data), test.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msgs []string
+		for _, entry := range entries {
+			msgs = append(msgs, entry.Format)
+		}
+		if !reflect.DeepEqual(msgs, test.exp) {
+			t.Errorf("%d: expected %q; got %q", i, test.exp, msgs)
+		}
+	}
+
+	// Compressed files and files on other fileSystems are read forward,
+	// even if AllowedDirs doesn't list the log dir.
+	defer func(dirs []string) { AllowedDirs = dirs }(AllowedDirs)
+	AllowedDirs = []string{filepath.Join(dir, "elsewhere")}
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	compressed := write("cockroach.host.user.log.INFO.20150609-161048.1.gz", gz.Bytes())
+	if entries, err := lg.ReadLastEntries(compressed, 3); err != nil || len(entries) != 3 || entries[0].Format != exp[0] {
+		t.Errorf("%s: expected %q; got %+v, %v", compressed.Name, exp[:3], entries, err)
+	}
+	mlg, mcleanup := newTestLogger(t)
+	defer mcleanup()
+	fs := newMemFileSystem()
+	mlg.fs = fs
+	const name = "cockroach.host.user.log.INFO.20150609-161048.1"
+	if err := writeFile(fs, filepath.Join(mlg.logDirs()[0], name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := mlg.ReadLastEntries(FileInfo{Name: name}, 3); err != nil || len(entries) != 3 || entries[0].Format != exp[0] {
+		t.Errorf("in memory: expected %q; got %+v, %v", exp[:3], entries, err)
+	}
+
+	// Complete files are read backward rather than by the fallback.
+	f, err := os.Open(filepath.Join(dir, "cockroach.host.user.log.INFO.20150609-161048.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if entries, err := readLastEntries(f, len(exp)); err != nil || len(entries) != len(exp) {
+		t.Errorf("expected to read %d entries backward; got %d, %v", len(exp), len(entries), err)
+	}
+}
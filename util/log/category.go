@@ -0,0 +1,173 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
+)
+
+// categoryIndexSuffix is appended to the name of a log file to form the
+// name of its category index.
+const categoryIndexSuffix = ".categories"
+
+// messageCategory returns the category of a log message, which is a
+// leading token in square brackets such as "[raft]", or "" if the
+// message has none.
+func messageCategory(msg string) string {
+	if !strings.HasPrefix(msg, "[") {
+		return ""
+	}
+	if i := strings.IndexByte(msg, ']'); i > 0 {
+		return msg[:i+1]
+	}
+	return ""
+}
+
+// byteRange is a half-open range of offsets in a log file.
+type byteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// A categoryIndex records the byte range in which each category occurs
+// in a log file. Entries before offset Covered are indexed, later ones
+// were written after the index was last saved.
+type categoryIndex struct {
+	Covered    int64                `json:"covered"`
+	Categories map[string]byteRange `json:"categories"`
+
+	offset int64 // the offset at which the next entry is written
+}
+
+// openCategoryIndex returns an index for the log file which has just
+// been opened and had a header of the given size written to it. If the
+// header was appended to an existing file, the saved index of the file
+// is continued; if there is none, the file isn't indexed and nil is
+// returned.
+func openCategoryIndex(f fsFile, headerSize int) *categoryIndex {
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	idx, err := loadCategoryIndex(f.Name())
+	if err != nil {
+		if info.Size() > int64(headerSize) || !os.IsNotExist(err) {
+			return nil
+		}
+		idx = &categoryIndex{Categories: map[string]byteRange{}}
+	}
+	if idx.Covered > info.Size() {
+		return nil
+	}
+	// The header and any entries after the saved index have no category.
+	idx.offset = info.Size()
+	return idx
+}
+
+// add records an encoded entry of the given size and category, written at
+// the current offset.
+func (idx *categoryIndex) add(category string, size int) {
+	end := idx.offset + int64(size)
+	if category != "" {
+		r, ok := idx.Categories[category]
+		if !ok {
+			r.Start = idx.offset
+		}
+		r.End = end
+		idx.Categories[category] = r
+	}
+	idx.offset = end
+}
+
+// save writes the index for the log file to disk.
+func (idx *categoryIndex) save(filename string) error {
+	idx.Covered = idx.offset
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(osFileSystem{}, filename+categoryIndexSuffix, data)
+}
+
+// loadCategoryIndex reads the index of the log file.
+func loadCategoryIndex(filename string) (*categoryIndex, error) {
+	data, err := ioutil.ReadFile(filename + categoryIndexSuffix)
+	if err != nil {
+		return nil, err
+	}
+	idx := &categoryIndex{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, util.Errorf("%s: invalid category index: %s", filename, err)
+	}
+	if idx.Categories == nil {
+		idx.Categories = map[string]byteRange{}
+	}
+	return idx, nil
+}
+
+// narrowToCategory returns a reader over the parts of the log file which
+// may contain entries of the category: the range recorded in its index,
+// if any, and everything written since the index was saved. Files
+// without an index are read entirely.
+func narrowToCategory(f *os.File, category string) (io.Reader, error) {
+	idx, err := loadCategoryIndex(f.Name())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return nil, err
+	}
+	var readers []io.Reader
+	if r, ok := idx.Categories[category]; ok {
+		readers = append(readers, io.NewSectionReader(f, r.Start, r.End-r.Start))
+	}
+	readers = append(readers, io.NewSectionReader(f, idx.Covered, math.MaxInt64-idx.Covered))
+	return io.MultiReader(readers...), nil
+}
+
+// FetchByCategory fetches the log entries of the given level of
+// severity (or worse) whose messages start with prefix and whose times
+// lie between startTimestamp and endTimestamp, inclusive, in unix nanos.
+// The prefix usually is a category such as "[raft]".
+func FetchByCategory(level Level, prefix string, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	return defaultLogger.FetchByCategory(level, prefix, startTimestamp, endTimestamp)
+}
+
+// FetchByCategory fetches the log entries in the Logger's directories as
+// described by the package-level FetchByCategory. If the prefix starts
+// with a category, only the regions of indexed files in which the
+// category occurs are read, and files lacking it are skipped.
+func (lg *Logger) FetchByCategory(level Level, prefix string, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	match := func(entry *proto.LogEntry) bool {
+		return strings.HasPrefix(formatMessage(entry), prefix)
+	}
+	var narrow func(*os.File) (io.Reader, error)
+	if category := messageCategory(prefix); category != "" {
+		narrow = func(f *os.File) (io.Reader, error) {
+			return narrowToCategory(f, category)
+		}
+	}
+	entries, _, err := lg.fetchEntries(level, startTimestamp, endTimestamp, fetchOptions{match: match, narrow: narrow})
+	return entries, err
+}
@@ -0,0 +1,96 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMessageCategory(t *testing.T) {
+	for _, test := range []struct {
+		msg, exp string
+	}{
+		{"[raft] election", "[raft]"},
+		{"[raft]", "[raft]"},
+		{"raft election", ""},
+		{"[raft election", ""},
+		{"", ""},
+	} {
+		if category := messageCategory(test.msg); category != test.exp {
+			t.Errorf("%q: expected %q; got %q", test.msg, test.exp, category)
+		}
+	}
+}
+
+func TestFetchByCategory(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.IndexCategories = true
+
+	lg.Infoc(nil, "[raft] %s", "election")
+	lg.Infoc(nil, "[gossip] connected")
+	lg.Infoc(nil, "uncategorized")
+	lg.Infoc(nil, "[raft] %s", "append")
+	lg.Flush()
+
+	name, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := loadCategoryIndex(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := idx.Categories["[raft]"]; !ok || len(idx.Categories) != 2 {
+		t.Errorf("unexpected index %+v", idx)
+	}
+
+	// Write an entry after the index has been saved; it must be found
+	// even though the index doesn't know about it.
+	lg.Infoc(nil, "[sql] select")
+	lg.mu.Lock()
+	err = lg.file[infoLog].Flush()
+	lg.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		prefix string
+		exp    []string
+	}{
+		{"[raft]", []string{"[raft] append", "[raft] election"}},
+		{"[raft] e", []string{"[raft] election"}},
+		{"[gossip]", []string{"[gossip] connected"}},
+		{"[sql]", []string{"[sql] select"}},
+		{"[kv]", nil},
+		{"unc", []string{"uncategorized"}},
+	} {
+		entries, err := lg.FetchByCategory(InfoLevel, test.prefix, 0, math.MaxInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msgs []string
+		for i := range entries {
+			msgs = append(msgs, formatMessage(&entries[i]))
+		}
+		if !reflect.DeepEqual(msgs, test.exp) {
+			t.Errorf("%q: expected %q; got %q", test.prefix, test.exp, msgs)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bufio"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"github.com/cockroachdb/cockroach/util"
+	"github.com/cockroachdb/cockroach/util/encoding"
+)
+
+// Loggers with ChecksumFiles set end each file they close cleanly, on
+// rotation or Close, with a checksum footer: four magic bytes followed by
+// the CRC-32C of all the bytes of the file before the footer, big-endian.
+// Like the prelude, the footer is told apart from a length prefix by its
+// first byte, and readers skip it. A file appended to after its footer,
+// as happens on a rotation within the same second, gets another footer
+// covering the earlier one too.
+var checksumFooterMagic = []byte{preludeMagic, 'C', 'R', 'C'}
+
+// checksumFooterSize is the size of a checksum footer.
+const checksumFooterSize = 8
+
+// castagnoliTable is the table of the CRC-32C checksums of footers.
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrNoChecksumFooter is returned by VerifyChecksum for files which don't
+// end with a checksum footer, such as files which were still being
+// written to when the process crashed, or files written without
+// ChecksumFiles. Their contents may well be intact.
+var ErrNoChecksumFooter = errors.New("log file has no checksum footer")
+
+// isChecksumFooter returns whether the four bytes read in place of a
+// length prefix start a checksum footer.
+func isChecksumFooter(szBuf []byte) bool {
+	return string(szBuf) == string(checksumFooterMagic)
+}
+
+// checksumFooter returns the checksum footer for the given checksum.
+func checksumFooter(sum uint32) []byte {
+	footer := append([]byte(nil), checksumFooterMagic...)
+	return encoding.EncodeUint32(footer, sum)
+}
+
+// fileChecksum returns a hash initialized with the contents of the file
+// on fs.
+func fileChecksum(fs fileSystem, name string) (hash.Hash32, error) {
+	h := crc32.New(castagnoliTable)
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// VerifyChecksum verifies the checksum footers of one of the log files,
+// returning ErrNoChecksumFooter if the file doesn't end with one. See
+// Logger.VerifyChecksum.
+func VerifyChecksum(file FileInfo) error {
+	return defaultLogger.VerifyChecksum(file)
+}
+
+// VerifyChecksum verifies that each checksum footer of one of the
+// Logger's files matches the data before it, and that the file ends with
+// one. A file without a footer at its end, e.g. one truncated by a crash,
+// yields ErrNoChecksumFooter; a mismatch or a file which can't be parsed
+// up to its footer yields another error.
+func (lg *Logger) VerifyChecksum(file FileInfo) error {
+	rc, err := lg.GetLogReader(file.Name, false /* !allowAbsolute */)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	h := crc32.New(castagnoliTable)
+	r := io.TeeReader(bufio.NewReader(rc), h)
+
+	var footer bool // whether the last frame read was a footer
+	var szBuf [4]byte
+	for {
+		sum := h.Sum32() // the checksum of the data before the frame
+		if _, err := io.ReadFull(r, szBuf[:]); err == io.EOF {
+			break
+		} else if err == io.ErrUnexpectedEOF {
+			return ErrNoChecksumFooter
+		} else if err != nil {
+			return err
+		}
+		if isChecksumFooter(szBuf[:]) {
+			var sumBuf [4]byte
+			if _, err := io.ReadFull(r, sumBuf[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+				return ErrNoChecksumFooter
+			} else if err != nil {
+				return err
+			}
+			if _, expected := encoding.DecodeUint32(sumBuf[:]); expected != sum {
+				return util.Errorf("%s: checksum mismatch: footer has %08x, data has %08x",
+					file.Name, expected, sum)
+			}
+			footer = true
+			continue
+		}
+		footer = false
+		if preamble, _, err := readPreamble(szBuf[:], r); err != nil {
+			return util.Errorf("%s: %s", file.Name, err)
+		} else if preamble > 0 {
+			continue
+		}
+		_, sz := encoding.DecodeUint32(szBuf[:])
+		if n, err := io.CopyN(ioutil.Discard, r, int64(sz)); n < int64(sz) {
+			if err == io.EOF {
+				return ErrNoChecksumFooter
+			}
+			return err
+		}
+	}
+	if !footer {
+		return ErrNoChecksumFooter
+	}
+	return nil
+}
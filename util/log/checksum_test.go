@@ -0,0 +1,167 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeChecksummedFiles logs a few entries with a Logger with
+// ChecksumFiles set and closes it, twice, so that the files are either
+// appended to after their footer or new. It returns the Logger's files.
+func writeChecksummedFiles(t *testing.T, lg *Logger) []FileInfo {
+	lg.ChecksumFiles = true
+	for i := 0; i < 2; i++ {
+		lg.Infoc(nil, "info %d", i)
+		lg.Warningc(nil, "warning %d", i)
+		if err := lg.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("expected at least 2 files; got %+v", files)
+	}
+	return files
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	files := writeChecksummedFiles(t, lg)
+	for _, file := range files {
+		if err := lg.VerifyChecksum(file); err != nil {
+			t.Errorf("%s: %s", file.Name, err)
+		}
+		// The footers are skipped by the readers.
+		if n, err := lg.CountEntries(file, WarningLevel, 0, timeNow().UnixNano()); err != nil {
+			t.Errorf("%s: %s", file.Name, err)
+		} else if n != 2 {
+			t.Errorf("%s: expected 2 warning entries; got %d", file.Name, n)
+		}
+		last, err := lg.ReadLastEntries(file, 1)
+		if err != nil {
+			t.Fatalf("%s: %s", file.Name, err)
+		}
+		if len(last) != 1 || !strings.HasPrefix(last[0].Format, "warning") {
+			t.Errorf("%s: expected the last warning; got %+v", file.Name, last)
+		}
+	}
+	entries, err := lg.FetchEntriesFromFiles(WarningLevel, 0, timeNow().UnixNano())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings int
+	for _, entry := range entries {
+		if Level(entry.Severity) == WarningLevel {
+			warnings++
+		}
+	}
+	if warnings != 2 {
+		t.Errorf("expected 2 warning entries; got %+v", entries)
+	}
+}
+
+// TestVerifyChecksumTruncated verifies that files without a footer, such
+// as files being written to or truncated by a crash, are told apart from
+// corrupt ones.
+func TestVerifyChecksumTruncated(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	file := writeChecksummedFiles(t, lg)[0]
+	name := filepath.Join(lg.logDirs()[0], file.Name)
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{len(data) - checksumFooterSize, len(data) - 2, len(data) - checksumFooterSize - 3} {
+		if err := ioutil.WriteFile(name, data[:size], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := lg.VerifyChecksum(file); err != ErrNoChecksumFooter {
+			t.Errorf("%d of %d bytes: expected ErrNoChecksumFooter; got %v", size, len(data), err)
+		}
+	}
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-checksumFooterSize-1] ^= 0xff
+	if err := ioutil.WriteFile(name, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := lg.VerifyChecksum(file); err == nil || err == ErrNoChecksumFooter ||
+		!strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch; got %v", err)
+	}
+
+	// A file being written to has no footer yet, including one appended to
+	// after its footer.
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	lg.Infoc(nil, "unfinished")
+	lg.Flush()
+	active, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lg.VerifyChecksum(FileInfo{Name: info.Name()}); err != ErrNoChecksumFooter {
+		t.Errorf("expected ErrNoChecksumFooter for the active file; got %v", err)
+	}
+}
+
+// TestChecksumInMemoryFileSystem verifies that checksums are computed and
+// verified on the Logger's fileSystem.
+func TestChecksumInMemoryFileSystem(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.fs = newMemFileSystem()
+	lg.ChecksumFiles = true
+
+	lg.Infoc(nil, "before rotation")
+	lg.mu.Lock()
+	err := lg.file[infoLog].(*syncBuffer).rotateFile(time.Now().Add(time.Hour))
+	lg.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg.Infoc(nil, "after rotation")
+	lg.Flush()
+
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files; got %+v", files)
+	}
+	// The rotated file, the older one, ends with its footer.
+	if err := lg.VerifyChecksum(files[1]); err != nil {
+		t.Errorf("%s: %s", files[1].Name, err)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	stdLog "log"
 	"os"
@@ -37,6 +38,7 @@ import (
 	"time"
 
 	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/encoding"
 	gogoproto "github.com/gogo/protobuf/proto"
 )
@@ -353,7 +355,110 @@ func (t *traceLocation) Set(value string) error {
 // buffer. Each entry is preceded by a single big-ending uint32
 // describing the next entry's length.
 type EntryDecoder struct {
-	in io.Reader
+	in     io.Reader
+	offset int64
+	// version is the format version of the input, as named by its
+	// prelude. Input without a prelude is of version 0.
+	version int
+	// SkipCorrupt makes the decoder skip entries which can't be decoded,
+	// as found at the end of the file of a process which crashed while
+	// writing, so that the entries around them can still be read. In
+	// place of each skipped entry, a marker entry (see IsCorruptionMarker)
+	// is decoded. An incomplete last entry is replaced by a marker too,
+	// after which io.EOF is returned.
+	SkipCorrupt bool
+	// Tailing makes the decoder read input which is still being written,
+	// such as the active log file: if the input ends within an entry,
+	// ErrIncompleteEntry is returned instead of io.ErrUnexpectedEOF, and
+	// the entry is decoded by a later call once the rest of it can be
+	// read. io.EOF is only returned at the end of an entry.
+	Tailing bool
+	// truncated is set once an incomplete last entry was skipped.
+	truncated bool
+	// replay, if Tailing, records the input read for the entry being
+	// decoded, so that it can be read again if the entry is incomplete.
+	replay *replayReader
+}
+
+// ErrIncompleteEntry is returned by an EntryDecoder with Tailing set if
+// its input ends within an entry, which may still be being written.
+var ErrIncompleteEntry = errors.New("incomplete log entry")
+
+// A replayReader reads its input, recording what it reads until commit,
+// so that the input read since can be read again after rewind.
+type replayReader struct {
+	in  io.Reader
+	buf []byte // the input read since the last commit
+	pos int    // the position in buf of the next read
+}
+
+func (r *replayReader) Read(p []byte) (int, error) {
+	if r.pos < len(r.buf) {
+		n := copy(p, r.buf[r.pos:])
+		r.pos += n
+		return n, nil
+	}
+	n, err := r.in.Read(p)
+	r.buf = append(r.buf, p[:n]...)
+	r.pos += n
+	return n, err
+}
+
+// commit discards the input read so far.
+func (r *replayReader) commit() {
+	r.buf, r.pos = r.buf[:0], 0
+}
+
+// rewind makes the input read since the last commit be read again.
+func (r *replayReader) rewind() {
+	r.pos = 0
+}
+
+// readNext reads the encoded data of the next log entry, as next, but
+// if Tailing, makes an incomplete entry be read again by the next call,
+// returning ErrIncompleteEntry for it.
+func (lr *EntryDecoder) readNext() ([]byte, error) {
+	if !lr.Tailing {
+		return lr.next()
+	}
+	if lr.replay == nil {
+		lr.replay = &replayReader{in: lr.in}
+		lr.in = lr.replay
+	}
+	offset := lr.offset
+	data, err := lr.next()
+	if (err == io.EOF || err == io.ErrUnexpectedEOF) && len(lr.replay.buf) > 0 {
+		// The input, e.g. a header line, ends within the entry.
+		lr.replay.rewind()
+		lr.offset = offset
+		return nil, ErrIncompleteEntry
+	}
+	lr.replay.commit()
+	return data, err
+}
+
+// corruptionMarkerPrefix starts the message of the entries decoded in
+// place of corrupt ones.
+const corruptionMarkerPrefix = "skipped corrupt log entry"
+
+// IsCorruptionMarker returns whether the entry was decoded by an
+// EntryDecoder with SkipCorrupt set in place of a corrupt entry.
+func IsCorruptionMarker(entry *proto.LogEntry) bool {
+	return entry.File == "" && strings.HasPrefix(entry.Format, corruptionMarkerPrefix)
+}
+
+// skipCorrupt replaces the entry at offset, which couldn't be decoded
+// because of err, by a marker if SkipCorrupt is set; otherwise, it
+// returns err.
+func (lr *EntryDecoder) skipCorrupt(entry *proto.LogEntry, offset int64, err error) error {
+	if !lr.SkipCorrupt {
+		return err
+	}
+	*entry = proto.LogEntry{
+		Severity: int32(warningLog),
+		Format:   fmt.Sprintf("%s at offset %d: %s", corruptionMarkerPrefix, offset, err),
+	}
+	return nil
 }
 
 // NewEntryDecoder creates a new instance of EntryDecoder.
@@ -362,28 +467,127 @@ func NewEntryDecoder(in io.Reader) *EntryDecoder {
 }
 
 // Decode decodes the next log entry into the provided protobuf message.
+// The entry is reassembled from as many reads as the input needs, so
+// entries with large multi-line messages such as stack traces decode as
+// one entry even if the input returns them in fragments. It returns io.EOF
+// at the end of the input and io.ErrUnexpectedEOF if the input ends
+// within an entry, unless SkipCorrupt or Tailing is set. Files of any
+// known format version are decoded; an error is returned for files of a
+// newer version.
 func (lr *EntryDecoder) Decode(entry *proto.LogEntry) error {
-	// Read the next log entry.
+	if lr.truncated {
+		return io.EOF
+	}
+	offset := lr.offset
+	data, err := lr.readNext()
+	if err == io.ErrUnexpectedEOF {
+		lr.truncated = lr.SkipCorrupt
+		return lr.skipCorrupt(entry, offset, err)
+	} else if err != nil {
+		return err
+	}
+	if err := gogoproto.Unmarshal(data, entry); err != nil {
+		return lr.skipCorrupt(entry, offset, err)
+	}
+	return nil
+}
+
+// DecodeInRange decodes the next log entry whose time lies between
+// startTimestamp and endTimestamp, inclusive, in unix nanos. Entries
+// before startTimestamp are skipped without being fully decoded, and
+// io.EOF is returned once an entry after endTimestamp is read, which
+// relies on the entries of a log file being sorted by time. They are,
+// but for the entries of goroutines racing to write, which can be out of
+// order by the time it takes to write an entry.
+func (lr *EntryDecoder) DecodeInRange(entry *proto.LogEntry, startTimestamp, endTimestamp int64) error {
+	for {
+		if lr.truncated {
+			return io.EOF
+		}
+		offset := lr.offset
+		data, err := lr.readNext()
+		if err == io.ErrUnexpectedEOF {
+			lr.truncated = lr.SkipCorrupt
+			return lr.skipCorrupt(entry, offset, err)
+		} else if err != nil {
+			return err
+		}
+		t, err := entryTime(data)
+		if err != nil {
+			return lr.skipCorrupt(entry, offset, err)
+		}
+		if t < startTimestamp {
+			continue
+		}
+		if t > endTimestamp {
+			return io.EOF
+		}
+		if err := gogoproto.Unmarshal(data, entry); err != nil {
+			return lr.skipCorrupt(entry, offset, err)
+		}
+		return nil
+	}
+}
+
+// next reads the encoded data of the next log entry.
+func (lr *EntryDecoder) next() ([]byte, error) {
 	szBuf := make([]byte, 4)
-	n, err := lr.in.Read(szBuf)
+	n, err := io.ReadFull(lr.in, szBuf)
+	lr.offset += int64(n)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if size, version, err := readPreamble(szBuf, lr.in); err != nil {
+		return nil, err
+	} else if size > 0 {
+		lr.offset += size - int64(len(szBuf))
+		if version >= 0 {
+			lr.version = version
+		}
+		return lr.next()
 	}
+	switch lr.version {
+	case 0, 1:
+		// Both versions consist of length-prefixed entries.
+		return lr.readFramed(szBuf)
+	default:
+		return nil, util.Errorf("unsupported log format version %d", lr.version)
+	}
+}
+
+// readFramed reads the data of the entry whose length prefix has been
+// read into szBuf.
+func (lr *EntryDecoder) readFramed(szBuf []byte) ([]byte, error) {
 	_, sz := encoding.DecodeUint32(szBuf)
 	buf := make([]byte, sz)
-	n, err = lr.in.Read(buf)
-	if err != nil {
-		return err
+	n, err := io.ReadFull(lr.in, buf)
+	lr.offset += int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
 	}
-	if err := gogoproto.Unmarshal(buf[:n], entry); err != nil {
-		return err
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return buf, nil
+}
+
+// Offset returns the number of bytes consumed from the input, which is the
+// offset of the next entry if the input is a log file read from its
+// beginning. It can be passed to ReadEntryAt.
+func (lr *EntryDecoder) Offset() int64 {
+	return lr.offset
+}
+
+// entryDecoder is implemented by the decoders of the formats log entries
+// are read in: EntryDecoder for the binary format of log files and
+// JSONEntryDecoder for their JSON rendering.
+type entryDecoder interface {
+	Decode(entry *proto.LogEntry) error
 }
 
 type baseEntryReader struct {
 	buf    []byte
-	ld     *EntryDecoder
+	ld     entryDecoder
 	format func(entry *proto.LogEntry) []byte
 }
 
@@ -565,18 +769,41 @@ func (buf *buffer) someDigits(i, d int) int {
 	return copy(buf.tmp[i:], buf.tmp[j:])
 }
 
-func formatLogEntry(entry *proto.LogEntry, colors *colorProfile) []byte {
-	buf := formatHeader(severity(entry.Severity), time.Unix(entry.Time/1E9, entry.Time%1E9), entry.ThreadID, entry.File, entry.Line, colors)
+// formatMessage returns the message of the entry, that is its format
+// string applied to its arguments.
+func formatMessage(entry *proto.LogEntry) string {
 	var args []interface{}
 	for _, arg := range entry.Args {
 		args = append(args, arg.Str)
 	}
 	if len(entry.Format) == 0 {
-		buf.WriteString(fmt.Sprint(args...))
-	} else {
-		buf.WriteString(fmt.Sprintf(entry.Format, args...))
+		return fmt.Sprint(args...)
+	}
+	return fmt.Sprintf(entry.Format, args...)
+}
+
+func formatLogEntry(entry *proto.LogEntry, colors *colorProfile) []byte {
+	buf := formatHeader(severity(entry.Severity), time.Unix(entry.Time/1E9, entry.Time%1E9), entry.ThreadID, entry.File, entry.Line, colors)
+	if len(entry.Fields) > 0 {
+		// Structured fields precede the message as "[key=value,...] ".
+		buf.WriteByte('[')
+		for i, f := range entry.Fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(f.Key)
+			buf.WriteByte('=')
+			buf.WriteString(f.Value)
+		}
+		buf.WriteString("] ")
+	}
+	msg := formatMessage(entry)
+	buf.WriteString(msg)
+	// Multi-line messages are written verbatim; only a missing final
+	// newline is added.
+	if !strings.HasSuffix(msg, "\n") {
+		buf.WriteByte('\n')
 	}
-	buf.WriteByte('\n')
 	if len(entry.Stacks) > 0 {
 		buf.Write(entry.Stacks)
 	}
@@ -597,11 +824,26 @@ func init() {
 	go logging.flushDaemon()
 }
 
-// Flush flushes all pending log I/O.
+// Flush flushes all pending log I/O of all Loggers.
 func Flush() {
 	logging.lockAndFlushAll()
 }
 
+// FlushOnPanic flushes and syncs the files of all Loggers if the calling
+// goroutine is panicking, and then continues panicking. Buffered entries,
+// which usually explain the panic, would otherwise be lost. It must be
+// deferred directly, typically at the top of main or of a goroutine:
+//
+//	defer log.FlushOnPanic()
+//
+// Fatal log calls need no such hook, as they always flush before exiting.
+func FlushOnPanic() {
+	if r := recover(); r != nil {
+		Flush()
+		panic(r)
+	}
+}
+
 // loggingT collects all the global state of the logging setup.
 type loggingT struct {
 	// Boolean flags. Not handled atomically because the flag.Value interface
@@ -610,6 +852,7 @@ type loggingT struct {
 	toStderr        bool          // The -logtostderr flag.
 	alsoToStderr    bool          // The -alsologtostderr flag.
 	color           string        // The -color flag.
+	stackDepth      bool          // The -log-stack-depth flag.
 	hasColorProfile *bool         // Non-nil if the color profile has been determined
 	colorProfile    *colorProfile // Set via call to getTermColorProfile
 
@@ -626,8 +869,6 @@ type loggingT struct {
 	// mu protects the remaining elements of this structure and is
 	// used to synchronize logging.
 	mu sync.Mutex
-	// file holds writer for each of the log types.
-	file [numSeverity]flushSyncWriter
 	// pcs is used in V to avoid an allocation when computing the caller's PC.
 	pcs [1]uintptr
 	// vmap is a cache of the V Level for each V() call site, identified by PC.
@@ -730,6 +971,7 @@ func (l *loggingT) print(s severity, args ...interface{}) {
 	file, line := l.Caller(1)
 	entry := proto.LogEntry{}
 	setLogEntry(nil, "", args, &entry)
+	setStackDepth(&entry, 1)
 	l.outputLogEntry(s, file, line, false, &entry)
 }
 
@@ -740,7 +982,7 @@ func (l *loggingT) outputLogEntry(s severity, file string, line int, alsoToStder
 	l.mu.Lock()
 
 	// Set additional details in log entry.
-	now := time.Now()
+	now := timeNow()
 	entry.Severity = int32(s)
 	entry.Time = now.UnixNano()
 	entry.ThreadID = int32(pid) // TODO: should be TID
@@ -762,32 +1004,10 @@ func (l *loggingT) outputLogEntry(s severity, file string, line int, alsoToStder
 		if alsoToStderr || l.alsoToStderr || s >= l.stderrThreshold.get() {
 			_, _ = os.Stderr.Write(l.processForStderr(entry))
 		}
-		if l.file[s] == nil {
-			if err := l.createFiles(s); err != nil {
-				_, _ = os.Stderr.Write(l.processForStderr(entry)) // Make sure the message appears somewhere.
-				l.exit(err)
-			}
-		}
-
-		data := encodeLogEntry(entry)
-
-		switch s {
-		case fatalLog:
-			l.file[fatalLog].Write(data)
-			fallthrough
-		case errorLog:
-			l.file[errorLog].Write(data)
-			fallthrough
-		case warningLog:
-			l.file[warningLog].Write(data)
-			fallthrough
-		case infoLog:
-			l.file[infoLog].Write(data)
-		}
-
+		n := defaultLogger.output(s, entry)
 		if stats := severityStats[s]; stats != nil {
 			atomic.AddInt64(&stats.lines, 1)
-			atomic.AddInt64(&stats.bytes, int64(len(data)))
+			atomic.AddInt64(&stats.bytes, int64(n))
 		}
 	}
 	l.mu.Unlock()
@@ -866,6 +1086,25 @@ func timeoutFlush(timeout time.Duration) {
 	}
 }
 
+// setStackDepth records the depth of the stack at the logging call in the
+// entry if the -log-stack-depth flag is set; depth identifies the call as
+// for Caller. Unless the flag is set, the cost is a single check.
+func setStackDepth(entry *proto.LogEntry, depth int) {
+	if !logging.stackDepth {
+		return
+	}
+	pcs := make([]uintptr, 64)
+	for {
+		// Skip runtime.Callers and setStackDepth.
+		if n := runtime.Callers(depth+2, pcs); n < len(pcs) {
+			d := int32(n)
+			entry.StackDepth = &d
+			return
+		}
+		pcs = make([]uintptr, 2*len(pcs))
+	}
+}
+
 // stacks is a wrapper for runtime.Stack that attempts to recover the data for all goroutines.
 func stacks(all bool) []byte {
 	// We don't know how big the traces are, so grow a few times if they don't fit. Start large, though.
@@ -894,28 +1133,34 @@ var osExitFunc func(int)
 
 // exit is called if there is trouble creating or writing log files.
 // It flushes the logs and exits the program; there's no point in hanging around.
-// l.mu is held.
-func (l *loggingT) exit(err error) {
+// lg.mu is held.
+func (lg *Logger) exit(err error) {
 	fmt.Fprintf(os.Stderr, "log: exiting because of error: %s\n", err)
 	// If logExitFunc is set, we do that instead of exiting.
 	if logExitFunc != nil {
 		logExitFunc(err)
 		return
 	}
-	l.flushAll()
+	lg.flushAll()
 	osExitFunc(2)
 }
 
 // syncBuffer joins a bufio.Writer to its underlying file, providing access to the
 // file's Sync method and providing a wrapper for the Write method that provides log
 // file rotation. There are conflicting methods, so the file cannot be embedded.
-// l.mu is held for all its methods.
+// lg.mu is held for all its methods.
 type syncBuffer struct {
-	logger *loggingT
+	logger *Logger
 	*bufio.Writer
-	file   *os.File
+	file   fsFile
 	sev    severity
-	nbytes uint64 // The number of bytes written to this file
+	nbytes uint64         // The number of bytes written to this file
+	crc    hash.Hash32    // Non-nil if the file gets a checksum footer
+	index  *categoryIndex // Non-nil if the categories of the file are indexed
+	// throttled is set once a rotation of the file was refused because
+	// of the rotation rate limit, so that it's reported only once.
+	throttled bool
+	created   time.Time // When this file was started, for Logger.MaxAge
 }
 
 func (sb *syncBuffer) Sync() error {
@@ -923,11 +1168,33 @@ func (sb *syncBuffer) Sync() error {
 }
 
 func (sb *syncBuffer) Write(p []byte) (n int, err error) {
-	if sb.nbytes+uint64(len(p)) >= MaxSize {
-		if err := sb.rotateFile(time.Now()); err != nil {
-			sb.logger.exit(err)
+	return sb.writeEntry(p, "")
+}
+
+// writeEntry writes an encoded log entry, recording its category in the
+// index of the file, if any.
+func (sb *syncBuffer) writeEntry(p []byte, category string) (n int, err error) {
+	now := timeNow()
+	reason := ""
+	if sb.nbytes+uint64(len(p)) >= sb.logger.maxSize() {
+		reason = RotationBySize
+	} else if sb.logger.MaxAge > 0 && now.Sub(sb.created) >= sb.logger.MaxAge {
+		reason = RotationByAge
+	}
+	if reason != "" {
+		if sb.logger.allowRotation(now) {
+			if err := sb.rotate(now, reason); err != nil {
+				sb.logger.exit(err)
+			}
+			sb.throttled = false
+		} else if !sb.throttled {
+			sb.throttled = true
+			sb.writeThrottleWarning(now)
 		}
 	}
+	if sb.index != nil {
+		sb.index.add(category, len(p))
+	}
 	n, err = sb.Writer.Write(p)
 	sb.nbytes += uint64(n)
 	if err != nil {
@@ -936,26 +1203,55 @@ func (sb *syncBuffer) Write(p []byte) (n int, err error) {
 	return
 }
 
+// writeThrottleWarning writes an entry to the file noting that it grows
+// past MaxSize because rotations are being rate limited.
+func (sb *syncBuffer) writeThrottleWarning(now time.Time) {
+	file, line := logging.Caller(0)
+	entry := proto.LogEntry{
+		Severity: int32(warningLog),
+		Time:     now.UnixNano(),
+		File:     file,
+		Line:     int32(line),
+		Format: fmt.Sprintf("more than %d log files rotated in the last minute; "+
+			"appending past the size limit", sb.logger.MaxRotationsPerMinute),
+	}
+	data := encodeLogEntry(&entry)
+	if sb.index != nil {
+		sb.index.add("", len(data))
+	}
+	n, err := sb.Writer.Write(data)
+	sb.nbytes += uint64(n)
+	if err != nil {
+		sb.logger.exit(err)
+	}
+}
+
 // rotateFile closes the syncBuffer's file and starts a new one.
 func (sb *syncBuffer) rotateFile(now time.Time) error {
+	return sb.rotate(now, RotationRequested)
+}
+
+// rotate closes the syncBuffer's current file, if any, and starts a new
+// one, recording the reason of the rotation in it.
+func (sb *syncBuffer) rotate(now time.Time, reason string) error {
+	var previous, previousPath string
 	if sb.file != nil {
+		previousPath = sb.file.Name()
+		previous = filepath.Base(previousPath)
 		if err := sb.Flush(); err != nil {
 			return err
 		}
+		_ = sb.saveIndex() // ignore err
+		if err := sb.writeChecksumFooter(); err != nil {
+			return err
+		}
 		if err := sb.file.Close(); err != nil {
 			return err
 		}
 	}
-	var err error
-	sb.file, _, err = create(severityName[sb.sev], now)
-	sb.nbytes = 0
-	if err != nil {
-		return err
-	}
-
-	sb.Writer = bufio.NewWriterSize(sb.file, bufferSize)
 
-	// Write header.
+	// Build the header, which is written before the file is made visible.
+	var header []byte
 	file, line := logging.Caller(0)
 	for _, format := range []string{
 		fmt.Sprintf("Running on machine: %s", host),
@@ -963,44 +1259,187 @@ func (sb *syncBuffer) rotateFile(now time.Time) error {
 			runtime.Compiler, runtime.Version(), runtime.GOOS, runtime.GOARCH),
 	} {
 		entry := proto.LogEntry{
-			Time:   time.Now().UnixNano(),
+			Time:   timeNow().UnixNano(),
 			File:   file,
 			Line:   int32(line),
 			Format: format,
 		}
-		n, err := sb.file.Write(encodeLogEntry(&entry))
-		if err != nil {
-			panic(err)
+		header = append(header, encodeLogEntry(&entry)...)
+	}
+	if previous != "" {
+		entry := rotationMarkerEntry(RotationMarker{
+			PreviousFile: previous,
+			Reason:       reason,
+			ProcessStart: processStart.UnixNano(),
+		}, timeNow(), file, line)
+		header = append(header, encodeLogEntry(&entry)...)
+	}
+
+	var err error
+	sb.file, _, err = sb.logger.create(severityName[sb.sev], now, header)
+	if err != nil {
+		sb.nbytes = 0
+		return err
+	}
+	sb.nbytes = uint64(len(header))
+	sb.created = now
+	sb.crc = nil
+	var w io.Writer = sb.file
+	if sb.logger.ChecksumFiles {
+		// The file may have been appended to, so all of it is checksummed.
+		if sb.crc, err = fileChecksum(sb.logger.fileSystem(), sb.file.Name()); err != nil {
+			return err
 		}
-		sb.nbytes += uint64(n)
+		w = io.MultiWriter(sb.file, sb.crc)
+	}
+	sb.Writer = bufio.NewWriterSize(w, sb.logger.bufferSize())
+	sb.index = nil
+	if sb.logger.IndexCategories {
+		preamble := sb.logger.filePreamble(severityName[sb.sev], now)
+		sb.index = openCategoryIndex(sb.file, len(preamble)+len(header))
+	}
+	if previousPath != "" {
+		sb.logger.runRotationCallbacks(previousPath)
 	}
+	return nil
+}
+
+// writeChecksumFooter ends the file with its checksum footer, if it gets
+// one. The buffered entries must have been flushed.
+func (sb *syncBuffer) writeChecksumFooter() error {
+	if sb.crc == nil {
+		return nil
+	}
+	_, err := sb.file.Write(checksumFooter(sb.crc.Sum32()))
 	return err
 }
 
+// saveIndex writes the index of the file, if any, next to it. The
+// buffered entries must have been flushed.
+func (sb *syncBuffer) saveIndex() error {
+	if sb.index == nil {
+		return nil
+	}
+	return sb.index.save(sb.file.Name())
+}
+
 // bufferSize sizes the buffer associated with each log file. It's large
 // so that log records can accumulate without the logging thread blocking
 // on disk I/O. The flushDaemon will block instead.
 const bufferSize = 256 * 1024
 
+// bufferSize returns the size of the buffers of the Logger's files.
+func (lg *Logger) bufferSize() int {
+	if lg.BufferSize > 0 {
+		return lg.BufferSize
+	}
+	return bufferSize
+}
+
 // createFiles creates all the log files for severity from sev down to InfoLog.
-// l.mu is held.
-func (l *loggingT) createFiles(sev severity) error {
-	now := time.Now()
+// lg.mu is held.
+func (lg *Logger) createFiles(sev severity) error {
+	now := timeNow()
+	lowest := infoLog
+	if lg.CombinedFile {
+		lowest = sev
+	}
 	// Files are created in decreasing severity order, so as soon as we find one
 	// has already been created, we can stop.
-	for s := sev; s >= infoLog && l.file[s] == nil; s-- {
+	for s := sev; s >= lowest && lg.file[s] == nil; s-- {
 		sb := &syncBuffer{
-			logger: l,
+			logger: lg,
 			sev:    s,
 		}
 		if err := sb.rotateFile(now); err != nil {
 			return err
 		}
-		l.file[s] = sb
+		lg.file[s] = sb
+	}
+	if lg.FlushInterval > 0 && lg.stopFlushing == nil {
+		lg.stopFlushing = make(chan struct{})
+		go lg.flushPeriodically(lg.FlushInterval, lg.stopFlushing)
 	}
 	return nil
 }
 
+// flushPeriodically flushes the Logger's files every interval until stop
+// is closed.
+func (lg *Logger) flushPeriodically(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			lg.Flush()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// fileSeverities returns the range of severities, from highest to
+// lowest, of the files an entry of severity s is written to: its own and
+// all lower ones, or, with CombinedFile, the threshold's only. ok is false
+// if the entry isn't written to any file.
+func (lg *Logger) fileSeverities(s severity) (highest, lowest severity, ok bool) {
+	if !lg.CombinedFile {
+		return s, infoLog, true
+	}
+	threshold := severity(lg.CombinedThreshold)
+	if threshold < infoLog {
+		threshold = infoLog
+	} else if threshold > fatalLog {
+		threshold = fatalLog
+	}
+	return threshold, threshold, s >= threshold
+}
+
+// output encodes the entry and writes it to the log files for its
+// severity and all lower severities, creating the files if necessary. It
+// returns the size of the encoded entry.
+func (lg *Logger) output(s severity, entry *proto.LogEntry) int {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	if lg == defaultLogger {
+		onceSyslog.Do(createSyslogSink)
+	}
+	highest, lowest, ok := lg.fileSeverities(s)
+	if ok && lg.file[highest] == nil {
+		if err := lg.createFiles(highest); err != nil {
+			_, _ = os.Stderr.Write(formatLogEntry(entry, nil)) // Make sure the message appears somewhere.
+			lg.exit(err)
+			return 0
+		}
+	}
+
+	data := encodeLogEntry(entry)
+	var category string
+	if lg.IndexCategories {
+		category = messageCategory(formatMessage(entry))
+	}
+
+	if ok {
+		for f := highest; f >= lowest; f-- {
+			lg.write(f, data, category)
+		}
+	}
+	for _, sink := range lg.sinks {
+		sink.write(entry)
+	}
+	return len(data)
+}
+
+// write writes the encoded entry to the file of the given severity,
+// indexing it under category if the file is indexed. lg.mu is held.
+func (lg *Logger) write(s severity, data []byte, category string) {
+	if sb, ok := lg.file[s].(*syncBuffer); ok {
+		sb.writeEntry(data, category)
+		return
+	}
+	lg.file[s].Write(data)
+}
+
 const flushInterval = 30 * time.Second
 
 // flushDaemon periodically flushes the log file buffers.
@@ -1011,24 +1450,136 @@ func (l *loggingT) flushDaemon() {
 	}
 }
 
-// lockAndFlushAll is like flushAll but locks l.mu first.
+// lockAndFlushAll flushes the logs of all Loggers in use.
 func (l *loggingT) lockAndFlushAll() {
-	l.mu.Lock()
-	l.flushAll()
-	l.mu.Unlock()
+	loggers.Lock()
+	defer loggers.Unlock()
+	for _, lg := range loggers.all {
+		lg.Flush()
+	}
+}
+
+// Flush flushes the Logger's files and attempts to "sync" their data to
+// disk.
+func (lg *Logger) Flush() {
+	lg.mu.Lock()
+	lg.flushAll()
+	lg.mu.Unlock()
+}
+
+// Sync flushes the files of all Loggers and syncs them to disk, returning
+// the first error encountered. Unlike Flush, it lets callers which must
+// know that the entries logged so far are durable, as before a planned
+// crash or shutdown, find out.
+func Sync() error {
+	loggers.Lock()
+	defer loggers.Unlock()
+	var err error
+	for _, lg := range loggers.all {
+		if sErr := lg.Sync(); err == nil {
+			err = sErr
+		}
+	}
+	return err
+}
+
+// Sync flushes the Logger's files and syncs them to disk, returning the
+// first error encountered.
+func (lg *Logger) Sync() error {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	var err error
+	for s := fatalLog; s >= infoLog; s-- {
+		file := lg.file[s]
+		if file == nil {
+			continue
+		}
+		if fErr := file.Flush(); err == nil {
+			err = fErr
+		}
+		if sb, ok := file.(*syncBuffer); ok {
+			_ = sb.saveIndex() // ignore error
+		}
+		if sErr := file.Sync(); err == nil {
+			err = sErr
+		}
+	}
+	for _, sink := range lg.sinks {
+		sink.flush()
+	}
+	return err
 }
 
 // flushAll flushes all the logs and attempts to "sync" their data to disk.
-// l.mu is held.
-func (l *loggingT) flushAll() {
+// lg.mu is held.
+func (lg *Logger) flushAll() {
 	// Flush from fatal down, in case there's trouble flushing.
 	for s := fatalLog; s >= infoLog; s-- {
-		file := l.file[s]
+		file := lg.file[s]
 		if file != nil {
 			_ = file.Flush() // ignore error
-			_ = file.Sync()  // ignore error
+			if sb, ok := file.(*syncBuffer); ok {
+				_ = sb.saveIndex() // ignore error
+			}
+			_ = file.Sync() // ignore error
+		}
+	}
+	for _, sink := range lg.sinks {
+		sink.flush()
+	}
+}
+
+// Close flushes and closes the Logger's files, and stops the Logger from
+// being flushed periodically. Files are created anew if the Logger is
+// written to again.
+func (lg *Logger) Close() error {
+	lg.mu.Lock()
+	err := lg.closeFiles()
+	if lg.stopFlushing != nil {
+		close(lg.stopFlushing)
+		lg.stopFlushing = nil
+	}
+	lg.stopRotationWorker()
+	sinks := lg.sinks
+	lg.sinks = nil
+	lg.mu.Unlock()
+	for _, s := range sinks {
+		s.stop()
+	}
+
+	loggers.Lock()
+	defer loggers.Unlock()
+	for i, other := range loggers.all {
+		if other == lg {
+			loggers.all = append(loggers.all[:i], loggers.all[i+1:]...)
+			break
 		}
 	}
+	return err
+}
+
+// closeFiles flushes and closes the Logger's files, which are created
+// anew by the next write. lg.mu is held.
+func (lg *Logger) closeFiles() error {
+	var err error
+	for s := fatalLog; s >= infoLog; s-- {
+		if sb, ok := lg.file[s].(*syncBuffer); ok {
+			if fErr := sb.Flush(); fErr != nil && err == nil {
+				err = fErr
+			}
+			if iErr := sb.saveIndex(); iErr != nil && err == nil {
+				err = iErr
+			}
+			if fErr := sb.writeChecksumFooter(); fErr != nil && err == nil {
+				err = fErr
+			}
+			if cErr := sb.file.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}
+		lg.file[s] = nil
+	}
+	return err
 }
 
 // CopyStandardLogTo arranges for messages written to the Go "log" package's
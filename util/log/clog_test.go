@@ -19,24 +19,34 @@ package log
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	stdLog "log"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
 )
 
 // Test that shortHostname works as advertised.
 func TestShortHostname(t *testing.T) {
 	for hostname, expect := range map[string]string{
-		"":                "",
-		"host":            "host",
-		"host.google.com": "host",
+		"":                      "",
+		"host":                  "host",
+		"host.google.com":       "host",
+		"node1.dc1.example.com": "node1",
+		"10.0.0.1":              "10.0.0.1",
+		"fe80::1":               "fe80--1",
+		"[2001:db8::ff00:42]":   "2001-db8--ff00-42",
+		"::ffff:192.168.0.1":    "192.168.0.1",
 	} {
 		if got := shortHostname(hostname); expect != got {
 			t.Errorf("shortHostname(%q): expected %q, got %q", hostname, expect, got)
@@ -57,13 +67,13 @@ func (f *flushBuffer) Sync() error {
 	return nil
 }
 
-// swap sets the log writers and returns the old array.
+// swap sets the log writers of the default Logger and returns the old array.
 func (l *loggingT) swap(writers [numSeverity]flushSyncWriter) (old [numSeverity]flushSyncWriter) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	old = l.file
+	defaultLogger.mu.Lock()
+	defer defaultLogger.mu.Unlock()
+	old = defaultLogger.file
 	for i, w := range writers {
-		logging.file[i] = w
+		defaultLogger.file[i] = w
 	}
 	return
 }
@@ -75,7 +85,7 @@ func (l *loggingT) newBuffers() [numSeverity]flushSyncWriter {
 
 // contents returns the specified log value as a string.
 func contents(s severity) string {
-	buffer := bytes.NewBuffer(logging.file[s].(*flushBuffer).Buffer.Bytes())
+	buffer := bytes.NewBuffer(defaultLogger.file[s].(*flushBuffer).Buffer.Bytes())
 	hr := NewTermEntryReader(buffer)
 	bytes, err := ioutil.ReadAll(hr)
 	if err != nil {
@@ -86,7 +96,7 @@ func contents(s severity) string {
 
 // jsonContents returns the specified log JSON-encoded.
 func jsonContents(s severity) []byte {
-	buffer := bytes.NewBuffer(logging.file[s].(*flushBuffer).Buffer.Bytes())
+	buffer := bytes.NewBuffer(defaultLogger.file[s].(*flushBuffer).Buffer.Bytes())
 	hr := NewJSONEntryReader(buffer)
 	bytes, err := ioutil.ReadAll(hr)
 	if err != nil {
@@ -318,12 +328,12 @@ func TestListLogFiles(t *testing.T) {
 	Warning("x") // Be sure we have a file.
 	var info, warn *syncBuffer
 	var ok bool
-	info, ok = logging.file[infoLog].(*syncBuffer)
+	info, ok = defaultLogger.file[infoLog].(*syncBuffer)
 	if !ok {
 		t.Fatal("info wasn't created")
 	}
 	infoName := path.Base(info.file.Name())
-	warn, ok = logging.file[warningLog].(*syncBuffer)
+	warn, ok = defaultLogger.file[warningLog].(*syncBuffer)
 	if !ok {
 		t.Fatal("warning wasn't created")
 	}
@@ -350,7 +360,7 @@ func TestGetLogReader(t *testing.T) {
 	setFlags()
 	*logDir = os.TempDir()
 	Warning("x")
-	warn, ok := logging.file[warningLog].(*syncBuffer)
+	warn, ok := defaultLogger.file[warningLog].(*syncBuffer)
 	if !ok {
 		t.Fatal("warning wasn't created")
 	}
@@ -400,7 +410,7 @@ func TestRollover(t *testing.T) {
 	MaxSize = 512
 
 	Info("x") // Be sure we have a file.
-	info, ok := logging.file[infoLog].(*syncBuffer)
+	info, ok := defaultLogger.file[infoLog].(*syncBuffer)
 	if !ok {
 		t.Fatal("info wasn't created")
 	}
@@ -534,9 +544,331 @@ func TestFatalStacktraceStderr(t *testing.T) {
 
 }
 
+func TestFlushOnPanic(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("expected the panic to be propagated; got %v", r)
+			}
+		}()
+		defer FlushOnPanic()
+		lg.Infoc(nil, "buffered")
+		panic("boom")
+	}()
+
+	name, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "buffered") {
+		t.Errorf("expected buffered entry to be on disk; got %q", data)
+	}
+}
+
+// readActiveFile returns the contents of the active file of the level on
+// disk, as a crash would leave it.
+func readActiveFile(t *testing.T, lg *Logger, level Level) string {
+	name, err := lg.ActiveLogFile(level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestSync verifies that the entries buffered when Sync returns are on
+// disk, as they would be if the process crashed right after.
+func TestSync(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Infoc(nil, "first")
+	lg.Flush()
+	lg.Warningc(nil, "last")
+	if data := readActiveFile(t, lg, InfoLevel); strings.Contains(data, "last") {
+		t.Fatalf("expected the last entry to be buffered; got %q", data)
+	}
+	if err := lg.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	for _, level := range []Level{InfoLevel, WarningLevel} {
+		if data := readActiveFile(t, lg, level); !strings.Contains(data, "last") {
+			t.Errorf("%s: expected the last entry to be on disk; got %q", level, data)
+		}
+	}
+}
+
+// TestBufferedWriting verifies that BufferSize bounds what's buffered
+// and that FlushInterval flushes the files in the background.
+func TestBufferedWriting(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.BufferSize = 16
+	lg.Infoc(nil, "larger than the buffer")
+	if data := readActiveFile(t, lg, InfoLevel); !strings.Contains(data, "larger than the buffer") {
+		t.Errorf("expected an entry larger than the buffer to be written through; got %q", data)
+	}
+
+	lg, cleanup = newTestLogger(t)
+	defer cleanup()
+	lg.FlushInterval = time.Millisecond
+	lg.Infoc(nil, "flushed in the background")
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		if strings.Contains(readActiveFile(t, lg, InfoLevel), "flushed in the background") {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("expected the entry to be flushed")
+		}
+	}
+}
+
+// TestCombinedFile verifies that with CombinedFile, the entries at or
+// above the threshold go to a single file of the threshold's level, with
+// their own severities, and the others to no file.
+func TestCombinedFile(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.CombinedFile = true
+	lg.CombinedThreshold = WarningLevel
+	lg.Infoc(nil, "info")
+	lg.Warningc(nil, "warning")
+	lg.Errorc(nil, "error")
+	lg.Infoc(nil, "info again")
+	lg.Flush()
+
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Details.Level != WarningLevel {
+		t.Fatalf("expected a single WARNING file; got %+v", files)
+	}
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, 0, timeNow().UnixNano())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Apart from the file's header entries, only the error and warning
+	// entries were written.
+	severities := map[string]Level{}
+	for _, entry := range entries {
+		severities[entry.Format] = Level(entry.Severity)
+	}
+	expected := map[string]Level{"error": ErrorLevel, "warning": WarningLevel}
+	for format, level := range expected {
+		if severities[format] != level {
+			t.Errorf("expected a %s entry %q; got %+v", level, format, entries)
+		}
+	}
+	for _, format := range []string{"info", "info again"} {
+		if _, ok := severities[format]; ok {
+			t.Errorf("expected no entry %q below the threshold; got %+v", format, entries)
+		}
+	}
+}
+
+// TestDecodeMultiLineEntry verifies that an entry with a multi-line stack
+// trace message decodes as a single entry even when its bytes arrive in
+// fragments, and that formatting preserves the message.
+func TestDecodeMultiLineEntry(t *testing.T) {
+	trace := "panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/src/main.go:12 +0x2a\n"
+	var data []byte
+	for _, format := range []string{trace, "next"} {
+		data = append(data, encodeLogEntry(&proto.LogEntry{Severity: int32(errorLog), Format: format})...)
+	}
+
+	decoder := NewEntryDecoder(iotest.OneByteReader(bytes.NewReader(data)))
+	var formats []string
+	for {
+		var entry proto.LogEntry
+		if err := decoder.Decode(&entry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatal(err)
+		}
+		formats = append(formats, entry.Format)
+		msg := entry.Format
+		if !strings.HasSuffix(msg, "\n") {
+			msg += "\n"
+		}
+		if formatted := string(formatLogEntry(&entry, nil)); !strings.HasSuffix(formatted, "] "+msg) {
+			t.Errorf("expected message to be formatted verbatim; got %q", formatted)
+		}
+	}
+	if exp := []string{trace, "next"}; !reflect.DeepEqual(formats, exp) {
+		t.Errorf("expected %q; got %q", exp, formats)
+	}
+
+	// An input ending within an entry is reported as such.
+	decoder = NewEntryDecoder(bytes.NewReader(data[:len(data)-1]))
+	var entry proto.LogEntry
+	if err := decoder.Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.Decode(&entry); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF; got %v", err)
+	}
+}
+
 func BenchmarkHeader(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		buf := formatHeader(infoLog, time.Now(), 1, "file.go", 100, nil)
 		logging.putBuffer(buf)
 	}
 }
+
+func TestDecodeInRange(t *testing.T) {
+	var data []byte
+	for i := int64(1); i <= 5; i++ {
+		entry := proto.LogEntry{
+			Severity: int32(infoLog),
+			Time:     i,
+			ThreadID: 7,
+			File:     "file.go",
+			Format:   fmt.Sprintf("entry %d", i),
+		}
+		encoded := encodeLogEntry(&entry)
+		if tm, err := entryTime(encoded[4:]); err != nil || tm != i {
+			t.Errorf("expected time %d; got %d, %v", i, tm, err)
+		}
+		data = append(data, encoded...)
+	}
+
+	decoder := NewEntryDecoder(bytes.NewReader(data))
+	var msgs []string
+	for {
+		var entry proto.LogEntry
+		if err := decoder.DecodeInRange(&entry, 2, 4); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, entry.Format)
+	}
+	if exp := []string{"entry 2", "entry 3", "entry 4"}; !reflect.DeepEqual(msgs, exp) {
+		t.Errorf("expected %q; got %q", exp, msgs)
+	}
+}
+
+// TestDecodeSkipCorrupt verifies that with SkipCorrupt set, corrupt and
+// truncated entries are replaced by markers and the other entries are
+// decoded.
+func TestDecodeSkipCorrupt(t *testing.T) {
+	var data []byte
+	for i := 1; i <= 3; i++ {
+		data = append(data, encodeLogEntry(&proto.LogEntry{
+			Time:   int64(i),
+			File:   "file.go",
+			Format: fmt.Sprintf("entry %d", i),
+		})...)
+		if i == 1 {
+			// A well-framed entry whose payload isn't a valid proto.
+			data = append(data, 0, 0, 0, 3, 0xff, 0xff, 0xff)
+		}
+	}
+	// Truncate the last entry.
+	data = data[:len(data)-2]
+
+	decode := func(skipCorrupt bool) ([]string, error) {
+		decoder := NewEntryDecoder(bytes.NewReader(data))
+		decoder.SkipCorrupt = skipCorrupt
+		var msgs []string
+		for {
+			var entry proto.LogEntry
+			if err := decoder.Decode(&entry); err == io.EOF {
+				return msgs, nil
+			} else if err != nil {
+				return msgs, err
+			}
+			if IsCorruptionMarker(&entry) {
+				msgs = append(msgs, "corrupt")
+			} else {
+				msgs = append(msgs, entry.Format)
+			}
+		}
+	}
+
+	if _, err := decode(false); err == nil {
+		t.Errorf("expected an error decoding strictly")
+	}
+	msgs, err := decode(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"entry 1", "corrupt", "entry 2", "corrupt"}; !reflect.DeepEqual(msgs, exp) {
+		t.Errorf("expected %q; got %q", exp, msgs)
+	}
+}
+
+// TestDecodeTailing verifies that a tailing decoder reads entries written
+// in pieces split anywhere, including within their length prefixes and
+// the file's prelude, as soon as each is complete.
+func TestDecodeTailing(t *testing.T) {
+	data := append([]byte(nil), filePrelude...)
+	var exp []string
+	for i := 1; i <= 5; i++ {
+		msg := fmt.Sprintf("entry %d", i)
+		data = append(data, encodeLogEntry(&proto.LogEntry{Time: int64(i), Format: msg})...)
+		exp = append(exp, msg)
+	}
+
+	for _, pieceSize := range []int{1, 2, 3, 7, len(data)} {
+		f, err := ioutil.TempFile("", "tailing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		r, err := os.Open(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoder := NewEntryDecoder(r)
+		decoder.Tailing = true
+		var msgs []string
+		for written := 0; written < len(data); {
+			end := written + pieceSize
+			if end > len(data) {
+				end = len(data)
+			}
+			if _, err := f.Write(data[written:end]); err != nil {
+				t.Fatal(err)
+			}
+			written = end
+			for {
+				var entry proto.LogEntry
+				err := decoder.Decode(&entry)
+				if err == io.EOF || err == ErrIncompleteEntry {
+					break
+				} else if err != nil {
+					t.Fatalf("piece size %d, %d bytes written: %s", pieceSize, written, err)
+				}
+				msgs = append(msgs, entry.Format)
+			}
+			if decoder.Offset() > int64(written) {
+				t.Fatalf("piece size %d: offset %d past the %d bytes written", pieceSize, decoder.Offset(), written)
+			}
+		}
+		var entry proto.LogEntry
+		if err := decoder.Decode(&entry); err != io.EOF {
+			t.Errorf("piece size %d: expected io.EOF after the last entry; got %v", pieceSize, err)
+		}
+		if !reflect.DeepEqual(msgs, exp) {
+			t.Errorf("piece size %d: expected %q; got %q", pieceSize, exp, msgs)
+		}
+		if decoder.Offset() != int64(len(data)) {
+			t.Errorf("piece size %d: expected offset %d; got %d", pieceSize, len(data), decoder.Offset())
+		}
+		r.Close()
+		f.Close()
+	}
+}
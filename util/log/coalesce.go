@@ -0,0 +1,82 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import "github.com/cockroachdb/cockroach/proto"
+
+// A CoalescedEntry stands for a run of consecutive identical log entries,
+// as logged by retry loops, like "message repeated N times" in syslog.
+type CoalescedEntry struct {
+	// Entry is the first entry of the run.
+	Entry proto.LogEntry
+	// Count is the number of entries in the run.
+	Count int
+	// FirstTime and LastTime are the earliest and latest times of the
+	// entries of the run, in unix nanos.
+	FirstTime, LastTime int64
+}
+
+// identicalEntries returns whether the entries are repetitions of each
+// other: they have the same severity, location and formatted message.
+// Their times and all other details are ignored.
+func identicalEntries(a, b *proto.LogEntry) bool {
+	return a.Severity == b.Severity && a.File == b.File && a.Line == b.Line &&
+		formatMessage(a) == formatMessage(b)
+}
+
+// CoalesceEntries coalesces every run of consecutive identical entries
+// into a single CoalescedEntry. The order of the entries is preserved.
+func CoalesceEntries(entries []proto.LogEntry) []CoalescedEntry {
+	var coalesced []CoalescedEntry
+	for i := range entries {
+		entry := &entries[i]
+		if n := len(coalesced); n > 0 && identicalEntries(&coalesced[n-1].Entry, entry) {
+			last := &coalesced[n-1]
+			last.Count++
+			if entry.Time < last.FirstTime {
+				last.FirstTime = entry.Time
+			}
+			if entry.Time > last.LastTime {
+				last.LastTime = entry.Time
+			}
+			continue
+		}
+		coalesced = append(coalesced, CoalescedEntry{
+			Entry:     *entry,
+			Count:     1,
+			FirstTime: entry.Time,
+			LastTime:  entry.Time,
+		})
+	}
+	return coalesced
+}
+
+// FetchCoalescedEntries fetches log entries like FetchEntriesFromFiles
+// and coalesces runs of identical consecutive entries.
+func FetchCoalescedEntries(level Level, startTimestamp, endTimestamp int64) ([]CoalescedEntry, error) {
+	return defaultLogger.FetchCoalescedEntries(level, startTimestamp, endTimestamp)
+}
+
+// FetchCoalescedEntries fetches log entries like FetchEntriesFromFiles
+// and coalesces runs of identical consecutive entries. EntriesCutoff
+// applies to the entries before they are coalesced.
+func (lg *Logger) FetchCoalescedEntries(level Level, startTimestamp, endTimestamp int64) ([]CoalescedEntry, error) {
+	entries, err := lg.FetchEntriesFromFiles(level, startTimestamp, endTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	return CoalesceEntries(entries), nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func TestCoalesceEntries(t *testing.T) {
+	entry := func(time int64, format string) proto.LogEntry {
+		return proto.LogEntry{Time: time, File: "a.go", Line: 1, Format: format}
+	}
+	entries := []proto.LogEntry{
+		entry(6, "retry"),
+		entry(5, "retry"),
+		entry(4, "retry"),
+		entry(3, "done"),
+		entry(2, "retry"),
+		{Time: 1, File: "a.go", Line: 2, Format: "retry"},
+	}
+	var got []string
+	var counts []int
+	var spans [][2]int64
+	for _, c := range CoalesceEntries(entries) {
+		got = append(got, c.Entry.Format)
+		counts = append(counts, c.Count)
+		spans = append(spans, [2]int64{c.FirstTime, c.LastTime})
+	}
+	if exp := []string{"retry", "done", "retry", "retry"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %s; got %s", exp, got)
+	}
+	if exp := []int{3, 1, 1, 1}; !reflect.DeepEqual(counts, exp) {
+		t.Errorf("expected counts %d; got %d", exp, counts)
+	}
+	if exp := [][2]int64{{4, 6}, {3, 3}, {2, 2}, {1, 1}}; !reflect.DeepEqual(spans, exp) {
+		t.Errorf("expected time spans %d; got %d", exp, spans)
+	}
+}
+
+func TestFetchCoalescedEntries(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	for i := 0; i < 5; i++ {
+		lg.Warningc(nil, "connection refused, retrying")
+	}
+	lg.Flush()
+
+	coalesced, err := lg.FetchCoalescedEntries(WarningLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, c := range coalesced {
+		if c.Entry.Format == "connection refused, retrying" {
+			if found || c.Count != 5 || c.FirstTime > c.LastTime {
+				t.Errorf("unexpected coalesced entry %+v", c)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected coalesced entry; got %+v", coalesced)
+	}
+}
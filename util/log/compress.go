@@ -0,0 +1,82 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// compressionSuffixes are the suffixes of the names of archived log
+// files which GetLogReader recognizes as compressed.
+var compressionSuffixes = []string{".gz", ".bz2"}
+
+// splitCompressionSuffix splits the name of a possibly compressed log file
+// into the name of the log file and the suffix of the compression, if
+// any.
+func splitCompressionSuffix(filename string) (string, string) {
+	for _, suffix := range compressionSuffixes {
+		if strings.HasSuffix(filename, suffix) {
+			return strings.TrimSuffix(filename, suffix), suffix
+		}
+	}
+	return filename, ""
+}
+
+// decompressedFile reads a compressed log file, closing the underlying
+// reader when closed.
+type decompressedFile struct {
+	io.Reader
+	c io.Closer
+}
+
+func (d decompressedFile) Close() error {
+	if c, ok := d.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return d.c.Close()
+}
+
+// openLogFileReader opens the log file for reading, decompressing it as
+// its name says.
+func openLogFileReader(fs fileSystem, filename string) (io.ReadCloser, error) {
+	f, err := fs.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(filename, f)
+}
+
+// decompress returns a reader decompressing rc as the log file name says,
+// which closes rc when closed. rc is closed on error.
+func decompress(name string, rc io.ReadCloser) (io.ReadCloser, error) {
+	var r io.Reader
+	var err error
+	switch _, suffix := splitCompressionSuffix(name); suffix {
+	case "":
+		return rc, nil
+	case ".gz":
+		if r, err = gzip.NewReader(rc); err != nil {
+			rc.Close()
+			return nil, err
+		}
+	case ".bz2":
+		r = bzip2.NewReader(rc)
+	}
+	return decompressedFile{Reader: r, c: rc}, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// archivedEntriesBzip2 is the bzip2 compression of two entries, "archived
+// one" and "archived two". The standard library can't compress bzip2.
+const archivedEntriesBzip2 = "BZh91AY&SY\x7f\xbc\x6b\xaa\x00\x00\x01\xf9\xfa\xc0\x44\x48\x40\x50\x40\x10\x00\x3e\x61\x95\x80\x60\x80\x01\x00\x40\x00\x00\x40\x00\x20\x08\x08\x20\x00\x54\x25\x42\x69\xa0\x31\x00\xf5\x03\x01\x2a\x9b\x48\xd0\xf5\x00\xcd\x40\x68\x17\x0e\xa0\x42\x02\x16\x16\x8e\x14\x79\xe8\xa6\x23\xc0\x53\x29\x30\x83\x6c\x48\x62\x1b\xb6\xa2\xfa\x11\x09\x14\x3d\xfa\x44\xc9\x94\x2a\x2e\xe4\x8a\x70\xa1\x20\xff\x78\xd7\x54"
+
+// TestGetLogReaderCompressed verifies that GetLogReader decompresses
+// archived log files by their suffix.
+func TestGetLogReaderCompressed(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+
+	var plain bytes.Buffer
+	for i, msg := range []string{"archived one", "archived two"} {
+		entry := proto.LogEntry{Time: 1433866248000000000 + int64(i), Format: msg}
+		if err := ProtoEncoding.EncodeEntry(&plain, &entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	if _, err := w.Write(plain.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	const name = "cockroach.host.user.log.INFO.20150609-161048.1"
+	for suffix, data := range map[string][]byte{
+		"":     plain.Bytes(),
+		".gz":  gz.Bytes(),
+		".bz2": []byte(archivedEntriesBzip2),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name+suffix), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, filename := range []string{name + suffix, filepath.Join(dir, name+suffix)} {
+			reader, err := lg.GetLogReader(filename, true)
+			if err != nil {
+				t.Fatalf("%s: %s", filename, err)
+			}
+			var msgs []string
+			decoder := NewEntryDecoder(reader)
+			for {
+				var entry proto.LogEntry
+				if err := decoder.Decode(&entry); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("%s: %s", filename, err)
+				}
+				msgs = append(msgs, entry.Format)
+			}
+			if err := reader.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if exp := []string{"archived one", "archived two"}; !reflect.DeepEqual(msgs, exp) {
+				t.Errorf("%s: expected %q; got %q", filename, exp, msgs)
+			}
+		}
+	}
+
+	// The compressed files are listed, and fetched from.
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	if exp := []string{name, name + ".bz2", name + ".gz"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected %s; got %s", exp, names)
+	}
+	if err := os.Remove(filepath.Join(dir, name)); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected the 2 archived entries once; got %+v", entries)
+	}
+}
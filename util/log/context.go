@@ -17,7 +17,12 @@
 
 package log
 
-import "golang.org/x/net/context"
+import (
+	"fmt"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"golang.org/x/net/context"
+)
 
 // Add takes a context and an additional even number of arguments,
 // interpreted as key-value pairs. These are added on top of the
@@ -32,3 +37,32 @@ func Add(ctx context.Context, kvs ...interface{}) context.Context {
 	}
 	return ctx
 }
+
+// fieldsKey is the context key of the structured fields added by
+// WithField.
+type fieldsKey struct{}
+
+// WithField returns a context which makes the entries logged with it,
+// e.g. through Infoc, carry the structured key/value field, in addition
+// to the fields of ctx. The value is rendered with fmt.Sprint. A field
+// replaces a field of the same key already in ctx.
+func WithField(ctx context.Context, key string, value interface{}) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	field := proto.LogEntry_Field{Key: key, Value: fmt.Sprint(value)}
+	var fields []proto.LogEntry_Field
+	for _, f := range contextFields(ctx) {
+		if f.Key != key {
+			fields = append(fields, f)
+		}
+	}
+	return context.WithValue(ctx, fieldsKey{}, append(fields, field))
+}
+
+// contextFields returns the structured fields added to ctx by WithField,
+// which must not be modified.
+func contextFields(ctx context.Context) []proto.LogEntry_Field {
+	fields, _ := ctx.Value(fieldsKey{}).([]proto.LogEntry_Field)
+	return fields
+}
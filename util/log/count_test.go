@@ -0,0 +1,156 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// writeCountFixture writes a file of numEntries entries with times 0
+// through numEntries-1 to the Logger's directory, where every third entry
+// is a warning, and returns its FileInfo.
+func writeCountFixture(t testing.TB, lg *Logger, numEntries int, prefix []byte) FileInfo {
+	data := prefix
+	for i := 0; i < numEntries; i++ {
+		sev := infoLog
+		if i%3 == 0 {
+			sev = warningLog
+		}
+		data = append(data, encodeLogEntry(&proto.LogEntry{
+			Severity: int32(sev),
+			Time:     int64(i),
+			File:     "file.go",
+			Line:     int32(i),
+			Format:   "entry %d",
+			Args:     []proto.LogEntry_Arg{{Str: strings.Repeat(strconv.Itoa(i), 10)}},
+		})...)
+	}
+	name := "cockroach.host.user.log.INFO.20150609-161048.1"
+	if err := ioutil.WriteFile(filepath.Join(lg.logDirs()[0], name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files[0]
+}
+
+func TestCountEntries(t *testing.T) {
+	for _, prefix := range [][]byte{nil, filePrelude} {
+		func() {
+			lg, cleanup := newTestLogger(t)
+			defer cleanup()
+			file := writeCountFixture(t, lg, 30, prefix)
+
+			for _, tc := range []struct {
+				level      Level
+				start, end int64
+				exp        int
+			}{
+				{InfoLevel, 0, math.MaxInt64, 30},
+				{WarningLevel, 0, math.MaxInt64, 10},
+				{ErrorLevel, 0, math.MaxInt64, 0},
+				{InfoLevel, 10, 19, 10},
+				{WarningLevel, 10, 19, 3},
+			} {
+				count, err := lg.CountEntries(file, tc.level, tc.start, tc.end)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count != tc.exp {
+					t.Errorf("%s [%d, %d]: expected %d entries; got %d", tc.level, tc.start, tc.end, tc.exp, count)
+				}
+			}
+
+			// An incomplete last entry isn't counted.
+			path := filepath.Join(lg.logDirs()[0], file.Name)
+			if err := os.Truncate(path, file.SizeBytes-5); err != nil {
+				t.Fatal(err)
+			}
+			if count, err := lg.CountEntries(file, InfoLevel, 0, math.MaxInt64); err != nil {
+				t.Fatal(err)
+			} else if count != 29 {
+				t.Errorf("expected 29 complete entries; got %d", count)
+			}
+		}()
+	}
+}
+
+func benchmarkCount(b *testing.B, count func(lg *Logger, file FileInfo) (int, error)) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lg := NewLogger(dir)
+	defer lg.Close()
+
+	const numEntries = 100000
+	file := writeCountFixture(b, lg, numEntries, nil)
+	b.SetBytes(file.SizeBytes)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		n, err := count(lg, file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n != numEntries {
+			b.Fatalf("expected %d entries; got %d", numEntries, n)
+		}
+	}
+}
+
+func BenchmarkCountEntries(b *testing.B) {
+	benchmarkCount(b, func(lg *Logger, file FileInfo) (int, error) {
+		return lg.CountEntries(file, InfoLevel, 0, math.MaxInt64)
+	})
+}
+
+// BenchmarkCountEntriesByDecoding counts by fully decoding the entries,
+// for comparison with BenchmarkCountEntries.
+func BenchmarkCountEntriesByDecoding(b *testing.B) {
+	benchmarkCount(b, func(lg *Logger, file FileInfo) (int, error) {
+		rc, err := lg.GetLogReader(file.Name, false)
+		if err != nil {
+			return 0, err
+		}
+		defer rc.Close()
+		d := NewEntryDecoder(bufio.NewReader(rc))
+		var n int
+		for {
+			var entry proto.LogEntry
+			if err := d.Decode(&entry); err != nil {
+				if err == io.EOF {
+					return n, nil
+				}
+				return 0, err
+			}
+			n++
+		}
+	})
+}
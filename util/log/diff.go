@@ -0,0 +1,118 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// A DiffEntry describes log entries which occur a different number of
+// times in the two files passed to DiffFiles.
+type DiffEntry struct {
+	File    string
+	Line    int32
+	Message string
+	// CountA and CountB are the number of occurrences in each file.
+	CountA, CountB int
+}
+
+// diffKey is the key by which DiffFiles matches entries: their location
+// and formatted message. Timestamps, thread IDs and severities are not
+// part of it.
+type diffKey struct {
+	file    string
+	line    int32
+	message string
+}
+
+// DiffFiles compares two log files entry by entry, matching entries by
+// file, line and formatted message while ignoring their timestamps, and
+// returns the entries which occur more often in one file than in the
+// other, sorted by file, line and message. The files are streamed, so
+// memory is bounded by the number of distinct keys and not by the size
+// of the files. The file names are interpreted as by GetLogReader, with
+// absolute paths allowed.
+func DiffFiles(a, b string) ([]DiffEntry, error) {
+	return defaultLogger.DiffFiles(a, b)
+}
+
+// DiffFiles compares two log files as described by the package-level
+// DiffFiles, resolving relative file names in the Logger's directories.
+func (lg *Logger) DiffFiles(a, b string) ([]DiffEntry, error) {
+	counts := map[diffKey][2]int{}
+	for i, name := range []string{a, b} {
+		if err := lg.countEntries(name, func(key diffKey) {
+			c := counts[key]
+			c[i]++
+			counts[key] = c
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var diffs []DiffEntry
+	for key, c := range counts {
+		if c[0] != c[1] {
+			diffs = append(diffs, DiffEntry{
+				File:    key.file,
+				Line:    key.line,
+				Message: key.message,
+				CountA:  c[0],
+				CountB:  c[1],
+			})
+		}
+	}
+	sort.Sort(diffEntries(diffs))
+	return diffs, nil
+}
+
+// countEntries calls add with the key of every entry in the file.
+func (lg *Logger) countEntries(name string, add func(diffKey)) error {
+	reader, err := lg.GetLogReader(name, true /* allowAbsolute */)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	decoder := NewEntryDecoder(reader)
+	for {
+		var entry proto.LogEntry
+		if err := decoder.Decode(&entry); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		add(diffKey{file: entry.File, line: entry.Line, message: formatMessage(&entry)})
+	}
+}
+
+// diffEntries sorts DiffEntries by file, line and message.
+type diffEntries []DiffEntry
+
+func (d diffEntries) Len() int      { return len(d) }
+func (d diffEntries) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d diffEntries) Less(i, j int) bool {
+	if d[i].File != d[j].File {
+		return d[i].File < d[j].File
+	}
+	if d[i].Line != d[j].Line {
+		return d[i].Line < d[j].Line
+	}
+	return d[i].Message < d[j].Message
+}
@@ -0,0 +1,63 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffFiles(t *testing.T) {
+	var names []string
+	for _, counts := range []map[string]int{
+		{"common": 2, "dropped": 1},
+		{"common": 2, "added": 2},
+	} {
+		lg, cleanup := newTestLogger(t)
+		defer cleanup()
+		for _, msg := range []string{"common", "dropped", "added"} {
+			for i := 0; i < counts[msg]; i++ {
+				// All entries are logged from the same line, so that they
+				// only differ by message.
+				lg.Infoc(nil, msg)
+			}
+		}
+		lg.Flush()
+		name, err := lg.ActiveLogFile(InfoLevel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	diffs, err := DiffFiles(names[0], names[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diffs {
+		if d.File != "diff_test.go" {
+			t.Errorf("unexpected location of %+v", d)
+		}
+		got = append(got, d.Message)
+		if exp := map[string][2]int{"added": {0, 2}, "dropped": {1, 0}}[d.Message]; [2]int{d.CountA, d.CountB} != exp {
+			t.Errorf("%s: expected counts %v; got %+v", d.Message, exp, d)
+		}
+	}
+	if exp := []string{"added", "dropped"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %s; got %s", exp, got)
+	}
+}
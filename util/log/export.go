@@ -0,0 +1,159 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// An EntryEncoder writes log entries to a writer in some format.
+type EntryEncoder interface {
+	EncodeEntry(w io.Writer, entry *proto.LogEntry) error
+}
+
+// The formats entries can be exported in.
+var (
+	// ProtoEncoding writes entries length-prefixed, as in log files, so
+	// that they can be read back with an EntryDecoder.
+	ProtoEncoding EntryEncoder = protoEncoding{}
+	// JSONEncoding writes entries as newline-delimited JSON objects, as
+	// JSONEntryEncoder does.
+	JSONEncoding EntryEncoder = jsonEncoding{}
+	// TextEncoding writes entries as they're written to stderr.
+	TextEncoding EntryEncoder = textEncoding{}
+)
+
+type protoEncoding struct{}
+
+func (protoEncoding) EncodeEntry(w io.Writer, entry *proto.LogEntry) error {
+	return writeFull(w, encodeLogEntry(entry))
+}
+
+type jsonEncoding struct{}
+
+func (jsonEncoding) EncodeEntry(w io.Writer, entry *proto.LogEntry) error {
+	data, err := json.Marshal(makeJSONEntry(entry, false /* !unixNanos */))
+	if err != nil {
+		return err
+	}
+	return writeFull(w, append(data, '\n'))
+}
+
+type textEncoding struct{}
+
+func (textEncoding) EncodeEntry(w io.Writer, entry *proto.LogEntry) error {
+	return writeFull(w, formatLogEntry(entry, nil))
+}
+
+// writeFull writes data to w, turning a short write which w doesn't
+// report into io.ErrShortWrite.
+func writeFull(w io.Writer, data []byte) error {
+	n, err := w.Write(data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+	return err
+}
+
+// ExportEntries writes the log entries on disk of the given level of
+// severity (or worse) whose times lie between startTimestamp and
+// endTimestamp, inclusive, in unix nanos, to w using enc. See
+// Logger.ExportEntries.
+func ExportEntries(w io.Writer, level Level, startTimestamp, endTimestamp int64, enc EntryEncoder) error {
+	return defaultLogger.ExportEntries(w, level, startTimestamp, endTimestamp, enc)
+}
+
+// ExportEntries writes the Logger's entries selected as by
+// FetchEntriesFromFiles to w using enc, in increasing time order, for
+// instance to bundle a window of the logs into a single file. Unlike a
+// fetch, it isn't subject to EntriesCutoff and holds the entries of only
+// one file per level at a time, along with what identifies the entries
+// already written, which are skipped in the files of other levels. The
+// first error returned by w ends the export.
+func (lg *Logger) ExportEntries(w io.Writer, level Level, startTimestamp, endTimestamp int64, enc EntryEncoder) error {
+	logFiles, err := lg.ListLogFiles()
+	if err != nil {
+		return err
+	}
+	// The files of each level are merged, oldest first.
+	var streams []*exportStream
+	byLevel := map[Level]*exportStream{}
+	files := selectFiles(logFiles, level, endTimestamp)
+	for i := len(files) - 1; i >= 0; i-- {
+		s, ok := byLevel[files[i].Details.Level]
+		if !ok {
+			s = &exportStream{lg: lg, start: startTimestamp, end: endTimestamp}
+			byLevel[files[i].Details.Level] = s
+			streams = append(streams, s)
+		}
+		s.files = append(s.files, files[i])
+	}
+	seen := map[entryKey]bool{}
+	for {
+		var next *exportStream
+		for _, s := range streams {
+			if err := s.fill(); err != nil {
+				return err
+			}
+			if len(s.entries) > 0 && (next == nil || s.entries[0].Time < next.entries[0].Time) {
+				next = s
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		entry := &next.entries[0]
+		next.entries = next.entries[1:]
+		key := entryKey{entry.Time, entry.Severity, entry.File, entry.Line, entry.Format}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if err := enc.EncodeEntry(w, entry); err != nil {
+			return err
+		}
+	}
+}
+
+// An exportStream yields the entries of the files of one level in
+// increasing time order, reading one file at a time.
+type exportStream struct {
+	lg         *Logger
+	start, end int64
+	files      []FileInfo       // the files not read yet, oldest first
+	entries    []proto.LogEntry // the entries of the file read last not yet exported
+}
+
+// fill reads the next file with matching entries if the entries of the
+// previous one are exhausted.
+func (s *exportStream) fill() error {
+	for len(s.entries) == 0 && len(s.files) > 0 {
+		entries, _, err := s.lg.readAllEntriesFromFile(s.files[0], s.start, s.end, 0, fetchOptions{})
+		if err != nil {
+			return err
+		}
+		s.files = s.files[1:]
+		// Entries are read newest first.
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+		s.entries = entries
+	}
+	return nil
+}
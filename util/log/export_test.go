@@ -0,0 +1,132 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func TestExportEntries(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Infoc(nil, "one")
+	lg.Warningc(nil, "two")
+	lg.Errorc(nil, "three")
+	lg.Infoc(nil, "four")
+	lg.Flush()
+
+	var buf bytes.Buffer
+	if err := lg.ExportEntries(&buf, InfoLevel, 0, math.MaxInt64, ProtoEncoding); err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	d := NewEntryDecoder(&buf)
+	for {
+		var entry proto.LogEntry
+		if err := d.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if msg := formatMessage(&entry); !strings.HasPrefix(msg, "Running on machine") &&
+			!strings.HasPrefix(msg, "Binary:") {
+			msgs = append(msgs, msg)
+		}
+	}
+	if exp := "one two three four"; strings.Join(msgs, " ") != exp {
+		t.Errorf("expected %q; got %q", exp, msgs)
+	}
+
+	buf.Reset()
+	if err := lg.ExportEntries(&buf, WarningLevel, 0, math.MaxInt64, JSONEncoding); err != nil {
+		t.Fatal(err)
+	}
+	var jsonMsgs []string
+	jd := NewJSONEntryDecoder(&buf)
+	for {
+		var entry proto.LogEntry
+		if err := jd.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if msg := formatMessage(&entry); msg == "two" || msg == "three" {
+			jsonMsgs = append(jsonMsgs, msg)
+		}
+	}
+	if exp := "two three"; strings.Join(jsonMsgs, " ") != exp {
+		t.Errorf("expected %q; got %q", exp, jsonMsgs)
+	}
+
+	buf.Reset()
+	if err := lg.ExportEntries(&buf, ErrorLevel, 0, math.MaxInt64, TextEncoding); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "\nE") || !strings.Contains(out, "] three\n") ||
+		strings.Contains(out, "two") {
+		t.Errorf("unexpected text export %q", out)
+	}
+}
+
+// failingWriter accepts n bytes, then fails or, if short is set, writes
+// less than it's given without reporting an error.
+type failingWriter struct {
+	n     int
+	short bool
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.n {
+		w.n -= len(p)
+		return len(p), nil
+	}
+	n := w.n
+	w.n = 0
+	if w.short {
+		return n, nil
+	}
+	return n, errWriteFailed
+}
+
+func TestExportEntriesWriteErrors(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	for i := 0; i < 10; i++ {
+		lg.Infoc(nil, "entry %d", i)
+	}
+	lg.Flush()
+
+	for _, tc := range []struct {
+		w   io.Writer
+		exp error
+	}{
+		{&failingWriter{n: 100}, errWriteFailed},
+		{&failingWriter{n: 100, short: true}, io.ErrShortWrite},
+	} {
+		if err := lg.ExportEntries(tc.w, InfoLevel, 0, math.MaxInt64, TextEncoding); err != tc.exp {
+			t.Errorf("expected %v; got %v", tc.exp, err)
+		}
+	}
+}
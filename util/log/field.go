@@ -29,5 +29,6 @@ const (
 	Method                // the method being executed
 	Client                // TODO: client on whose behalf we're acting
 	Key                   // a proto.Key related to an event.
+	TraceID               // the trace or correlation ID of an operation
 	maxField              // internal field bounding the range of allocated fields
 )
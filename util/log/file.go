@@ -19,39 +19,438 @@
 package log
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"net"
 	"os"
 	"os/user"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/cockroachdb/cockroach/proto"
 	"github.com/cockroachdb/cockroach/util"
+	gogoproto "github.com/gogo/protobuf/proto"
+	"golang.org/x/net/context"
 )
 
-// MaxSize is the maximum size of a log file in bytes.
+// MaxSize is the maximum size of a log file in bytes. It applies to
+// every Logger which doesn't set its own MaxSize. Prefer SetMaxSize,
+// which validates the size, to writing to it directly.
 var MaxSize uint64 = 1024 * 1024 * 1800
 
+// MinMaxSize is the smallest value accepted by SetMaxSize. Smaller files
+// would make the logger rotate on almost every line and exhaust inodes.
+const MinMaxSize uint64 = 1024 * 1024
+
+// SetMaxSize sets MaxSize, the maximum size of a log file in bytes for
+// every Logger which doesn't set its own. Sizes below MinMaxSize are
+// rejected.
+func SetMaxSize(bytes uint64) error {
+	if err := validateMaxSize(bytes); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&MaxSize, bytes)
+	return nil
+}
+
+// SetMaxSize sets the Logger's MaxSize. Sizes below MinMaxSize are
+// rejected.
+func (lg *Logger) SetMaxSize(bytes uint64) error {
+	if err := validateMaxSize(bytes); err != nil {
+		return err
+	}
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	lg.MaxSize = bytes
+	return nil
+}
+
+// validateMaxSize returns an error if the size is below MinMaxSize.
+func validateMaxSize(bytes uint64) error {
+	if bytes < MinMaxSize {
+		return util.Errorf("log file size %d is below the minimum of %d bytes", bytes, MinMaxSize)
+	}
+	return nil
+}
+
 // If non-empty, overrides the choice of directory in which to write logs.
 // See createLogDirs for the full list of possible destinations.
 var logDir *string
 
-// logDirs lists the candidate directories for new log files.
-var logDirs []string
+// logFileRE matches log files to avoid exposing non-log files accidentally
+// and it splits the details of the filename into groups for easy parsing.
+// The log file format is
+// {program}.{host}.{username}.log.{severity}.{timestamp}.{pid}-{runid},
+// see logName. Periods are escaped in all components but the program name.
+// Files written before run IDs were introduced lack the "-{runid}" suffix.
+// Files whose name was taken when they were created carry an additional
+// ".{seq}" suffix, see Logger.UniqueFiles. The timestamp is matched
+// loosely, so that names written with any FilenameTimeFormat, or copied
+// from hosts that name files with RFC 3339 timestamps, are recognized;
+// see parseLogFileTime.
+var logFileRE = regexp.MustCompile(`^(.+)\.([^\.]*)\.([^\.]*)\.log\.(INFO|WARNING|ERROR)\.(\d[0-9TZ:_+-]*)\.(\d+)(?:-([0-9a-z]+))?(?:\.(\d+))?$`)
+
+// LogFilePattern returns the regular expression log file names match, so
+// that tools can filter directory listings before parsing the names with
+// ParseLogFilename. Compressed files carry a suffix, such as ".gz", which
+// must be removed first. The pattern is shared, and safe for concurrent
+// use, so callers must not modify it with Longest.
+func LogFilePattern() *regexp.Regexp {
+	return logFileRE
+}
+
+// logFileTimeFormat is the default layout of the timestamp component of
+// log file names.
+const logFileTimeFormat = "20060102-150405"
+
+// FilenameTimeFormat is the layout, as understood by time.Format, of the
+// timestamp component of the names of new log files. Names written with
+// the default layout, which sorts lexicographically, or with RFC 3339
+// timestamps, are parsed whatever the layout, so it can be changed
+// without losing track of older files. The layout must only produce
+// digits, the letters T and Z and the characters ":_+-", and must not
+// omit the seconds, as rotations are told apart by second.
+var FilenameTimeFormat = logFileTimeFormat
+
+// parseLogFileTime parses the timestamp component of a log file name,
+// in FilenameTimeFormat, in logFileTimeFormat or as an RFC 3339 timestamp
+// whose colons may be escaped as underscores. Timestamps without a zone
+// are local.
+func parseLogFileTime(s string) (time.Time, error) {
+	if FilenameTimeFormat != logFileTimeFormat {
+		if t, err := time.ParseInLocation(FilenameTimeFormat, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if !strings.Contains(s, "T") {
+		return time.ParseInLocation(logFileTimeFormat, s, time.Local)
+	}
+	s = strings.Replace(s, "_", ":", -1)
+	if len(s) == len("2006-01-02T15:04:05") {
+		return time.ParseInLocation("2006-01-02T15:04:05", s, time.Local)
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// A Logger writes log files to its own set of directories, with its own
+// rotation settings. Several Loggers can coexist in one process, which
+// lets embedders keep the logs of independent services apart. The
+// package-level functions operate on a default Logger whose directory is
+// set by the --log-dir flag.
+type Logger struct {
+	// MaxSize is the maximum size of a log file in bytes. If zero, the
+	// package-level MaxSize is used.
+	MaxSize uint64
+	// MaxAge is the maximum time a log file is written to. A file is
+	// rotated once it's older or larger than MaxSize, whichever comes
+	// first, so that e.g. each day gets files of its own. If zero, files
+	// are rotated by size only.
+	MaxAge time.Duration
+	// BufferSize is the size in bytes of the buffer each file is written
+	// through. If zero, a buffer of 256KB is used.
+	BufferSize int
+	// FlushInterval, if positive, makes the Logger flush its files that
+	// often, rather than only along with all Loggers every 30 seconds,
+	// bounding how many entries a crash can lose. FATAL entries are always
+	// flushed right away.
+	FlushInterval time.Duration
+	// LinkIncludesHost and LinkSuffix make the Logger insert the host name
+	// and the suffix into the names of its symlinks and pointer files,
+	// e.g. "<program>.<host>.<suffix>.<LEVEL>", so that programs of the
+	// same name sharing a log directory don't clobber each other's links.
+	LinkIncludesHost bool
+	LinkSuffix       string
+	// LegacyLinks makes the Logger also maintain the "<program>.<LEVEL>"
+	// links when LinkIncludesHost or LinkSuffix is set, for tools which
+	// expect those.
+	LegacyLinks bool
+	// UsePointerFiles makes the Logger record the name of the newest file
+	// of each level in a "<program>.<LEVEL>.active" pointer file rather
+	// than in a "<program>.<LEVEL>" symlink. Pointer files work on
+	// platforms without symlinks and survive copies which don't preserve
+	// links. Without it, where a symlink can't be created, as on Windows
+	// for users without the privilege to, "<program>.<LEVEL>" is written
+	// as a pointer file instead.
+	UsePointerFiles bool
+	// IndexCategories makes the Logger record, next to each file, which
+	// message categories (see FetchByCategory) occur in the file and in
+	// which byte range, so that fetches by category can skip the rest.
+	IndexCategories bool
+	// UniqueFiles makes the Logger create a file of its own on every
+	// rotation. By default, a rotation within the same second as the
+	// previous one appends to the file of that name; with UniqueFiles, a
+	// ".{seq}" suffix is added to the name instead.
+	UniqueFiles bool
+	// WriteHeaderLine makes the Logger start each new file with a line of
+	// text describing the file, so that tools unaware of the naming of
+	// the files can recognize them. Readers in this package skip it.
+	WriteHeaderLine bool
+	// ChecksumFiles makes the Logger end each file it closes cleanly, on
+	// rotation or Close, with a footer holding a checksum of the file, see
+	// VerifyChecksum. Readers in this package skip the footer; older ones
+	// can't read such files.
+	ChecksumFiles bool
+	// Layout determines where below the log directories log files are
+	// kept. If nil, FlatLayout is used.
+	Layout DirLayout
+	// MaxRotationsPerMinute caps how many files the Logger starts by
+	// rotation in any one minute. Once the cap is reached, entries are
+	// appended to the current files past MaxSize until the rate drops, so
+	// that a runaway logger can't exhaust the inodes of the log volume. If
+	// zero, rotations are not limited.
+	MaxRotationsPerMinute int
+	// CombinedFile makes the Logger write a single file, of the level
+	// CombinedThreshold, holding the entries at or above the threshold,
+	// instead of a file per level. Entries below the threshold are only
+	// passed to the sinks. Each entry records its own severity, so the
+	// file reads like the file of that level in the per-level mode.
+	CombinedFile bool
+	// CombinedThreshold is the lowest level written with CombinedFile.
+	CombinedThreshold Level
+	// Redact, if set, is applied to each entry fetched from the Logger's
+	// files before it's returned, e.g. to mask personal data; see
+	// RedactEmails. The files themselves are left unchanged.
+	Redact RedactFunc
+
+	// rotations holds the times of the rotations of the last minute. It
+	// is protected by mu.
+	rotations []time.Time
+
+	// sinks are the sinks the entries written to the files are mirrored
+	// to, see AddSink. It is protected by mu.
+	sinks []*bufferedSink
 
-// logFileRE matches log files to avoid exposing non-log files accidentally.
-var logFileRE = regexp.MustCompile(`log\.(INFO|WARNING|ERROR)\.`)
+	// rotationCallbacks are called with the files rotated out, see
+	// RegisterRotationCallback, by the rotation worker, if it's running.
+	// They are protected by mu.
+	rotationCallbacks []func(oldFile string)
+	rotationWorker    *rotationWorker
+
+	// stopFlushing, if set, stops the goroutine flushing the files every
+	// FlushInterval. It is protected by mu.
+	stopFlushing chan struct{}
+
+	// scanMu protects decodeErrors, the decode errors found by the most
+	// recent fetch.
+	scanMu       sync.Mutex
+	decodeErrors []FileDecodeErrors
+
+	// dirsMu protects dirs, the candidate directories for new log files.
+	dirsMu sync.Mutex
+	dirs   []string
+
+	// fs is the fileSystem the files are created, listed and read on; if
+	// nil, the operating system's is used.
+	fs fileSystem
+
+	// mu protects the files and is held while writing to them.
+	mu sync.Mutex
+	// file holds writer for each of the log types.
+	file [numSeverity]flushSyncWriter
+}
+
+// defaultLogger is the Logger used by the package-level functions.
+var defaultLogger = &Logger{}
+
+// NewLogger returns a new Logger writing to the specified directories.
+// The Logger is flushed periodically along with all others until it is
+// closed.
+func NewLogger(dirs ...string) *Logger {
+	lg := &Logger{dirs: dirs}
+	loggers.Lock()
+	loggers.all = append(loggers.all, lg)
+	loggers.Unlock()
+	return lg
+}
+
+// loggers holds all Loggers in use, so that Flush and the flush daemon
+// reach every one of them.
+var loggers = struct {
+	sync.Mutex
+	all []*Logger
+}{all: []*Logger{defaultLogger}}
+
+// onceLogDirs resolves the directories of the default Logger. It's reset
+// by SetLogDir and protected by the dirsMu of the default Logger.
+var onceLogDirs sync.Once
 
 func createLogDirs() {
-	if *logDir != "" {
-		logDirs = append(logDirs, *logDir)
+	defaultLogger.dirs = splitLogDirs(*logDir)
+}
+
+// SetLogDir sets the directories the default Logger writes to, as a
+// comma-separated list like the --log-dir flag takes, for programs which
+// don't parse the flags. The files being written are closed, so that
+// files are created anew in the new directories.
+func SetLogDir(dir string) {
+	defaultLogger.dirsMu.Lock()
+	*logDir = dir
+	onceLogDirs = sync.Once{}
+	defaultLogger.dirsMu.Unlock()
+
+	defaultLogger.mu.Lock()
+	defer defaultLogger.mu.Unlock()
+	_ = defaultLogger.closeFiles() // ignore err
+}
+
+// splitLogDirs splits a comma-separated list of log directories, as
+// accepted by the --log-dir flag.
+func splitLogDirs(s string) []string {
+	var dirs []string
+	for _, dir := range strings.Split(s, ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// ValidateLogDir verifies that log files can be written to dir. See
+// Logger.ValidateLogDir.
+func ValidateLogDir(dir string) error {
+	return defaultLogger.ValidateLogDir(dir)
+}
+
+// ValidateLogDir verifies that log files can be written to dir, creating
+// it if needed, by writing and removing a probe file, so that a server can
+// fail fast at startup with a clear message rather than on the first log
+// file it creates. The error returned wraps that of the failed operation.
+func (lg *Logger) ValidateLogDir(dir string) error {
+	fs := lg.fileSystem()
+	if err := fs.MkdirAll(dir, 0755); err != nil {
+		return &logDirError{dir, err}
+	}
+	if info, err := fs.Stat(dir); err != nil {
+		return &logDirError{dir, err}
+	} else if !info.IsDir() {
+		return &logDirError{dir, &os.PathError{Op: "stat", Path: dir, Err: syscall.ENOTDIR}}
+	}
+	probe := filepath.Join(dir, tempName(program+".probe"))
+	f, err := fs.OpenFile(probe, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return &logDirError{dir, err}
+	}
+	_, err = f.Write([]byte("probe"))
+	if cErr := f.Close(); err == nil {
+		err = cErr
 	}
+	if rErr := fs.Remove(probe); err == nil {
+		err = rErr
+	}
+	if err != nil {
+		return &logDirError{dir, err}
+	}
+	return nil
+}
+
+// A logDirError is an error of ValidateLogDir.
+type logDirError struct {
+	dir string
+	err error
+}
+
+func (e *logDirError) Error() string {
+	return fmt.Sprintf("log dir %s is unusable: %s", e.dir, e.err)
+}
+
+// Unwrap returns the error of the failed operation.
+func (e *logDirError) Unwrap() error { return e.err }
+
+// logDirs returns a copy of the candidate directories for new log files,
+// in order of preference. The directories of the default Logger are
+// resolved from the --log-dir flag on first use.
+func (lg *Logger) logDirs() []string {
+	lg.dirsMu.Lock()
+	defer lg.dirsMu.Unlock()
+	if lg == defaultLogger {
+		onceLogDirs.Do(createLogDirs)
+	}
+	return append([]string(nil), lg.dirs...)
+}
+
+// setLogDirs replaces the candidate directories for new log files.
+func (lg *Logger) setLogDirs(dirs []string) {
+	lg.dirsMu.Lock()
+	defer lg.dirsMu.Unlock()
+	lg.dirs = dirs
+}
+
+// layout returns the DirLayout of the Logger.
+func (lg *Logger) layout() DirLayout {
+	if lg.Layout == nil {
+		return FlatLayout{}
+	}
+	return lg.Layout
+}
+
+// searchDirs returns all directories which may contain the Logger's log
+// files according to its layout.
+func (lg *Logger) searchDirs() []string {
+	var dirs []string
+	subdirs := lg.layout().Subdirs()
+	for _, dir := range lg.logDirs() {
+		for _, subdir := range subdirs {
+			dirs = append(dirs, filepath.Join(dir, subdir))
+		}
+	}
+	return dirs
+}
+
+// maxSize returns the maximum size of the Logger's files in bytes.
+func (lg *Logger) maxSize() uint64 {
+	if lg.MaxSize != 0 {
+		return lg.MaxSize
+	}
+	return atomic.LoadUint64(&MaxSize)
+}
+
+// allowRotation reports whether a file may be rotated at the given time
+// without exceeding MaxRotationsPerMinute, and if so, records the
+// rotation. lg.mu is held.
+func (lg *Logger) allowRotation(now time.Time) bool {
+	lg.pruneRotations(now)
+	if lg.MaxRotationsPerMinute > 0 && len(lg.rotations) >= lg.MaxRotationsPerMinute {
+		return false
+	}
+	lg.rotations = append(lg.rotations, now)
+	return true
+}
+
+// pruneRotations forgets the rotations which happened more than a minute
+// before now. lg.mu is held.
+func (lg *Logger) pruneRotations(now time.Time) {
+	i := 0
+	for i < len(lg.rotations) && now.Sub(lg.rotations[i]) >= time.Minute {
+		i++
+	}
+	lg.rotations = lg.rotations[i:]
+}
+
+// RotationRate returns the number of files the default Logger started by
+// rotation during the last minute.
+func RotationRate() int {
+	return defaultLogger.RotationRate()
+}
+
+// RotationRate returns the number of files the Logger started by rotation
+// during the last minute.
+func (lg *Logger) RotationRate() int {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	lg.pruneRotations(timeNow())
+	return len(lg.rotations)
 }
 
 var (
@@ -59,6 +458,11 @@ var (
 	program  = filepath.Base(os.Args[0])
 	host     = "unknownhost"
 	userName = "unknownuser"
+
+	// runID tells apart processes which were assigned the same PID, which
+	// happens to long-running nodes once PIDs wrap around. It encodes the
+	// time the process started.
+	runID = strconv.FormatInt(time.Now().UnixNano(), 36)
 )
 
 func init() {
@@ -77,8 +481,15 @@ func init() {
 }
 
 // shortHostname returns its argument, truncating at the first period.
-// For instance, given "www.google.com" it returns "www".
+// For instance, given "www.google.com" it returns "www". IP addresses
+// are returned whole, as truncating them would leave a meaningless
+// prefix; the colons of IPv6 addresses, which aren't allowed in file
+// names on some platforms, are replaced by dashes, so that "fe80::1"
+// becomes "fe80--1". Periods are escaped later on, like in any host name.
 func shortHostname(hostname string) string {
+	if ip := net.ParseIP(strings.Trim(hostname, "[]")); ip != nil {
+		return strings.Replace(ip.String(), ":", "-", -1)
+	}
 	if i := strings.Index(hostname, "."); i >= 0 {
 		return hostname[:i]
 	}
@@ -88,104 +499,648 @@ func shortHostname(hostname string) string {
 // logName returns a new log file name containing tag, with start time t, and
 // the name for the symlink for tag.
 func logName(tag string, t time.Time) (name, link string) {
-	name = fmt.Sprintf("%s.%s.%s.log.%s.%04d%02d%02d-%02d%02d%02d.%d",
+	name = fmt.Sprintf("%s.%s.%s.log.%s.%s.%d-%s",
 		program,
-		host,
-		userName,
+		escapePeriods(host),
+		escapePeriods(userName),
 		tag,
-		t.Year(),
-		t.Month(),
-		t.Day(),
-		t.Hour(),
-		t.Minute(),
-		t.Second(),
-		pid)
+		t.Format(FilenameTimeFormat),
+		pid,
+		runID)
 	return name, program + "." + tag
 }
 
-var onceLogDirs sync.Once
+// linkNames returns the names of the symlinks to the newest file of the
+// level named tag: "<program>.<LEVEL>", with the host and LinkSuffix
+// inserted before the level if the Logger is configured to, and then the
+// old-style name if LegacyLinks is set.
+func (lg *Logger) linkNames(tag string) []string {
+	_, legacy := logName(tag, time.Time{})
+	link := program
+	if lg.LinkIncludesHost {
+		link += "." + escapePeriods(host)
+	}
+	if lg.LinkSuffix != "" {
+		link += "." + escapePeriods(lg.LinkSuffix)
+	}
+	link += "." + tag
+	if lg.LegacyLinks && link != legacy {
+		return []string{link, legacy}
+	}
+	return []string{link}
+}
+
+// pointerFileSuffix is appended to the symlink name of a level to name its
+// pointer file.
+const pointerFileSuffix = ".active"
+
+// escapePeriods replaces the periods in a log file name component, which
+// would otherwise make the name ambiguous to parse.
+func escapePeriods(s string) string {
+	return strings.Replace(s, ".", "_", -1)
+}
 
 // create creates a new log file and returns the file and its filename, which
 // contains tag ("INFO", "FATAL", etc.) and t.  If the file is created
 // successfully, create also attempts to update the symlink for that tag, ignoring
 // errors.
-func create(tag string, t time.Time) (f *os.File, filename string, err error) {
-	onceLogDirs.Do(createLogDirs)
-	if len(logDirs) == 0 {
+func (lg *Logger) create(tag string, t time.Time, header []byte) (f fsFile, filename string, err error) {
+	fs := lg.fileSystem()
+	dirs := lg.logDirs()
+	if len(dirs) == 0 {
 		return nil, "", errors.New("log: no log dirs")
 	}
-	name, link := logName(tag, t)
+	name, _ := logName(tag, t)
+	subdir := lg.layout().Subdir(t)
 	var lastErr error
-	for _, dir := range logDirs {
-		fname := filepath.Join(dir, name)
+	// The directories are tried in order, so that a full or unwritable
+	// directory falls back to the next one.
+	for _, dir := range dirs {
+		if subdir != "" {
+			if err := fs.MkdirAll(filepath.Join(dir, subdir), 0755); err != nil {
+				lastErr = err
+				continue
+			}
+		}
+		fname := filepath.Join(dir, subdir, name)
 
-		// Open the file os.O_APPEND|os.O_CREATE rather than use os.Create.
-		// Append is almost always more efficient than O_RDRW on most modern file systems.
-		f, err = os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0664)
+		preamble := lg.filePreamble(tag, t)
+		if lg.UniqueFiles {
+			f, fname, err = createUniqueLogFile(fs, fname, preamble, header)
+		} else {
+			f, err = openLogFile(fs, fname, preamble, header)
+		}
 		if err != nil {
-			return nil, "", fmt.Errorf("log: cannot create log: %v", err)
+			lastErr = err
+			continue
 		}
 
-		if err == nil {
-			symlink := filepath.Join(dir, link)
-			_ = os.Remove(symlink)        // ignore err
-			_ = os.Symlink(name, symlink) // ignore err
-			return f, fname, nil
+		target := filepath.Join(subdir, filepath.Base(fname))
+		for _, link := range lg.linkNames(tag) {
+			if lg.UsePointerFiles {
+				_ = writePointerFile(fs, filepath.Join(dir, link+pointerFileSuffix), target) // ignore err
+			} else if err := replaceSymlink(fs, filepath.Join(dir, link), target); err != nil {
+				// Where symlinks can't be created, as on Windows without the
+				// privilege to, the link is a pointer file instead.
+				_ = writePointerFile(fs, filepath.Join(dir, link), target) // ignore err
+			}
 		}
-		lastErr = err
+		return f, fname, nil
 	}
 	return nil, "", fmt.Errorf("log: cannot create log: %v", lastErr)
 }
 
+// tempSeq numbers the temporary files of the process.
+var tempSeq uint64
+
+// tempName returns a name for a temporary file to be renamed or linked to
+// name. The name is unique to the call, so that Loggers and processes
+// sharing a log directory can replace the same link concurrently without
+// removing or renaming each other's temporary files.
+func tempName(name string) string {
+	return fmt.Sprintf("%s.%d-%d.tmp", name, pid, atomic.AddUint64(&tempSeq, 1))
+}
+
+// newFileContents returns the initial contents of a new log file: the
+// preamble followed by the header.
+func newFileContents(preamble, header []byte) []byte {
+	return append(append([]byte(nil), preamble...), header...)
+}
+
+// openLogFile opens the log file fname for appending and writes the
+// header to it, preceded by the preamble if the file is new. A new file
+// is written under a temporary name and renamed into place once the
+// header is complete, so readers never observe a log file without its
+// header.
+func openLogFile(fs fileSystem, fname string, preamble, header []byte) (fsFile, error) {
+	if _, err := fs.Stat(fname); err != nil {
+		tmp := tempName(fname)
+		if err := writeFile(fs, tmp, newFileContents(preamble, header), 0664); err != nil {
+			fs.Remove(tmp)
+			return nil, err
+		}
+		if err := fs.Rename(tmp, fname); err != nil {
+			fs.Remove(tmp)
+			return nil, err
+		}
+		header = nil
+	}
+	// Several rotations within the same second share the file name, in
+	// which case the existing file is appended to.
+	//
+	// Open the file os.O_APPEND rather than use os.Create.
+	// Append is almost always more efficient than O_RDRW on most modern file systems.
+	f, err := fs.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0664)
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > 0 {
+		if _, err := f.Write(header); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// maxNameCollisions bounds the number of suffixes createUniqueLogFile
+// tries before giving up.
+const maxNameCollisions = 1000
+
+// createUniqueLogFile creates a new log file named fname, or fname with
+// the first free ".{seq}" suffix if that name is taken, writes the
+// preamble and the header to it and opens it for appending. It returns the file and its name.
+// Like openLogFile, it writes the header under a temporary name first;
+// the file is then hard-linked into place, which, like opening with
+// O_EXCL but unlike renaming, fails if the name is already taken.
+func createUniqueLogFile(fs fileSystem, fname string, preamble, header []byte) (fsFile, string, error) {
+	tmp := tempName(fname)
+	if err := writeFile(fs, tmp, newFileContents(preamble, header), 0664); err != nil {
+		fs.Remove(tmp)
+		return nil, "", err
+	}
+	defer fs.Remove(tmp)
+
+	name := fname
+	for seq := 1; ; seq++ {
+		err := fs.Link(tmp, name)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) || seq > maxNameCollisions {
+			return nil, "", err
+		}
+		name = fmt.Sprintf("%s.%d", fname, seq)
+	}
+	f, err := fs.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0664)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, name, nil
+}
+
+// replaceSymlink atomically points symlink at name. Removing and
+// recreating the symlink in place would leave a window in which readers
+// find no active file at all.
+func replaceSymlink(fs fileSystem, link, name string) error {
+	tmp := tempName(link)
+	if err := fs.Symlink(name, tmp); err != nil {
+		return err
+	}
+	if err := fs.Rename(tmp, link); err != nil {
+		fs.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// symlink creates symlinks; it's a variable so that tests can make it
+// fail as it does on platforms without symlinks.
+var symlink = os.Symlink
+
+// writePointerFile atomically replaces the contents of the pointer file
+// with the given log file name, so readers never see a partial name.
+func writePointerFile(fs fileSystem, pointer, name string) error {
+	return writeFileAtomically(fs, pointer, []byte(name+"\n"))
+}
+
+// writeFileAtomically replaces the contents of the file by writing them
+// under a temporary name first and renaming that into place.
+func writeFileAtomically(fs fileSystem, filename string, data []byte) error {
+	tmp := tempName(filename)
+	if err := writeFile(fs, tmp, data, 0664); err != nil {
+		fs.Remove(tmp)
+		return err
+	}
+	if err := fs.Rename(tmp, filename); err != nil {
+		fs.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// ActiveLogFile returns the path of the file currently written for the
+// given level, as recorded by the symlink or pointer file of the level.
+func ActiveLogFile(level Level) (string, error) {
+	return defaultLogger.ActiveLogFile(level)
+}
+
+// ActiveLogFile returns the path of the file the Logger currently writes
+// for the given level. Both symlinks and pointer files are understood;
+// the kind the Logger is configured to write is consulted first. If
+// neither leads to a log file, as when a link is stale, the newest file
+// of the level written by this program is returned.
+func (lg *Logger) ActiveLogFile(level Level) (string, error) {
+	// Only the Logger's own link is read: an old-style link may be another
+	// program's.
+	link := lg.linkNames(level.String())[0]
+	sources := []struct {
+		suffix string
+		read   func(fileSystem, string) (string, error)
+	}{
+		{"", readLink},
+		{pointerFileSuffix, readPointerFile},
+	}
+	if lg.UsePointerFiles {
+		sources[0], sources[1] = sources[1], sources[0]
+	}
+	for _, dir := range lg.logDirs() {
+		for _, src := range sources {
+			name, err := src.read(lg.fileSystem(), filepath.Join(dir, link+src.suffix))
+			if err != nil {
+				continue
+			}
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(dir, name)
+			}
+			if verifyFile(lg.fileSystem(), name) == nil {
+				return name, nil
+			}
+		}
+	}
+	return lg.newestLogFile(level)
+}
+
+// newestLogFile returns the path of the newest file of the given level
+// written by this program.
+func (lg *Logger) newestLogFile(level Level) (string, error) {
+	files, err := lg.ListLogFilesFiltered(FileFilter{Program: program, MinLevel: level})
+	if err != nil {
+		return "", err
+	}
+	var newest *FileInfo
+	for i := range files {
+		d := files[i].Details
+		if d.Level != level {
+			continue
+		}
+		if newest == nil || d.Time > newest.Details.Time ||
+			(d.Time == newest.Details.Time && d.Seq > newest.Details.Seq) {
+			newest = &files[i]
+		}
+	}
+	if newest != nil {
+		for _, dir := range lg.searchDirs() {
+			if name := filepath.Join(dir, newest.Name); verifyFile(lg.fileSystem(), name) == nil {
+				return name, nil
+			}
+		}
+	}
+	return "", util.Errorf("no active %s log file", level)
+}
+
+// readLink returns the log file name a level's symlink on fs points at,
+// or, if symlinks couldn't be created and it's a pointer file, stores.
+func readLink(fs fileSystem, link string) (string, error) {
+	name, err := fs.Readlink(link)
+	if err == nil {
+		return name, nil
+	}
+	if info, sErr := fs.Lstat(link); sErr == nil && info.Mode().IsRegular() {
+		return readPointerFile(fs, link)
+	}
+	return "", err
+}
+
+// readPointerFile returns the log file name stored in a pointer file on
+// fs.
+func readPointerFile(fs fileSystem, pointer string) (string, error) {
+	f, err := fs.Open(pointer)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 // verifyFileInfo verifies that the file specified by filename is a
-// regular file and filename matches the expected filename pattern.
-// Returns nil on success; otherwise error.
+// regular file and filename, less any compression suffix, matches the
+// expected filename pattern. Returns nil on success; otherwise error.
 func verifyFileInfo(info os.FileInfo) error {
 	if info.Mode()&os.ModeType != 0 {
 		return util.Errorf("not a regular file")
-	} else if !logFileRE.MatchString(info.Name()) {
+	} else if name, _ := splitCompressionSuffix(info.Name()); !logFileRE.MatchString(name) {
 		return util.Errorf("not a log file")
 	}
 	return nil
 }
 
-func verifyFile(filename string) error {
-	info, err := os.Stat(filename)
+func verifyFile(fs fileSystem, filename string) error {
+	info, err := fs.Stat(filename)
 	if err != nil {
 		return err
 	}
 	return verifyFileInfo(info)
 }
 
+// FileDetails contains the details of a log file, as encoded in its name.
+type FileDetails struct {
+	Program  string
+	Host     string
+	UserName string
+	Level    Level
+	Time     int64  // creation time in unix nanos, with second granularity
+	PID      int    // between 0 and maxPID, so that it fits an int everywhere
+	RunID    string // empty for files named before run IDs were introduced
+	Seq      int    // suffix added because the name was taken, or zero
+}
+
+// String describes the file as "program@host (user) LEVEL time pid", with
+// the time in UTC, for debugging.
+func (d FileDetails) String() string {
+	return fmt.Sprintf("%s@%s (%s) %s %s %d", d.Program, d.Host, d.UserName, d.Level,
+		time.Unix(0, d.Time).UTC().Format(time.RFC3339), d.PID)
+}
+
+// FormatLogFilename returns the name of the log file with the given
+// details, as the Logger would name it. It's the inverse of
+// ParseLogFilename for names whose time is in FilenameTimeFormat, so that
+// tools can construct the names of log files.
+func FormatLogFilename(d FileDetails) string {
+	name := fmt.Sprintf("%s.%s.%s.log.%s.%s.%d",
+		d.Program,
+		escapePeriods(d.Host),
+		escapePeriods(d.UserName),
+		d.Level,
+		time.Unix(0, d.Time).Format(FilenameTimeFormat),
+		d.PID)
+	if d.RunID != "" {
+		name += "-" + d.RunID
+	}
+	if d.Seq != 0 {
+		name += fmt.Sprintf(".%d", d.Seq)
+	}
+	return name
+}
+
+// maxPID is the largest PID parseLogFilename accepts: the largest value an
+// int holds on 32-bit platforms.
+const maxPID = math.MaxInt32
+
+// ParseLogFilename parses the details of a log file from its base name,
+// e.g. to route files by program, host or level. It returns an error for
+// names which aren't log file names. FormatLogFilename is its inverse.
+func ParseLogFilename(filename string) (FileDetails, error) {
+	return parseLogFilename(filename)
+}
+
+// parseLogFilename parses the details of a log file from its name.
+func parseLogFilename(filename string) (FileDetails, error) {
+	matches := logFileRE.FindStringSubmatch(filename)
+	if matches == nil {
+		return FileDetails{}, util.Errorf("not a log file: %s", filename)
+	}
+
+	level, ok := levelFromName(matches[4])
+	if !ok {
+		return FileDetails{}, util.Errorf("not a log file, could not parse severity: %s", filename)
+	}
+
+	t, err := parseLogFileTime(matches[5])
+	if err != nil {
+		return FileDetails{}, err
+	}
+
+	pid, err := strconv.ParseInt(matches[6], 10, 64)
+	if err != nil || pid > maxPID {
+		return FileDetails{}, util.Errorf("not a log file, PID %s out of range: %s", matches[6], filename)
+	}
+
+	var seq int64
+	if matches[8] != "" {
+		if seq, err = strconv.ParseInt(matches[8], 10, 0); err != nil {
+			return FileDetails{}, err
+		}
+	}
+
+	return FileDetails{
+		Program:  matches[1],
+		Host:     matches[2],
+		UserName: matches[3],
+		Level:    level,
+		Time:     t.UnixNano(),
+		PID:      int(pid),
+		RunID:    matches[7],
+		Seq:      int(seq),
+	}, nil
+}
+
 // A FileInfo holds the filename and size of a log file.
 type FileInfo struct {
 	Name         string // base name
 	SizeBytes    int64
 	ModTimeNanos int64 // most recent mode time in unix nanos
+	Details      FileDetails
 }
 
 // ListLogFiles returns a slice of FileInfo structs for each log file
 // on the local node, in any of the configured log directories.
 func ListLogFiles() ([]FileInfo, error) {
+	return defaultLogger.ListLogFiles()
+}
+
+// ListLogFiles returns a slice of FileInfo structs for each log file in
+// any of the Logger's directories, newest first.
+func (lg *Logger) ListLogFiles() ([]FileInfo, error) {
+	return lg.ListLogFilesFiltered(FileFilter{})
+}
+
+// A FileFilter selects log files by the details encoded in their names.
+// Zero fields match every file.
+type FileFilter struct {
+	Program  string
+	Host     string
+	UserName string
+	// MinLevel selects the files of this level or worse.
+	MinLevel Level
+}
+
+// matches returns whether the details of a file match the filter. Host
+// and user names are matched as escaped in file names.
+func (f FileFilter) matches(details FileDetails) bool {
+	return (f.Program == "" || f.Program == details.Program) &&
+		(f.Host == "" || escapePeriods(f.Host) == details.Host) &&
+		(f.UserName == "" || escapePeriods(f.UserName) == details.UserName) &&
+		LevelAtLeast(details.Level, f.MinLevel)
+}
+
+// ListLogFilesFiltered is like ListLogFiles, but only returns the files
+// matching the filter, e.g. those of one of several processes sharing the
+// log directory.
+func ListLogFilesFiltered(filter FileFilter) ([]FileInfo, error) {
+	return defaultLogger.ListLogFilesFiltered(filter)
+}
+
+// ListLogFilesFiltered returns a FileInfo for each log file matching the
+// filter in any of the Logger's directories, newest first and, among
+// files created in the same second, by name. Directories which can't be
+// read are skipped, and reported by a *ListError returned along with the
+// files of the others.
+func (lg *Logger) ListLogFilesFiltered(filter FileFilter) ([]FileInfo, error) {
 	var results []FileInfo
-	for _, dir := range logDirs {
-		infos, err := ioutil.ReadDir(dir)
-		if err != nil {
-			return results, err
-		}
-		for _, info := range infos {
-			if verifyFileInfo(info) == nil {
-				results = append(results, FileInfo{
-					Name:         info.Name(),
-					SizeBytes:    info.Size(),
-					ModTimeNanos: info.ModTime().UnixNano(),
-				})
+	var listErr *ListError
+	subdirs := lg.layout().Subdirs()
+	for _, dir := range lg.logDirs() {
+		for _, subdir := range subdirs {
+			infos, err := lg.fileSystem().ReadDir(filepath.Join(dir, subdir))
+			if err != nil {
+				if subdir != "" && os.IsNotExist(err) {
+					// Subdirectories are created when first written to.
+					continue
+				}
+				// The other directories are still listed, so that one bad
+				// directory doesn't hide the files of the healthy ones.
+				if listErr == nil {
+					listErr = &ListError{}
+				}
+				listErr.Errors = append(listErr.Errors, err)
+				continue
 			}
+			results = appendLogFiles(results, infos, filter)
 		}
 	}
+	sort.Sort(newestFirst(results))
+	if listErr != nil {
+		return results, listErr
+	}
 	return results, nil
 }
 
+// A ListError is returned along with the files found when some of the
+// log directories couldn't be read while listing log files.
+type ListError struct {
+	// Errors holds the error of each directory which couldn't be read.
+	Errors []error
+}
+
+func (e *ListError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("cannot read %d log dir(s): %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// ListLogFilesInRange returns the log files of the given level which may
+// hold entries within [startTimestamp, endTimestamp]. See
+// Logger.ListLogFilesInRange.
+func ListLogFilesInRange(level Level, startTimestamp, endTimestamp int64) ([]FileInfo, error) {
+	return defaultLogger.ListLogFilesInRange(level, startTimestamp, endTimestamp)
+}
+
+// ListLogFilesInRange returns the Logger's log files of the given level
+// which may hold entries within [startTimestamp, endTimestamp], without
+// reading them. The entries of a file are taken to span from the creation
+// time in its name to its modification time, as each entry is written
+// after it's timestamped. Files whose modification time predates their
+// creation time, as happens when they're copied without preserving it,
+// are taken to span up to the creation time of the next file of the same
+// process, or to now for the newest one, allowing for
+// ClockJumpTolerance.
+func (lg *Logger) ListLogFilesInRange(level Level, startTimestamp, endTimestamp int64) ([]FileInfo, error) {
+	logFiles, err := lg.ListLogFiles()
+	if err != nil {
+		return nil, err
+	}
+	now := timeNow().UnixNano()
+	// next holds the creation time of the file following the oldest one
+	// seen so far of each process; the files are listed newest first.
+	next := map[FileDetails]int64{}
+	var files []FileInfo
+	for _, file := range logFiles {
+		if file.Details.Level != level {
+			continue
+		}
+		key := file.Details
+		key.Time, key.Seq = 0, 0
+		upper, ok := next[key]
+		if !ok {
+			upper = now
+		}
+		next[key] = file.Details.Time
+
+		first, last := file.Details.Time, file.ModTimeNanos
+		if last < first {
+			if !wellAfterRange(first, endTimestamp) && !wellBeforeRange(upper, startTimestamp) {
+				files = append(files, file)
+			}
+		} else if first <= endTimestamp && last >= startTimestamp {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// appendLogFiles appends a FileInfo for each log file among the infos
+// which matches the filter.
+func appendLogFiles(results []FileInfo, infos []os.FileInfo, filter FileFilter) []FileInfo {
+	for _, info := range infos {
+		if verifyFileInfo(info) != nil {
+			continue
+		}
+		// Compressed, archived files are listed under their full names,
+		// which GetLogReader decompresses by.
+		name, _ := splitCompressionSuffix(info.Name())
+		details, err := parseLogFilename(name)
+		if err != nil || !filter.matches(details) {
+			continue
+		}
+		results = append(results, FileInfo{
+			Name:         info.Name(),
+			SizeBytes:    info.Size(),
+			ModTimeNanos: info.ModTime().UnixNano(),
+			Details:      details,
+		})
+	}
+	return results
+}
+
+// AllowedDirs, if not empty, restricts the absolute filenames accepted by
+// GetLogReader to files below one of the listed directories, even when
+// allowAbsolute is set. This confines tools opening arbitrary files to
+// known log locations.
+var AllowedDirs []string
+
+// inAllowedDirs returns whether the absolute filename lies below one of
+// AllowedDirs, or whether AllowedDirs is empty. Symlinks are resolved
+// so that they can't be used to escape the directories.
+func inAllowedDirs(filename string) bool {
+	if len(AllowedDirs) == 0 {
+		return true
+	}
+	for _, dir := range AllowedDirs {
+		if withinDir(dir, filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// withinDir returns whether the file lies below the directory once
+// symlinks are resolved.
+func withinDir(dir, filename string) bool {
+	resolved, err := filepath.EvalSymlinks(filename)
+	if err != nil {
+		return false
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, resolved)
+	return err == nil && !escapesDir(rel)
+}
+
+// escapesDir returns whether the relative path leads out of the directory
+// it's relative to.
+func escapesDir(rel string) bool {
+	rel = filepath.Clean(rel)
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // GetLogReader returns a reader for the specified filename. Any
 // external requests (say from the admin UI via HTTP) must specify
 // allowAbsolute as false to prevent leakage of non-log
@@ -193,31 +1148,813 @@ func ListLogFiles() ([]FileInfo, error) {
 // command, which provides human readable output from an arbitrary file,
 // and is intended to be run locally in a terminal.
 func GetLogReader(filename string, allowAbsolute bool) (io.ReadCloser, error) {
+	return defaultLogger.GetLogReader(filename, allowAbsolute)
+}
+
+// GetLogReader returns a reader for the specified filename, which is
+// looked up in the Logger's directories. A relative path with
+// directories, such as "archived/2015-06/<name>", is looked up below the
+// log dirs and rejected if it leads out of them. See the package-level
+// GetLogReader for the meaning of allowAbsolute.
+func (lg *Logger) GetLogReader(filename string, allowAbsolute bool) (io.ReadCloser, error) {
+	fs := lg.fileSystem()
 	if path.IsAbs(filename) {
 		if !allowAbsolute {
-			return nil, util.Errorf("absolute pathnames are forbidden: %s", filename)
+			return nil, readerErrorf(ErrForbiddenPath, "absolute pathnames are forbidden: %s", filename)
+		}
+		if !inAllowedDirs(filename) {
+			return nil, readerErrorf(ErrForbiddenPath, "pathname is outside of the allowed directories: %s", filename)
 		}
-		if verifyFile(filename) == nil {
-			return os.Open(filename)
+		if verifyFile(fs, filename) == nil {
+			return openLogFileReader(fs, filename)
 		}
 	}
-	// Verify there are no path separators in the a non-absolute pathname.
+	if path.IsAbs(filename) || escapesDir(filename) {
+		return nil, readerErrorf(ErrForbiddenPath, "pathname is outside of the log dirs: %s", filename)
+	}
+	if name, _ := splitCompressionSuffix(path.Base(filename)); !logFileRE.MatchString(name) {
+		return nil, readerErrorf(ErrNotLogFile, "filename is not a cockroach log file: %s", filename)
+	}
 	if path.Base(filename) != filename {
-		return nil, util.Errorf("pathnames must be basenames only: %s", filename)
+		// A path below the log dirs, such as that of an archived file, is
+		// confined to them, symlinks included.
+		for _, dir := range lg.logDirs() {
+			fname := filepath.Join(dir, filename)
+			if verifyFile(fs, fname) != nil || !withinDir(dir, fname) {
+				continue
+			}
+			return openLogFileReader(fs, fname)
+		}
+		return nil, readerErrorf(os.ErrNotExist, "log file %s not found in any log dir", filename)
+	}
+	for _, dir := range lg.searchDirs() {
+		fname := path.Join(dir, filename)
+		if verifyFile(fs, fname) != nil {
+			continue
+		}
+		return openLogFileReader(fs, fname)
+	}
+	return nil, readerErrorf(os.ErrNotExist, "log file %s not found in any log dir", filename)
+}
+
+// ErrForbiddenPath and ErrNotLogFile are the causes of the errors
+// returned by GetLogReader for names it refuses to open: names of files
+// outside of the log directories, and names of files which aren't log
+// files. Log files which don't exist are reported with os.ErrNotExist as
+// cause. Causes are matched with errors.Is.
+var (
+	ErrForbiddenPath = errors.New("forbidden log file path")
+	ErrNotLogFile    = errors.New("not a log file")
+)
+
+// A readerError is an error of GetLogReader, whose message describes the
+// error in full and whose cause is one of ErrForbiddenPath, ErrNotLogFile
+// and os.ErrNotExist.
+type readerError struct {
+	msg   string
+	cause error
+}
+
+func (e *readerError) Error() string { return e.msg }
+
+// Unwrap returns the cause of the error.
+func (e *readerError) Unwrap() error { return e.cause }
+
+// readerErrorf returns a readerError of the given cause.
+func readerErrorf(cause error, format string, args ...interface{}) error {
+	return &readerError{msg: fmt.Sprintf(format, args...), cause: cause}
+}
+
+// EntriesCutoff is the maximum number of entries returned by
+// FetchEntriesFromFiles. Zero or a negative value means no limit.
+var EntriesCutoff = 10000
+
+// ClockJumpTolerance is how far the times of log entries may jump back,
+// as when NTP steps the clock or a suspended machine resumes, without
+// entries being missed by the fetches. The fetches rely on the entries of
+// each file, and the files of each level, being in time order: they stop
+// reading a file at an entry after the end of the time range, and stop
+// reading older files once an entry before the start was read. An entry
+// logged after the clock jumped back by more than ClockJumpTolerance may
+// thus be missed. The larger it is, the more entries outside of the range
+// are read.
+var ClockJumpTolerance = time.Minute
+
+// wellBeforeRange returns whether t is before startTimestamp by more than
+// ClockJumpTolerance, so that, the clock notwithstanding, the entries
+// logged before the entry at t are before the range too.
+func wellBeforeRange(t, startTimestamp int64) bool {
+	return t < startTimestamp && startTimestamp-t > int64(ClockJumpTolerance)
+}
+
+// wellAfterRange returns whether t is after endTimestamp by more than
+// ClockJumpTolerance, so that the entries logged after the entry at t are
+// after the range too.
+func wellAfterRange(t, endTimestamp int64) bool {
+	return t > endTimestamp && t-endTimestamp > int64(ClockJumpTolerance)
+}
+
+// FetchEntriesFromFiles fetches all available log entries on disk that
+// are of the given level of severity (or worse) and whose times lie
+// between startTimestamp and endTimestamp, inclusive, in unix nanos.
+func FetchEntriesFromFiles(level Level, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	return defaultLogger.FetchEntriesFromFiles(level, startTimestamp, endTimestamp)
+}
+
+// FetchEntriesFromFilesContext is like FetchEntriesFromFiles, but returns
+// ctx.Err() as soon as ctx is done, checking it before each file and each
+// entry read, so that a server can abandon the fetch once its client is
+// gone.
+func FetchEntriesFromFilesContext(ctx context.Context, level Level, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	return defaultLogger.FetchEntriesFromFilesContext(ctx, level, startTimestamp, endTimestamp)
+}
+
+// FetchEntriesFromFilesContext fetches the Logger's log entries until ctx
+// is done, as described by the package-level FetchEntriesFromFilesContext.
+func (lg *Logger) FetchEntriesFromFilesContext(ctx context.Context, level Level, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	entries, _, err := lg.fetchEntries(level, startTimestamp, endTimestamp, fetchOptions{ctx: ctx})
+	return entries, err
+}
+
+// FetchEntriesFromFiles fetches all log entries in the Logger's
+// directories that are of the given level of severity (or worse) and
+// whose times lie between startTimestamp and endTimestamp, inclusive, in
+// unix nanos. The files of the requested level and of all worse levels
+// are read, so that entries are found even if the file of the requested
+// level they were also written to is gone; entries found in several files
+// are returned once. Files are read newest first, and at most about the
+// EntriesCutoff newest entries are returned, in decreasing time order.
+// A start time after the end time, or a negative time, is an error.
+func (lg *Logger) FetchEntriesFromFiles(level Level, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	entries, _, err := lg.fetchEntries(level, startTimestamp, endTimestamp, fetchOptions{})
+	return entries, err
+}
+
+// FetchStats describes how complete the result of a fetch is.
+type FetchStats struct {
+	// Truncated is set if EntriesCutoff was reached before all candidate
+	// entries had been read, in which case more entries are available,
+	// for instance by narrowing the time range.
+	Truncated bool
+	// FilesNotRead is the number of candidate files which were not read
+	// at all because EntriesCutoff had been reached.
+	FilesNotRead int
+	// DecodeErrors is the number of entries which couldn't be decoded and
+	// were skipped; see DecodeErrorReport for the files containing them.
+	DecodeErrors int
+	// TotalAvailable, if Truncated, approximates the number of entries
+	// which the fetch would have returned without a limit, so that a UI
+	// can show "N of TotalAvailable". The entries of the files not read
+	// are counted (see CountEntries) in the files of the lowest level
+	// only, which hold those of the other levels too, and without regard
+	// to any match criteria of the fetch, so it may be an overestimate.
+	TotalAvailable int
+}
+
+// FileDecodeErrors describes the entries of a log file which couldn't be
+// decoded.
+type FileDecodeErrors struct {
+	Name      string // base name
+	Count     int
+	LastError string
+}
+
+// DecodeErrorReport lists the files in which the most recent fetch from
+// the default Logger found entries which couldn't be decoded, which
+// points at failing disks or buggy writers.
+func DecodeErrorReport() []FileDecodeErrors {
+	return defaultLogger.DecodeErrorReport()
+}
+
+// DecodeErrorReport lists the files in which the most recent fetch from
+// the Logger's files, by any of the Fetch functions, found entries which
+// couldn't be decoded.
+func (lg *Logger) DecodeErrorReport() []FileDecodeErrors {
+	lg.scanMu.Lock()
+	defer lg.scanMu.Unlock()
+	return append([]FileDecodeErrors(nil), lg.decodeErrors...)
+}
+
+// FetchEntriesFromFilesWithStats is like FetchEntriesFromFiles, but also
+// reports whether the result was truncated by EntriesCutoff.
+func FetchEntriesFromFilesWithStats(level Level, startTimestamp, endTimestamp int64) ([]proto.LogEntry, FetchStats, error) {
+	return defaultLogger.FetchEntriesFromFilesWithStats(level, startTimestamp, endTimestamp)
+}
+
+// FetchEntriesFromFilesWithStats is like FetchEntriesFromFiles, but also
+// reports whether the result was truncated by EntriesCutoff.
+func (lg *Logger) FetchEntriesFromFilesWithStats(level Level, startTimestamp, endTimestamp int64) ([]proto.LogEntry, FetchStats, error) {
+	return lg.fetchEntries(level, startTimestamp, endTimestamp, fetchOptions{})
+}
+
+// FetchEntriesWithinBytes is like FetchEntriesFromFilesWithStats, but also
+// stops once the messages of the entries fetched add up to maxBytes: the
+// newest entries are returned whose messages total at most maxBytes, and
+// the result is reported as truncated if more entries were available.
+// EntriesCutoff still applies, and whichever limit is hit first wins.
+// This gives UIs with a fixed rendering budget predictable payload sizes.
+func FetchEntriesWithinBytes(level Level, maxBytes int, startTimestamp, endTimestamp int64) ([]proto.LogEntry, FetchStats, error) {
+	return defaultLogger.FetchEntriesWithinBytes(level, maxBytes, startTimestamp, endTimestamp)
+}
+
+// FetchEntriesWithinBytes fetches the log entries in the Logger's
+// directories as described by the package-level FetchEntriesWithinBytes.
+func (lg *Logger) FetchEntriesWithinBytes(level Level, maxBytes int, startTimestamp, endTimestamp int64) ([]proto.LogEntry, FetchStats, error) {
+	return lg.fetchEntries(level, startTimestamp, endTimestamp, fetchOptions{maxBytes: maxBytes})
+}
+
+// fetchOptions customizes fetchEntries.
+type fetchOptions struct {
+	// match, if set, selects the entries returned.
+	match func(*proto.LogEntry) bool
+	// narrow, if set, returns a reader over the part of a file to read.
+	narrow func(*os.File) (io.Reader, error)
+	// maxBytes, if positive, bounds the total size of the messages of the
+	// entries returned.
+	maxBytes int
+	// maxMessageBytes, if positive, truncates the message of each entry
+	// returned to about that many bytes, see truncateMessage.
+	maxMessageBytes int
+	// gap, if positive, makes a marker entry be inserted between the
+	// entries returned wherever they are further apart than gap.
+	gap time.Duration
+	// ctx, if set, aborts the fetch once done.
+	ctx context.Context
+	// perFile, if set, is passed the entries returned from each file read,
+	// newest file first.
+	perFile func(file FileInfo, entries []proto.LogEntry)
+	// ascending makes the entries be returned in increasing time order
+	// rather than in decreasing time order.
+	ascending bool
+}
+
+// err returns the error of the context of the fetch, if it's done.
+func (opts fetchOptions) err() error {
+	if opts.ctx == nil {
+		return nil
+	}
+	return opts.ctx.Err()
+}
+
+// fetchEntries implements FetchEntriesFromFilesWithStats, customized by
+// opts.
+func (lg *Logger) fetchEntries(level Level, startTimestamp, endTimestamp int64, opts fetchOptions) ([]proto.LogEntry, FetchStats, error) {
+	if err := validateTimeRange(startTimestamp, endTimestamp); err != nil {
+		return nil, FetchStats{}, err
+	}
+	logFiles, err := lg.ListLogFiles()
+	if err != nil {
+		return nil, FetchStats{}, err
+	}
+
+	cutoff := EntriesCutoff
+	// chunks holds the entries fetched from each file, newest file first,
+	// and fetched counts them.
+	var chunks [][]proto.LogEntry
+	var fetched int
+	var stats FetchStats
+	var msgBytes int
+	var decodeErrors []FileDecodeErrors
+	defer func() {
+		lg.scanMu.Lock()
+		lg.decodeErrors = decodeErrors
+		lg.scanMu.Unlock()
+	}()
+	files := selectFiles(logFiles, level, endTimestamp)
+	// done holds the levels whose remaining, older files can't contain
+	// entries after startTimestamp.
+	done := map[Level]bool{}
+	// seen holds the entries already fetched from the file of another
+	// level, as each entry is written to the files of all lower levels.
+	seen := map[entryKey]bool{}
+	// levels holds the levels of the files entries were fetched from.
+	levels := map[Level]bool{}
+	// available counts the entries read, whether returned or not, and
+	// unread holds the files not read, for stats.TotalAvailable.
+	var available int
+	var unread []FileInfo
+	for i, file := range files {
+		if err := opts.err(); err != nil {
+			return nil, FetchStats{}, err
+		}
+		if done[file.Details.Level] {
+			continue
+		}
+		var maxEntries int
+		if cutoff > 0 {
+			maxEntries = cutoff - fetched
+		}
+		newEntries, scan, err := lg.readAllEntriesFromFile(file, startTimestamp, endTimestamp, maxEntries, opts)
+		if err != nil {
+			return nil, FetchStats{}, err
+		}
+		newEntries = dedupEntries(newEntries, seen)
+		available += len(newEntries) + scan.dropped
+		outOfBytes := false
+		if opts.maxBytes > 0 {
+			// The newest entries of the file are kept, which come last in
+			// ascending order.
+			for k := range newEntries {
+				j := k
+				if opts.ascending {
+					j = len(newEntries) - 1 - k
+				}
+				if msgBytes += len(formatMessage(&newEntries[j])); msgBytes > opts.maxBytes {
+					if opts.ascending {
+						newEntries = newEntries[j+1:]
+					} else {
+						newEntries = newEntries[:j]
+					}
+					outOfBytes = true
+					break
+				}
+			}
+		}
+		if len(newEntries) > 0 {
+			levels[file.Details.Level] = true
+		}
+		if opts.perFile != nil {
+			opts.perFile(file, newEntries)
+		}
+		chunks = append(chunks, newEntries)
+		fetched += len(newEntries)
+		if scan.dropped > 0 {
+			stats.Truncated = true
+		}
+		if scan.decodeErrors > 0 {
+			stats.DecodeErrors += scan.decodeErrors
+			decodeErrors = append(decodeErrors, FileDecodeErrors{
+				Name:      file.Name,
+				Count:     scan.decodeErrors,
+				LastError: scan.lastDecodeError.Error(),
+			})
+		}
+		if outOfBytes {
+			stats.Truncated = true
+			stats.FilesNotRead = len(files) - i - 1
+			unread = files[i+1:]
+			break
+		}
+		if scan.entryBeforeStart {
+			// Older files of the level can't contain entries after the
+			// start time.
+			done[file.Details.Level] = true
+		}
+		if cutoff > 0 && fetched >= cutoff {
+			if stats.FilesNotRead = len(files) - i - 1; stats.FilesNotRead > 0 {
+				stats.Truncated = true
+			}
+			unread = files[i+1:]
+			break
+		}
+	}
+	if stats.Truncated {
+		stats.TotalAvailable = available + lg.countUnread(files, unread, done, startTimestamp, endTimestamp)
+	}
+	// In ascending order, the entries of the oldest file come first.
+	var entries []proto.LogEntry
+	if fetched > 0 {
+		entries = make([]proto.LogEntry, 0, fetched)
 	}
-	if !logFileRE.MatchString(filename) {
-		return nil, util.Errorf("filename is not a cockroach log file: %s", filename)
+	for i := range chunks {
+		if opts.ascending {
+			i = len(chunks) - 1 - i
+		}
+		entries = append(entries, chunks[i]...)
+	}
+	if len(levels) > 1 {
+		// Files of different levels overlap in time.
+		if opts.ascending {
+			sort.Stable(entriesByTime(entries))
+		} else {
+			sort.Stable(sort.Reverse(entriesByTime(entries)))
+		}
+	}
+	if opts.gap > 0 {
+		entries = insertGapMarkers(entries, opts.gap, opts.ascending)
+	}
+	return entries, stats, nil
+}
+
+// validateTimeRange returns an error if the times, in unix nanos, don't
+// make up a range to fetch entries from, which points at a bug of the
+// caller rather than at an empty result.
+func validateTimeRange(startTimestamp, endTimestamp int64) error {
+	if startTimestamp < 0 || endTimestamp < 0 {
+		return util.Errorf("negative time in range [%d, %d]", startTimestamp, endTimestamp)
+	}
+	if startTimestamp > endTimestamp {
+		return util.Errorf("start time after end time: %d > %d", startTimestamp, endTimestamp)
+	}
+	return nil
+}
+
+// countUnread counts the entries between startTimestamp and endTimestamp
+// in the unread files among files which are of the lowest level and not
+// done, for FetchStats.TotalAvailable. Files which can't be read count
+// for nothing.
+func (lg *Logger) countUnread(files, unread []FileInfo, done map[Level]bool, startTimestamp, endTimestamp int64) int {
+	if len(files) == 0 {
+		return 0
+	}
+	lowest := files[0].Details.Level
+	for _, file := range files {
+		if file.Details.Level < lowest {
+			lowest = file.Details.Level
+		}
 	}
-	var reader io.ReadCloser
-	var err error
-	for _, dir := range logDirs {
-		filename = path.Join(dir, filename)
-		if verifyFile(filename) == nil {
-			reader, err = os.Open(filename)
-			if err == nil {
-				return reader, err
+	var total int
+	for _, file := range unread {
+		if file.Details.Level != lowest || done[lowest] {
+			continue
+		}
+		// The fetch returns the entries of all severities a file holds.
+		if n, err := lg.CountEntries(file, InfoLevel, startTimestamp, endTimestamp); err == nil {
+			total += n
+		}
+	}
+	return total
+}
+
+// entryKey identifies a log entry across the files it's written to.
+type entryKey struct {
+	time     int64
+	severity int32
+	file     string
+	line     int32
+	format   string
+}
+
+// dedupEntries returns the entries read from a file which aren't in
+// seen, the entries read from the previous files, and adds them to it.
+// Identical entries within the file are kept.
+func dedupEntries(entries []proto.LogEntry, seen map[entryKey]bool) []proto.LogEntry {
+	result := entries[:0]
+	var keys []entryKey
+	for _, entry := range entries {
+		key := entryKey{entry.Time, entry.Severity, entry.File, entry.Line, entry.Format}
+		if seen[key] {
+			continue
+		}
+		keys = append(keys, key)
+		result = append(result, entry)
+	}
+	for _, key := range keys {
+		seen[key] = true
+	}
+	return result
+}
+
+// FetchEntriesWithGaps is like FetchEntriesFromFiles, but wherever two
+// consecutive entries returned are more than gap apart, a marker entry
+// of severity GapLevel is inserted between them, so that a timeline can
+// show the break. The marker carries the time of the older entry and a
+// message giving the length of the gap.
+func FetchEntriesWithGaps(level Level, gap time.Duration, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	return defaultLogger.FetchEntriesWithGaps(level, gap, startTimestamp, endTimestamp)
+}
+
+// FetchEntriesWithGaps fetches the Logger's entries and marks the gaps
+// between them, as described by the package-level FetchEntriesWithGaps.
+func (lg *Logger) FetchEntriesWithGaps(level Level, gap time.Duration, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	entries, _, err := lg.fetchEntries(level, startTimestamp, endTimestamp, fetchOptions{gap: gap})
+	return entries, err
+}
+
+// insertGapMarkers returns the entries, which are in reverse time order
+// unless ascending is set, with a GapLevel entry inserted wherever
+// consecutive ones are more than gap apart.
+func insertGapMarkers(entries []proto.LogEntry, gap time.Duration, ascending bool) []proto.LogEntry {
+	var result []proto.LogEntry
+	for i := range entries {
+		if i > 0 {
+			newer, older := entries[i-1], entries[i]
+			if ascending {
+				newer, older = older, newer
+			}
+			if d := time.Duration(newer.Time - older.Time); d > gap {
+				result = append(result, proto.LogEntry{
+					Severity: int32(GapLevel),
+					Time:     older.Time,
+					Format:   fmt.Sprintf("gap of %s", d),
+				})
 			}
 		}
+		result = append(result, entries[i])
+	}
+	return result
+}
+
+// byTime sorts FileInfos by the creation time encoded in their names.
+type byTime []FileInfo
+
+func (a byTime) Len() int           { return len(a) }
+func (a byTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byTime) Less(i, j int) bool { return a[i].Details.Time < a[j].Details.Time }
+
+// newestFirst sorts log files by decreasing creation time, then by name.
+type newestFirst []FileInfo
+
+func (a newestFirst) Len() int      { return len(a) }
+func (a newestFirst) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a newestFirst) Less(i, j int) bool {
+	if a[i].Details.Time != a[j].Details.Time {
+		return a[i].Details.Time > a[j].Details.Time
+	}
+	return a[i].Name < a[j].Name
+}
+
+// selectFiles selects the log files of the given level or worse which
+// were created no later than endTimestamp, up to ClockJumpTolerance,
+// newest first.
+func selectFiles(logFiles []FileInfo, level Level, endTimestamp int64) []FileInfo {
+	var files []FileInfo
+	for _, logFile := range logFiles {
+		if LevelAtLeast(logFile.Details.Level, level) && !wellAfterRange(logFile.Details.Time, endTimestamp) {
+			files = append(files, logFile)
+		}
+	}
+	sort.Sort(sort.Reverse(byTime(files)))
+	return files
+}
+
+// fileScan summarizes the reading of a log file by readAllEntriesFromFile.
+type fileScan struct {
+	dropped          int  // matching entries dropped because of maxEntries
+	entryBeforeStart bool // whether an entry well before startTimestamp was read
+	decodeErrors     int  // entries which couldn't be decoded
+	lastDecodeError  error
+}
+
+// readAllEntriesFromFile reads all log entries from the given file whose
+// times lie between startTimestamp and endTimestamp and which are accepted
+// by match, if set, and returns them in decreasing time order. If
+// maxEntries is positive, only the newest maxEntries of them are kept
+// while reading, and the number of matching entries dropped is reported.
+// It also reports whether the file contains any entry before
+// startTimestamp, in which case older files need not be read. Only the
+// entries accepted by opts.match, if set, are returned, and only the part
+// of the file opts.narrow returns a reader for, if set, is read.
+//
+// Entries which can't be decoded are skipped and counted. So is an
+// incomplete last entry, unless the file is still being written.
+//
+// The entries of a file are assumed to be sorted by time (see
+// EntryDecoder.DecodeInRange), up to ClockJumpTolerance: only the times
+// of the entries outside of the range are decoded, and reading stops at
+// the first entry after endTimestamp by more than ClockJumpTolerance.
+// Only entries before startTimestamp by more than ClockJumpTolerance
+// count as entries before startTimestamp.
+func (lg *Logger) readAllEntriesFromFile(file FileInfo, startTimestamp, endTimestamp int64, maxEntries int, opts fetchOptions) ([]proto.LogEntry, fileScan, error) {
+	rc, err := lg.GetLogReader(file.Name, false /* !allowAbsolute */)
+	if err != nil {
+		return nil, fileScan{}, err
+	}
+	defer rc.Close()
+	var scan fileScan
+	var reader io.Reader = rc
+	if f, ok := rc.(*os.File); ok && opts.narrow != nil {
+		if reader, err = opts.narrow(f); err != nil {
+			return nil, fileScan{}, err
+		}
+	} else if ok {
+		// Files with a time index (see BuildTimeIndex) are read from
+		// close to the start time.
+		if scan.entryBeforeStart, err = seekTimeIndex(f, startTimestamp-int64(ClockJumpTolerance)); err != nil {
+			return nil, fileScan{}, err
+		}
+	}
+	// Entries are read with two reads each, which mustn't be syscalls.
+	reader = bufio.NewReader(reader)
+
+	var entries []proto.LogEntry
+	// Once maxEntries are held, entries is used as a ring buffer whose
+	// oldest entry is at index next.
+	var next int
+	for {
+		if err := opts.err(); err != nil {
+			return nil, fileScan{}, err
+		}
+		data, err := readEntryData(reader)
+		if err == io.EOF {
+			break
+		} else if err == io.ErrUnexpectedEOF {
+			if active, aErr := lg.ActiveLogFile(file.Details.Level); aErr != nil || filepath.Base(active) != file.Name {
+				scan.decodeErrors++
+				scan.lastDecodeError = err
+			}
+			break
+		} else if err != nil {
+			return nil, fileScan{}, err
+		}
+		// Entries outside of the time range aren't fully decoded.
+		if t, err := entryTime(data); err == nil {
+			if t < startTimestamp {
+				scan.entryBeforeStart = scan.entryBeforeStart || wellBeforeRange(t, startTimestamp)
+				continue
+			} else if t > endTimestamp {
+				if wellAfterRange(t, endTimestamp) {
+					break
+				}
+				continue
+			}
+		}
+		entry := proto.LogEntry{}
+		if err := gogoproto.Unmarshal(data, &entry); err != nil {
+			// The entry's length prefix is intact, so reading continues
+			// with the next entry.
+			scan.decodeErrors++
+			scan.lastDecodeError = err
+			continue
+		}
+		if entry.Time < startTimestamp {
+			scan.entryBeforeStart = scan.entryBeforeStart || wellBeforeRange(entry.Time, startTimestamp)
+		} else if entry.Time <= endTimestamp && (opts.match == nil || opts.match(&entry)) {
+			if lg.Redact != nil {
+				lg.Redact(&entry)
+			}
+			if opts.maxMessageBytes > 0 {
+				truncateMessage(&entry, opts.maxMessageBytes)
+			}
+			if maxEntries > 0 && len(entries) == maxEntries {
+				entries[next] = entry
+				next = (next + 1) % maxEntries
+				scan.dropped++
+			} else {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	entries = append(entries[next:], entries[:next]...)
+	if !opts.ascending {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	return entries, scan, nil
+}
+
+// FileEntries holds the entries fetched from a log file.
+type FileEntries struct {
+	File    FileInfo
+	Entries []proto.LogEntry // in decreasing time order
+}
+
+// FetchEntriesGrouped is like FetchEntriesFromFiles, but returns the
+// entries grouped by the file they were read from, newest file first.
+func FetchEntriesGrouped(level Level, startTimestamp, endTimestamp int64) ([]FileEntries, error) {
+	return defaultLogger.FetchEntriesGrouped(level, startTimestamp, endTimestamp)
+}
+
+// FetchEntriesGrouped fetches the Logger's log entries as
+// FetchEntriesFromFiles does, but returns them grouped by the file they
+// were read from, newest file first. Files contributing no entries are
+// left out. An entry written to the files of several levels is in the
+// group of the file it was read from first only.
+func (lg *Logger) FetchEntriesGrouped(level Level, startTimestamp, endTimestamp int64) ([]FileEntries, error) {
+	var groups []FileEntries
+	perFile := func(file FileInfo, entries []proto.LogEntry) {
+		if len(entries) > 0 {
+			groups = append(groups, FileEntries{File: file, Entries: entries})
+		}
+	}
+	if _, _, err := lg.fetchEntries(level, startTimestamp, endTimestamp, fetchOptions{perFile: perFile}); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// FetchEntriesFromFileList fetches the log entries of the given files,
+// read in the given order, whose times lie between startTimestamp and
+// endTimestamp, inclusive, in unix nanos, and which are accepted by
+// match, if set. See Logger.FetchEntriesFromFileList.
+func FetchEntriesFromFileList(files []FileInfo, startTimestamp, endTimestamp int64, match func(*proto.LogEntry) bool) ([]proto.LogEntry, error) {
+	return defaultLogger.FetchEntriesFromFileList(files, startTimestamp, endTimestamp, match)
+}
+
+// FetchEntriesFromFileList fetches the matching log entries of the given
+// files in the Logger's directories, such as files picked from
+// ListLogFiles. Unlike FetchEntriesFromFiles, it doesn't select the
+// files to read by their levels and times: each file is read in full, in
+// the given order, until EntriesCutoff entries are found. Entries found in
+// several files are returned once, and all are returned in decreasing
+// time order.
+func (lg *Logger) FetchEntriesFromFileList(files []FileInfo, startTimestamp, endTimestamp int64, match func(*proto.LogEntry) bool) ([]proto.LogEntry, error) {
+	if err := validateTimeRange(startTimestamp, endTimestamp); err != nil {
+		return nil, err
+	}
+	var entries []proto.LogEntry
+	seen := map[entryKey]bool{}
+	opts := fetchOptions{match: match}
+	for _, file := range files {
+		var maxEntries int
+		if EntriesCutoff > 0 {
+			maxEntries = EntriesCutoff - len(entries)
+		}
+		newEntries, _, err := lg.readAllEntriesFromFile(file, startTimestamp, endTimestamp, maxEntries, opts)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, dedupEntries(newEntries, seen)...)
+		if EntriesCutoff > 0 && len(entries) >= EntriesCutoff {
+			break
+		}
+	}
+	sort.Stable(sort.Reverse(entriesByTime(entries)))
+	return entries, nil
+}
+
+// FetchByTrace fetches the log entries of all levels which were logged
+// with the given trace ID (see the TraceID field) and whose times lie
+// between startTimestamp and endTimestamp, inclusive, in unix nanos.
+func FetchByTrace(traceID string, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	return defaultLogger.FetchByTrace(traceID, startTimestamp, endTimestamp)
+}
+
+// FetchByTrace fetches the log entries of all levels in the Logger's
+// directories which were logged with the given trace ID and whose times
+// lie between startTimestamp and endTimestamp, inclusive, in unix nanos.
+// The files of every level are scanned, so entries are found even if the
+// files of a lower level have been removed. Entries present in several
+// files are returned once, in decreasing time order.
+func (lg *Logger) FetchByTrace(traceID string, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	match := func(entry *proto.LogEntry) bool {
+		return entry.GetTraceID() == traceID
+	}
+	// The files of InfoLevel and of all worse levels are read, and the
+	// entries found in several of them deduplicated, by a single fetch.
+	entries, _, err := lg.fetchEntries(InfoLevel, startTimestamp, endTimestamp, fetchOptions{match: match})
+	return entries, err
+}
+
+// FetchEntriesUpToDepth fetches the log entries on disk like
+// FetchEntriesFromFiles, but only returns those logged with a stack
+// depth (see the -log-stack-depth flag) of at most maxDepth. This
+// separates entries of top-level operations from those logged by the
+// same code deep within recursive ones. Entries without a recorded depth
+// are excluded.
+func FetchEntriesUpToDepth(level Level, maxDepth int, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	return defaultLogger.FetchEntriesUpToDepth(level, maxDepth, startTimestamp, endTimestamp)
+}
+
+// FetchEntriesUpToDepth fetches the log entries in the Logger's
+// directories as described by the package-level FetchEntriesUpToDepth.
+func (lg *Logger) FetchEntriesUpToDepth(level Level, maxDepth int, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	match := func(entry *proto.LogEntry) bool {
+		return entry.StackDepth != nil && int(*entry.StackDepth) <= maxDepth
+	}
+	entries, _, err := lg.fetchEntries(level, startTimestamp, endTimestamp, fetchOptions{match: match})
+	return entries, err
+}
+
+// entriesByTime sorts log entries by increasing time.
+type entriesByTime []proto.LogEntry
+
+func (a entriesByTime) Len() int           { return len(a) }
+func (a entriesByTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a entriesByTime) Less(i, j int) bool { return a[i].Time < a[j].Time }
+
+// A DailyWindow selects the same span of time of every day, for instance
+// 2am to 3am. Times of day are offsets since midnight in Location, which
+// defaults to the local time zone of the process when nil. If End is
+// before Start, the window wraps around midnight; if both are equal, the
+// window is empty.
+type DailyWindow struct {
+	Start, End time.Duration
+	Location   *time.Location
+}
+
+// contains returns whether the given time in unix nanos falls within the
+// window, Start inclusive and End exclusive.
+func (w DailyWindow) contains(nanos int64) bool {
+	loc := w.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	t := time.Unix(0, nanos).In(loc)
+	hour, min, sec := t.Clock()
+	offset := time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute +
+		time.Duration(sec)*time.Second + time.Duration(t.Nanosecond())
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// FetchEntriesInDailyWindow is like FetchEntriesFromFiles, but only
+// returns the entries which fall within the daily window on each day
+// between startTimestamp and endTimestamp.
+func FetchEntriesInDailyWindow(level Level, window DailyWindow, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	return defaultLogger.FetchEntriesInDailyWindow(level, window, startTimestamp, endTimestamp)
+}
+
+// FetchEntriesInDailyWindow is like FetchEntriesFromFiles, but only
+// returns the entries which fall within the daily window on each day
+// between startTimestamp and endTimestamp.
+func (lg *Logger) FetchEntriesInDailyWindow(level Level, window DailyWindow, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	match := func(entry *proto.LogEntry) bool {
+		return window.contains(entry.Time)
 	}
-	return nil, err
+	entries, _, err := lg.fetchEntries(level, startTimestamp, endTimestamp, fetchOptions{match: match})
+	return entries, err
 }
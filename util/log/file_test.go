@@ -0,0 +1,2052 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
+	"golang.org/x/net/context"
+)
+
+// newTestLogger returns a Logger writing to a new temporary directory,
+// and a function cleaning up both.
+func newTestLogger(t *testing.T) (*Logger, func()) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg := NewLogger(dir)
+	return lg, func() {
+		if err := lg.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestParseLogFilename(t *testing.T) {
+	now := time.Unix(time.Now().Unix(), 0)
+	name, _ := logName("WARNING", now)
+	details, err := parseLogFilename(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := FileDetails{
+		Program:  program,
+		Host:     escapePeriods(host),
+		UserName: escapePeriods(userName),
+		Level:    WarningLevel,
+		Time:     now.UnixNano(),
+		PID:      pid,
+		RunID:    runID,
+	}
+	if details != exp {
+		t.Errorf("expected %+v; got %+v", exp, details)
+	}
+
+	// Runs sharing a PID are told apart by their run IDs; names without a
+	// run ID are still understood.
+	var runIDs []string
+	for _, name := range []string{
+		"cockroach.host.user.log.INFO.20150609-161048.30209-ibxsc0v4",
+		"cockroach.host.user.log.INFO.20150609-161048.30209-ibz9e7k1",
+		"cockroach.host.user.log.INFO.20150609-161048.30209",
+	} {
+		details, err := parseLogFilename(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if details.PID != 30209 {
+			t.Errorf("%s: expected PID 30209; got %d", name, details.PID)
+		}
+		runIDs = append(runIDs, details.RunID)
+	}
+	if exp := []string{"ibxsc0v4", "ibz9e7k1", ""}; !reflect.DeepEqual(runIDs, exp) {
+		t.Errorf("expected run IDs %s; got %s", exp, runIDs)
+	}
+
+	// Timestamps in RFC 3339 form, with colons or with colons escaped as
+	// underscores, are understood as well.
+	exp = FileDetails{
+		Program:  "cockroach",
+		Host:     "host",
+		UserName: "user",
+		Level:    InfoLevel,
+		Time:     time.Date(2015, 6, 9, 16, 10, 48, 0, time.UTC).UnixNano(),
+		PID:      30209,
+		RunID:    "ibxsc0v4",
+	}
+	for _, name := range []string{
+		"cockroach.host.user.log.INFO.2015-06-09T16:10:48Z.30209-ibxsc0v4",
+		"cockroach.host.user.log.INFO.2015-06-09T16_10_48Z.30209-ibxsc0v4",
+		"cockroach.host.user.log.INFO.2015-06-09T18:10:48+02:00.30209-ibxsc0v4",
+		"cockroach.host.user.log.INFO.2015-06-09T18_10_48+02_00.30209-ibxsc0v4",
+	} {
+		if details, err := parseLogFilename(name); err != nil {
+			t.Error(err)
+		} else if details != exp {
+			t.Errorf("%s: expected %+v; got %+v", name, exp, details)
+		}
+	}
+	local := time.Date(2015, 6, 9, 16, 10, 48, 0, time.Local).UnixNano()
+	for _, name := range []string{
+		"cockroach.host.user.log.INFO.2015-06-09T16:10:48.30209-ibxsc0v4",
+		"cockroach.host.user.log.INFO.2015-06-09T16_10_48.30209-ibxsc0v4",
+	} {
+		if details, err := parseLogFilename(name); err != nil {
+			t.Error(err)
+		} else if details.Time != local {
+			t.Errorf("%s: expected time %d; got %d", name, local, details.Time)
+		}
+	}
+
+	// PIDs up to the largest 32-bit int are accepted on every platform;
+	// larger ones are rejected rather than wrapped.
+	name = "cockroach.host.user.log.INFO.20150609-161048.2147483647-ibxsc0v4"
+	if details, err := parseLogFilename(name); err != nil {
+		t.Error(err)
+	} else if details.PID != 2147483647 {
+		t.Errorf("%s: expected PID 2147483647; got %d", name, details.PID)
+	}
+	for _, name := range []string{
+		"cockroach.host.user.log.INFO.20150609-161048.2147483648-ibxsc0v4",
+		"cockroach.host.user.log.INFO.20150609-161048.99999999999999999999-ibxsc0v4",
+	} {
+		if _, err := parseLogFilename(name); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("%q: expected out of range error; got %v", name, err)
+		}
+	}
+
+	for _, name := range []string{
+		"",
+		"cockroach.WARNING",
+		"cockroach.host.user.log.INFO.20150609-161048.30209-",
+		"cockroach.host.user.log.INFO.20150609-161048.30209-RUN",
+		"cockroach.host.user.log.DEBUG.20150609-161048.30209",
+		"cockroach.host.user.log.INFO.2015-06-09.30209",
+		"cockroach.host.user.log.INFO.20150609-161048.30209.txt",
+	} {
+		if _, err := parseLogFilename(name); err == nil {
+			t.Errorf("%q: expected error", name)
+		}
+	}
+}
+
+// TestFilenameTimeFormat verifies that names written with other layouts
+// parse back, and that names written with the default layout still parse
+// once the layout is changed.
+func TestFilenameTimeFormat(t *testing.T) {
+	defer func(format string) { FilenameTimeFormat = format }(FilenameTimeFormat)
+	now := time.Unix(time.Now().Unix(), 0)
+	oldName, _ := logName("INFO", now)
+
+	for _, format := range []string{
+		logFileTimeFormat,
+		"20060102T150405Z0700",
+		"2006-01-02T15_04_05",
+		"060102150405",
+	} {
+		FilenameTimeFormat = format
+		name, _ := logName("INFO", now)
+		details, err := parseLogFilename(name)
+		if err != nil {
+			t.Errorf("%s: %s", format, err)
+			continue
+		}
+		if details.Time != now.UnixNano() || details.Level != InfoLevel || details.PID != pid {
+			t.Errorf("%s: unexpected details %+v of %s", format, details, name)
+		}
+		if details, err := parseLogFilename(oldName); err != nil || details.Time != now.UnixNano() {
+			t.Errorf("%s: expected %s to parse with time %d; got %+v, %v", format, oldName, now.UnixNano(), details, err)
+		}
+	}
+}
+
+// TestFormatLogFilename verifies that FormatLogFilename is the inverse of
+// parseLogFilename, and that FileDetails describe themselves.
+func TestFormatLogFilename(t *testing.T) {
+	defer func(format string) { FilenameTimeFormat = format }(FilenameTimeFormat)
+	now := time.Unix(time.Now().Unix(), 0)
+	for _, format := range []string{logFileTimeFormat, "20060102T150405Z0700"} {
+		FilenameTimeFormat = format
+		name, _ := logName("INFO", now)
+		for i, level := range []Level{InfoLevel, WarningLevel, ErrorLevel} {
+			for _, runID := range []string{"", "abc123"} {
+				for _, seq := range []int{0, 2} {
+					details := FileDetails{
+						Program:  "cockroach",
+						Host:     "host-" + strconv.Itoa(i),
+						UserName: "user",
+						Level:    level,
+						Time:     now.Add(time.Duration(i) * time.Hour).UnixNano(),
+						PID:      100 << uint(8*i),
+						RunID:    runID,
+						Seq:      seq,
+					}
+					name := FormatLogFilename(details)
+					parsed, err := parseLogFilename(name)
+					if err != nil {
+						t.Errorf("%s: %s", name, err)
+						continue
+					}
+					if parsed != details {
+						t.Errorf("%s: expected %+v; got %+v", name, details, parsed)
+					}
+					if roundTrip := FormatLogFilename(parsed); roundTrip != name {
+						t.Errorf("expected %s; got %s", name, roundTrip)
+					}
+				}
+			}
+		}
+		// The names the Logger writes round-trip too.
+		details, err := parseLogFilename(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if roundTrip := FormatLogFilename(details); roundTrip != name {
+			t.Errorf("expected %s; got %s", name, roundTrip)
+		}
+	}
+
+	details := FileDetails{
+		Program:  "cockroach",
+		Host:     "host",
+		UserName: "user",
+		Level:    WarningLevel,
+		Time:     time.Date(2015, 6, 9, 16, 10, 48, 0, time.UTC).UnixNano(),
+		PID:      1234,
+	}
+	if exp := "cockroach@host (user) WARNING 2015-06-09T16:10:48Z 1234"; details.String() != exp {
+		t.Errorf("expected %q; got %q", exp, details.String())
+	}
+}
+
+// TestListLogFilesUnreadableDir verifies that a directory which can't be
+// read doesn't hide the files of the others, and is reported.
+func TestListLogFilesUnreadableDir(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	good := lg.logDirs()[0]
+	// A file in place of a directory fails to be read even as root.
+	bad := filepath.Join(good, "not-a-dir")
+	if err := ioutil.WriteFile(bad, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	names := writeGCFixtures(t, good, 10, 10)
+	for _, dirs := range [][]string{{bad, good}, {good, bad}} {
+		lg.dirs = dirs
+		files, err := lg.ListLogFiles()
+		listErr, ok := err.(*ListError)
+		if !ok || len(listErr.Errors) != 1 || !strings.Contains(err.Error(), bad) {
+			t.Errorf("%s: expected a ListError for %s; got %v", dirs, bad, err)
+		}
+		if len(files) != len(names) {
+			t.Errorf("%s: expected the %d files of %s; got %+v", dirs, len(names), good, files)
+		}
+	}
+}
+
+// TestParseLogFilenameExported exercises the API external tools use to
+// recognize and parse log file names.
+func TestParseLogFilenameExported(t *testing.T) {
+	pattern := LogFilePattern()
+	for _, test := range []struct {
+		name  string
+		level Level
+		ok    bool
+	}{
+		{"cockroach.host.user.log.INFO.20150609-161048.1", InfoLevel, true},
+		{"cockroach.host_1.user.log.ERROR.20150609-161048.1234-abc123.2", ErrorLevel, true},
+		{"cockroach.host.user.log.WARNING.2015-06-09T16:10:48Z.1", WarningLevel, true},
+		{"cockroach.INFO", 0, false},
+		{"cockroach.host.user.log.DEBUG.20150609-161048.1", 0, false},
+		{"cockroach.host.user.log.INFO.20150609-161048.1.gz", 0, false},
+		{"notes.txt", 0, false},
+	} {
+		if matched := pattern.MatchString(test.name); matched != test.ok {
+			t.Errorf("%s: expected match %t; got %t", test.name, test.ok, matched)
+		}
+		details, err := ParseLogFilename(test.name)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: expected ok=%t; got %v", test.name, test.ok, err)
+			continue
+		}
+		if test.ok && (details.Program != "cockroach" || details.Level != test.level) {
+			t.Errorf("%s: unexpected details %+v", test.name, details)
+		}
+	}
+}
+
+// TestIndependentLoggers verifies that Loggers write to, list and fetch
+// from their own directories only.
+func TestIndependentLoggers(t *testing.T) {
+	lg1, cleanup1 := newTestLogger(t)
+	defer cleanup1()
+	lg2, cleanup2 := newTestLogger(t)
+	defer cleanup2()
+
+	lg1.Infoc(nil, "first %d", 1)
+	lg2.Warningc(nil, "second %d", 2)
+	Flush()
+
+	for i, test := range []struct {
+		lg      *Logger
+		expMsg  string
+		expLogs []Level
+	}{
+		{lg1, "first", []Level{InfoLevel}},
+		{lg2, "second", []Level{InfoLevel, WarningLevel}},
+	} {
+		files, err := test.lg.ListLogFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != len(test.expLogs) {
+			t.Fatalf("%d: expected %d files; got %+v", i, len(test.expLogs), files)
+		}
+		entries, err := test.lg.FetchEntriesFromFiles(InfoLevel, 0, math.MaxInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found bool
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Format, test.expMsg) {
+				found = true
+			} else if len(entry.Args) > 0 {
+				t.Errorf("%d: unexpected entry %+v", i, entry)
+			}
+		}
+		if !found {
+			t.Errorf("%d: expected to fetch %q; got %+v", i, test.expMsg, entries)
+		}
+	}
+}
+
+func TestFetchEntriesFromFilesTimeRange(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+
+	lg.Infoc(nil, "before")
+	lg.Flush()
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("expected entries")
+	}
+	var start int64
+	for _, entry := range entries {
+		if entry.Time >= start {
+			start = entry.Time + 1
+		}
+	}
+	lg.Infoc(nil, "after")
+	lg.Flush()
+
+	entries, err = lg.FetchEntriesFromFiles(InfoLevel, start, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Format != "after" {
+		t.Errorf("expected only the entry logged after %d; got %+v", start, entries)
+	}
+}
+
+// TestActiveLogFile verifies that the active file of a level is found
+// through both symlinks and pointer files.
+// TestActiveLogFileWithoutSymlinks verifies that where symlinks can't be
+// created, the link of a level is written as a pointer file, which
+// ActiveLogFile reads.
+// TestLinkNames verifies that programs of the same name sharing a log
+// directory get distinct links when configured to, and still resolve
+// their own active files.
+func TestLinkNames(t *testing.T) {
+	lg1, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg1.logDirs()[0]
+	lg2 := NewLogger(dir)
+	defer lg2.Close()
+	for i, lg := range []*Logger{lg1, lg2} {
+		lg.LinkIncludesHost = true
+		lg.LinkSuffix = fmt.Sprintf("node%d", i+1)
+		lg.UniqueFiles = true
+	}
+	lg2.LegacyLinks = true
+
+	lg1.Infoc(nil, "one")
+	lg2.Infoc(nil, "two")
+	Flush()
+	active1, err := lg1.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active2, err := lg2.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active1 == active2 {
+		t.Fatalf("expected distinct active files; got %s twice", active1)
+	}
+	for _, test := range []struct {
+		link, target string
+	}{
+		{program + "." + escapePeriods(host) + ".node1.INFO", active1},
+		{program + "." + escapePeriods(host) + ".node2.INFO", active2},
+		{program + ".INFO", active2},
+	} {
+		target, err := os.Readlink(filepath.Join(dir, test.link))
+		if err != nil {
+			t.Errorf("%s: %s", test.link, err)
+		} else if filepath.Join(dir, target) != test.target {
+			t.Errorf("%s: expected a link to %s; got %s", test.link, test.target, target)
+		}
+	}
+	if data := readActiveFile(t, lg1, InfoLevel); !strings.Contains(data, "one") || strings.Contains(data, "two") {
+		t.Errorf("expected the first Logger's entries only; got %q", data)
+	}
+}
+
+func TestActiveLogFileWithoutSymlinks(t *testing.T) {
+	defer func(previous func(string, string) error) { symlink = previous }(symlink)
+	symlink = func(oldname, newname string) error {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: errors.New("not supported")}
+	}
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Infoc(nil, "x")
+	lg.Flush()
+
+	exp := lg.file[InfoLevel].(*syncBuffer).file.Name()
+	_, link := logName(InfoLevel.String(), time.Time{})
+	linkName := filepath.Join(lg.logDirs()[0], link)
+	if info, err := os.Lstat(linkName); err != nil {
+		t.Fatal(err)
+	} else if !info.Mode().IsRegular() {
+		t.Fatalf("expected %s to be a pointer file; got mode %s", link, info.Mode())
+	}
+	if target, err := readPointerFile(osFileSystem{}, linkName); err != nil {
+		t.Fatal(err)
+	} else if target != filepath.Base(exp) {
+		t.Errorf("expected the pointer file to hold %s; got %s", filepath.Base(exp), target)
+	}
+	name, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != exp {
+		t.Errorf("expected %s; got %s", exp, name)
+	}
+	if name, err := readLink(osFileSystem{}, linkName); err != nil || name != filepath.Base(exp) {
+		t.Errorf("expected readLink to return %s; got %s, %v", filepath.Base(exp), name, err)
+	}
+}
+
+func TestActiveLogFile(t *testing.T) {
+	for _, usePointerFiles := range []bool{false, true} {
+		func() {
+			lg, cleanup := newTestLogger(t)
+			defer cleanup()
+			lg.UsePointerFiles = usePointerFiles
+
+			if _, err := lg.ActiveLogFile(InfoLevel); err == nil {
+				t.Errorf("pointer=%t: expected error before any file is created", usePointerFiles)
+			}
+			lg.Warningc(nil, "x")
+			dir := lg.logDirs()[0]
+			_, link := logName(InfoLevel.String(), time.Time{})
+			_, symlinkErr := os.Lstat(filepath.Join(dir, link))
+			_, pointerErr := os.Stat(filepath.Join(dir, link+pointerFileSuffix))
+			if (symlinkErr == nil) == usePointerFiles || (pointerErr == nil) != usePointerFiles {
+				t.Errorf("pointer=%t: unexpected link files: %v, %v", usePointerFiles, symlinkErr, pointerErr)
+			}
+
+			for _, level := range []Level{InfoLevel, WarningLevel} {
+				name, err := lg.ActiveLogFile(level)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sb := lg.file[level].(*syncBuffer)
+				if name != sb.file.Name() {
+					t.Errorf("pointer=%t: expected %s; got %s", usePointerFiles, sb.file.Name(), name)
+				}
+			}
+			if _, err := lg.ActiveLogFile(ErrorLevel); err == nil {
+				t.Errorf("pointer=%t: expected error for level without file", usePointerFiles)
+			}
+
+			// With the link stale, the newest file of the level is found.
+			linkName := filepath.Join(dir, link)
+			if usePointerFiles {
+				linkName += pointerFileSuffix
+			}
+			if err := os.Remove(linkName); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink("missing", linkName); err != nil {
+				t.Fatal(err)
+			}
+			name, err := lg.ActiveLogFile(InfoLevel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := lg.file[InfoLevel].(*syncBuffer).file.Name(); name != exp {
+				t.Errorf("pointer=%t: expected fallback to %s; got %s", usePointerFiles, exp, name)
+			}
+		}()
+	}
+}
+
+func TestFetchByTrace(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+
+	ctx := Add(context.Background(), TraceID, "abc")
+	lg.Infoc(ctx, "info")
+	lg.Infoc(context.Background(), "untraced")
+	lg.Warningc(Add(context.Background(), TraceID, "other"), "other trace")
+	lg.Errorc(ctx, "error")
+	lg.Flush()
+
+	entries, err := lg.FetchByTrace("abc", 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var formats []string
+	for _, entry := range entries {
+		formats = append(formats, entry.Format)
+	}
+	if exp := []string{"error", "info"}; !reflect.DeepEqual(formats, exp) {
+		t.Errorf("expected %s; got %s", exp, formats)
+	}
+
+	// Without the INFO file, the entry is still found in the ERROR file.
+	info, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(info); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err = lg.FetchByTrace("abc", 0, math.MaxInt64); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Format != "error" {
+		t.Errorf("expected the error entry; got %+v", entries)
+	}
+}
+
+// TestFetchEntriesCutoff verifies that EntriesCutoff bounds the number of
+// entries returned, keeping the newest ones, and that non-positive values
+// mean no limit.
+func TestFetchEntriesCutoff(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	for i := 0; i < 5; i++ {
+		lg.Warningc(nil, "entry %d", i)
+	}
+	lg.Flush()
+
+	defer func(previous int) { EntriesCutoff = previous }(EntriesCutoff)
+	for _, test := range []struct {
+		cutoff int
+		exp    []string
+	}{
+		{-1, []string{"4", "3", "2", "1", "0"}},
+		{0, []string{"4", "3", "2", "1", "0"}},
+		{2, []string{"4", "3"}},
+		{5, []string{"4", "3", "2", "1", "0"}},
+	} {
+		EntriesCutoff = test.cutoff
+		entries, err := lg.FetchEntriesFromFiles(WarningLevel, 0, math.MaxInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var args []string
+		for _, entry := range entries {
+			if len(entry.Args) > 0 {
+				args = append(args, entry.Args[0].Str)
+			}
+		}
+		if !reflect.DeepEqual(args, test.exp) {
+			t.Errorf("cutoff %d: expected %s; got %s", test.cutoff, test.exp, args)
+		}
+	}
+}
+
+func TestDailyWindowContains(t *testing.T) {
+	loc := time.FixedZone("test", -5*3600)
+	at := func(day, hour, min int) int64 {
+		return time.Date(2015, 6, day, hour, min, 0, 0, loc).UnixNano()
+	}
+	nightly := DailyWindow{Start: 2 * time.Hour, End: 3 * time.Hour, Location: loc}
+	wrapping := DailyWindow{Start: 23 * time.Hour, End: time.Hour, Location: loc}
+	for i, test := range []struct {
+		window DailyWindow
+		nanos  int64
+		exp    bool
+	}{
+		{nightly, at(1, 2, 0), true},
+		{nightly, at(2, 2, 59), true},
+		{nightly, at(3, 3, 0), false},
+		{nightly, at(3, 1, 59), false},
+		{nightly, at(3, 14, 30), false},
+		{wrapping, at(1, 23, 30), true},
+		{wrapping, at(2, 0, 30), true},
+		{wrapping, at(2, 1, 0), false},
+		{wrapping, at(2, 12, 0), false},
+		// The same instant is 7am in UTC, outside the window.
+		{DailyWindow{Start: 2 * time.Hour, End: 3 * time.Hour, Location: time.UTC}, at(1, 2, 0), false},
+	} {
+		if got := test.window.contains(test.nanos); got != test.exp {
+			t.Errorf("%d: expected %t; got %t", i, test.exp, got)
+		}
+	}
+}
+
+func TestFetchEntriesInDailyWindow(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Infoc(nil, "now")
+	lg.Flush()
+
+	for _, test := range []struct {
+		window DailyWindow
+		exp    bool
+	}{
+		{DailyWindow{Start: 0, End: 24 * time.Hour}, true},
+		{DailyWindow{}, false},
+	} {
+		entries, err := lg.FetchEntriesInDailyWindow(InfoLevel, test.window, 0, math.MaxInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found bool
+		for _, entry := range entries {
+			found = found || entry.Format == "now"
+		}
+		if found != test.exp {
+			t.Errorf("window %+v: expected found=%t; got %+v", test.window, test.exp, entries)
+		}
+	}
+}
+
+func TestValidateLogDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A missing directory is created, and the probe file removed.
+	logDir := filepath.Join(dir, "a", "b")
+	if err := ValidateLogDir(logDir); err != nil {
+		t.Fatal(err)
+	}
+	if infos, err := ioutil.ReadDir(logDir); err != nil {
+		t.Fatal(err)
+	} else if len(infos) != 0 {
+		t.Errorf("expected the probe file to be removed; got %d files", len(infos))
+	}
+
+	// A file isn't a directory.
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateLogDir(file); err == nil || !strings.Contains(err.Error(), file) {
+		t.Errorf("expected an error naming %s; got %v", file, err)
+	}
+
+	// The error of an unwritable directory wraps the permission error,
+	// unless permissions don't apply, as to root.
+	readOnly := filepath.Join(dir, "ro")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateLogDir(readOnly); err != nil && !os.IsPermission(errors.Unwrap(err)) {
+		t.Errorf("expected a permission error; got %v", err)
+	}
+}
+
+// TestFetchEntriesFromFileList verifies that exactly the files listed are
+// read, in the order given.
+func TestFetchEntriesFromFileList(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	// The ERROR entries at 40 and 50 are in both the INFO and the ERROR
+	// file, as the Logger would write them.
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161048.1", InfoLevel, 10, 20, 30)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161049.1", ErrorLevel, 40, 50)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.ERROR.20150609-161049.1", ErrorLevel, 40, 50)
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]FileInfo{}
+	for _, file := range files {
+		byName[file.Name] = file
+	}
+	pick := func(names ...string) []FileInfo {
+		var picked []FileInfo
+		for _, name := range names {
+			picked = append(picked, byName["cockroach.host.user.log."+name+".1"])
+		}
+		return picked
+	}
+
+	defer func(previous int) { EntriesCutoff = previous }(EntriesCutoff)
+	for i, test := range []struct {
+		files  []FileInfo
+		cutoff int
+		match  func(*proto.LogEntry) bool
+		exp    []int64
+	}{
+		{pick("INFO.20150609-161048"), 0, nil, []int64{30, 20, 10}},
+		{pick("ERROR.20150609-161049", "INFO.20150609-161049"), 0, nil, []int64{50, 40}},
+		{pick("ERROR.20150609-161049", "INFO.20150609-161048"), 0, nil, []int64{50, 40, 30, 20, 10}},
+		{pick("INFO.20150609-161048", "ERROR.20150609-161049"), 0,
+			func(entry *proto.LogEntry) bool { return entry.Severity == int32(ErrorLevel) }, []int64{50, 40}},
+		// The cutoff applies in the order of the files.
+		{pick("INFO.20150609-161048", "ERROR.20150609-161049"), 2, nil, []int64{30, 20}},
+		{nil, 0, nil, nil},
+	} {
+		EntriesCutoff = test.cutoff
+		entries, err := lg.FetchEntriesFromFileList(test.files, 0, math.MaxInt64, test.match)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var times []int64
+		for _, entry := range entries {
+			times = append(times, (entry.Time-testBaseTime(t))/1e8)
+		}
+		if !reflect.DeepEqual(times, test.exp) {
+			t.Errorf("%d: expected %d; got %d", i, test.exp, times)
+		}
+	}
+}
+
+// TestFetchEntriesClockJumps verifies that entries logged after the clock
+// jumped back are fetched, as long as the jump is within
+// ClockJumpTolerance.
+func TestFetchEntriesClockJumps(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	// Times are in tenths of a second after the creation of the first
+	// file. The clock jumps back after 30 in the first file, and after 60
+	// between the second file and the third. The fourth was named before
+	// the clock jumped back.
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161048.1", InfoLevel, 10, 20, 30, 5, 40)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161049.1", InfoLevel, 45, 60)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161050.1", InfoLevel, 50, 70)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161100.1", InfoLevel, 80)
+
+	defer func(previous time.Duration) { ClockJumpTolerance = previous }(ClockJumpTolerance)
+	for _, test := range []struct {
+		start, end int64
+		tolerance  time.Duration
+		exp        []int64
+	}{
+		{0, 22, 2 * time.Second, []int64{5, 20, 10}},
+		{0, 22, 0, []int64{20, 10}},
+		{55, 65, 2 * time.Second, []int64{60}},
+		{55, 65, 0, nil},
+		{75, 105, 2 * time.Second, []int64{80}},
+		{75, 105, 0, nil},
+	} {
+		ClockJumpTolerance = test.tolerance
+		entries, err := lg.FetchEntriesFromFiles(InfoLevel, testBaseTime(t)+test.start*1e8, testBaseTime(t)+test.end*1e8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var times []int64
+		for _, entry := range entries {
+			times = append(times, (entry.Time-testBaseTime(t))/1e8)
+		}
+		if !reflect.DeepEqual(times, test.exp) {
+			t.Errorf("[%d, %d], tolerance %s: expected %d; got %d", test.start, test.end, test.tolerance, test.exp, times)
+		}
+	}
+}
+
+func TestFetchEntriesGrouped(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161048.1", InfoLevel, 10, 20, 30)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161049.1", InfoLevel, 40, 50)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.ERROR.20150609-161050.1", ErrorLevel, 45)
+
+	type group struct {
+		name  string
+		times []int64
+	}
+	for _, test := range []struct {
+		start, end int64
+		exp        []group
+	}{
+		{0, 100, []group{
+			{"cockroach.host.user.log.ERROR.20150609-161050.1", []int64{45}},
+			{"cockroach.host.user.log.INFO.20150609-161049.1", []int64{50, 40}},
+			{"cockroach.host.user.log.INFO.20150609-161048.1", []int64{30, 20, 10}},
+		}},
+		{15, 35, []group{
+			{"cockroach.host.user.log.INFO.20150609-161048.1", []int64{30, 20}},
+		}},
+		{90, 100, nil},
+	} {
+		grouped, err := lg.FetchEntriesGrouped(InfoLevel, testBaseTime(t)+test.start*1e8, testBaseTime(t)+test.end*1e8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var groups []group
+		for _, g := range grouped {
+			var times []int64
+			for _, entry := range g.Entries {
+				times = append(times, (entry.Time-testBaseTime(t))/1e8)
+			}
+			groups = append(groups, group{g.File.Name, times})
+		}
+		if !reflect.DeepEqual(groups, test.exp) {
+			t.Errorf("[%d, %d]: expected %v; got %v", test.start, test.end, test.exp, groups)
+		}
+	}
+}
+
+// TestSetMaxSize verifies that SetMaxSize, both package-level and of a
+// Logger, rejects sizes below the minimum and that the rotation path sees
+// the accepted ones.
+func TestSetMaxSize(t *testing.T) {
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+
+	testCases := []struct {
+		size uint64
+		ok   bool
+	}{
+		{0, false},
+		{1, false},
+		{MinMaxSize - 1, false},
+		{MinMaxSize, true},
+		{MinMaxSize + 1, true},
+		{math.MaxUint64, true},
+	}
+	lg := &Logger{}
+	for i, test := range testCases {
+		previous := lg.maxSize()
+		err := SetMaxSize(test.size)
+		if (err == nil) != test.ok {
+			t.Errorf("%d: expected ok=%t; got %v", i, test.ok, err)
+		}
+		expected := previous
+		if test.ok {
+			expected = test.size
+		}
+		if size := lg.maxSize(); size != expected {
+			t.Errorf("%d: expected max size %d; got %d", i, expected, size)
+		}
+		if MaxSize != expected {
+			t.Errorf("%d: expected MaxSize %d; got %d", i, expected, MaxSize)
+		}
+	}
+
+	// A Logger's own MaxSize takes precedence, and is validated alike.
+	for i, test := range testCases {
+		previous := lg.maxSize()
+		err := lg.SetMaxSize(test.size)
+		if (err == nil) != test.ok {
+			t.Errorf("%d: expected ok=%t for the Logger; got %v", i, test.ok, err)
+		}
+		expected := previous
+		if test.ok {
+			expected = test.size
+		}
+		if size := lg.maxSize(); size != expected {
+			t.Errorf("%d: expected the Logger's max size %d; got %d", i, expected, size)
+		}
+	}
+	if err := SetMaxSize(MinMaxSize); err != nil {
+		t.Fatal(err)
+	}
+	if size := lg.maxSize(); size != math.MaxUint64 {
+		t.Errorf("expected the Logger's max size %d; got %d", uint64(math.MaxUint64), size)
+	}
+}
+
+// TestSetLogDir verifies that the default Logger writes to the directory
+// set last, even once it has resolved its directories, and that
+// concurrent calls are safe.
+func TestSetLogDir(t *testing.T) {
+	defer SetLogDir(*logDir)
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		dir, err := ioutil.TempDir("", "log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dirs = append(dirs, dir)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			SetLogDir(dirs[i%2])
+			_ = defaultLogger.logDirs()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, dir := range dirs {
+		SetLogDir(dir)
+		if logDirs := defaultLogger.logDirs(); !reflect.DeepEqual(logDirs, []string{dir}) {
+			t.Errorf("expected log dirs %s; got %s", dir, logDirs)
+		}
+		defaultLogger.Warningc(nil, "x")
+		name, err := defaultLogger.ActiveLogFile(WarningLevel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Dir(name) != dir {
+			t.Errorf("expected the active file in %s; got %s", dir, name)
+		}
+	}
+}
+
+// TestFetchEntriesInvalidRange verifies that inverted and negative time
+// ranges are reported rather than fetching nothing.
+func TestFetchEntriesInvalidRange(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Infoc(nil, "x")
+	lg.Flush()
+	for _, test := range []struct {
+		start, end int64
+		exp        string
+	}{
+		{2, 1, "start time after end time"},
+		{-1, 1, "negative time"},
+		{0, -1, "negative time"},
+	} {
+		if _, err := lg.FetchEntriesFromFiles(InfoLevel, test.start, test.end); err == nil || !strings.Contains(err.Error(), test.exp) {
+			t.Errorf("[%d, %d]: expected error %q; got %v", test.start, test.end, test.exp, err)
+		}
+	}
+	if _, err := lg.FetchEntriesFromFiles(InfoLevel, 1, 1); err != nil {
+		t.Errorf("expected an empty range to be valid; got %s", err)
+	}
+}
+
+// TestFetchStats verifies that truncation by EntriesCutoff is reported,
+// including the number of files left unread and of the entries available.
+func TestFetchStats(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	defer func(previous uint64) { lg.MaxSize = previous }(lg.MaxSize)
+	lg.MaxSize = 1
+
+	// Every entry rotates into a new file, whose name must differ.
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			time.Sleep(time.Second)
+		}
+		lg.Errorc(nil, "entry %d", i)
+	}
+	lg.Flush()
+
+	defer func(previous int) { EntriesCutoff = previous }(EntriesCutoff)
+	for _, test := range []struct {
+		cutoff   int
+		expStats FetchStats
+	}{
+		{0, FetchStats{}},
+		{100, FetchStats{}},
+		// Each file holds two header entries, a rotation marker and one
+		// logged entry; the first also holds the header entries it was
+		// created with before being rotated right away, under the same
+		// name, to make room for the first entry.
+		{1, FetchStats{Truncated: true, FilesNotRead: 2, TotalAvailable: 14}},
+		{4, FetchStats{Truncated: true, FilesNotRead: 2, TotalAvailable: 14}},
+		{5, FetchStats{Truncated: true, FilesNotRead: 1, TotalAvailable: 14}},
+	} {
+		EntriesCutoff = test.cutoff
+		_, stats, err := lg.FetchEntriesFromFilesWithStats(ErrorLevel, 0, math.MaxInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats != test.expStats {
+			t.Errorf("cutoff %d: expected %+v; got %+v", test.cutoff, test.expStats, stats)
+		}
+	}
+}
+
+// TestConcurrentRotation logs from many goroutines through many
+// rotations, and from two Loggers sharing the directory, verifying that
+// no entry is lost, that the links point at the files being written and
+// that no temporary file is left behind.
+func TestConcurrentRotation(t *testing.T) {
+	defer func(cutoff int) { EntriesCutoff = cutoff }(EntriesCutoff)
+	EntriesCutoff = 0
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.MaxSize = 2048
+	lg.UniqueFiles = true
+	other := NewLogger(lg.logDirs()...)
+	defer other.Close()
+	other.MaxSize = lg.MaxSize
+	other.UniqueFiles = true
+
+	const goroutines, perGoroutine = 8, 200
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				lg.Infoc(nil, "entry %d-%d", g, i)
+				other.Infoc(nil, "other %d-%d", g, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	lg.Flush()
+	other.Flush()
+
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for i := range entries {
+		if msg := formatMessage(&entries[i]); strings.HasPrefix(msg, "entry ") {
+			seen[msg] = true
+		}
+	}
+	if len(seen) != goroutines*perGoroutine {
+		t.Errorf("expected %d entries; found %d", goroutines*perGoroutine, len(seen))
+	}
+
+	// The link was last replaced by one of the Loggers.
+	active, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := lg.file[infoLog].(*syncBuffer).file.Name(), other.file[infoLog].(*syncBuffer).file.Name(); active != a && active != b {
+		t.Errorf("expected the link to point at %s or %s; got %s", a, b, active)
+	}
+	infos, err := ioutil.ReadDir(lg.logDirs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), ".tmp") {
+			t.Errorf("temporary file left behind: %s", info.Name())
+		}
+	}
+}
+
+// TestRotationAtomic logs through many rotations while readers follow
+// the active file, verifying they always find a complete file starting
+// with its header.
+func TestRotationAtomic(t *testing.T) {
+	for _, usePointerFiles := range []bool{false, true} {
+		func() {
+			lg, cleanup := newTestLogger(t)
+			defer cleanup()
+			lg.UsePointerFiles = usePointerFiles
+			lg.Infoc(nil, "start")
+
+			const rotations = 200
+			done := make(chan struct{})
+			errs := make(chan error, 4)
+			for i := 0; i < cap(errs); i++ {
+				go func() {
+					for {
+						select {
+						case <-done:
+							errs <- nil
+							return
+						default:
+						}
+						name, err := lg.ActiveLogFile(InfoLevel)
+						if err != nil {
+							errs <- err
+							return
+						}
+						f, err := os.Open(name)
+						if err != nil {
+							errs <- err
+							return
+						}
+						var entry proto.LogEntry
+						err = NewEntryDecoder(f).Decode(&entry)
+						f.Close()
+						if err != nil {
+							errs <- util.Errorf("%s: %s", name, err)
+							return
+						}
+						if !strings.HasPrefix(entry.Format, "Running on machine") {
+							errs <- util.Errorf("%s: unexpected first entry %+v", name, entry)
+							return
+						}
+					}
+				}()
+			}
+
+			// Rotate with distinct fake times so that every rotation
+			// creates a new file.
+			now := time.Now()
+			sb := lg.file[InfoLevel].(*syncBuffer)
+			for i := 1; i <= rotations; i++ {
+				lg.mu.Lock()
+				err := sb.rotateFile(now.Add(time.Duration(i) * time.Second))
+				lg.mu.Unlock()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			close(done)
+			for i := 0; i < cap(errs); i++ {
+				if err := <-errs; err != nil {
+					t.Errorf("pointer=%t: %s", usePointerFiles, err)
+				}
+			}
+		}()
+	}
+}
+
+// TestGetLogReaderSecondDir verifies that files are found in any of the
+// log directories, and that a missing file is reported as such.
+// TestGetLogReaderErrors verifies that the causes of the errors of
+// GetLogReader can be told apart.
+func TestGetLogReaderErrors(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	for _, tc := range []struct {
+		name  string
+		cause error
+	}{
+		{"/etc/passwd", ErrForbiddenPath},
+		{"../cockroach.host.user.log.INFO.20150609-161049.1", ErrForbiddenPath},
+		{"passwd", ErrNotLogFile},
+		{"cockroach.host.user.log.INFO.20150609-161049.1", os.ErrNotExist},
+	} {
+		_, err := lg.GetLogReader(tc.name, false)
+		if !errors.Is(err, tc.cause) {
+			t.Errorf("%s: expected an error caused by %q; got %v", tc.name, tc.cause, err)
+		}
+		for _, other := range []error{ErrForbiddenPath, ErrNotLogFile, os.ErrNotExist} {
+			if other != tc.cause && errors.Is(err, other) {
+				t.Errorf("%s: unexpected cause %q of %v", tc.name, other, err)
+			}
+		}
+	}
+}
+
+// TestGetLogReaderSubdir verifies that files in subdirectories of the log
+// dirs can be read by their relative paths, which can't lead out of the
+// log dirs.
+func TestGetLogReaderSubdir(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	const name = "cockroach.host.user.log.INFO.20150609-161048.1"
+	subdir := filepath.Join(dir, "archived", "2015-06")
+	if err := os.MkdirAll(subdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(subdir, name), []byte("archived"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A file outside of the log dir, and a symlink to it inside.
+	outside, err := ioutil.TempDir("", "outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := ioutil.WriteFile(filepath.Join(outside, name), []byte("outside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filename := range []string{"archived/2015-06/" + name, "archived/../archived/2015-06/" + name} {
+		reader, err := lg.GetLogReader(filename, false)
+		if err != nil {
+			t.Fatalf("%s: %s", filename, err)
+		}
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "archived" {
+			t.Errorf("%s: expected the archived file; got %q", filename, data)
+		}
+	}
+	for _, test := range []struct {
+		filename string
+		cause    error
+	}{
+		{"../../etc/passwd", ErrForbiddenPath},
+		{"archived/../../" + name, ErrForbiddenPath},
+		{"../" + filepath.Base(outside) + "/" + name, ErrForbiddenPath},
+		{"archived/passwd", ErrNotLogFile},
+		{"archived/" + name, os.ErrNotExist},
+		{"escape/" + name, os.ErrNotExist},
+	} {
+		if _, err := lg.GetLogReader(test.filename, false); !errors.Is(err, test.cause) {
+			t.Errorf("%s: expected an error caused by %q; got %v", test.filename, test.cause, err)
+		}
+	}
+}
+
+// TestListLogFilesOrder verifies that log files are listed newest first,
+// then by name, regardless of the directory holding them.
+func TestListLogFilesOrder(t *testing.T) {
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		dir, err := ioutil.TempDir("", "log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dirs = append(dirs, dir)
+	}
+	lg := NewLogger(dirs...)
+	defer lg.Close()
+	for i, name := range []string{
+		"cockroach.host.user.log.INFO.20150609-161048.1",
+		"cockroach.host.user.log.WARNING.20150609-161050.1",
+		"cockroach.host.user.log.ERROR.20150609-161049.1",
+		"cockroach.host.user.log.INFO.20150609-161050.1",
+		"cockroach.host.user.log.INFO.20150609-161047.1",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dirs[i%2], name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	if exp := []string{
+		"cockroach.host.user.log.INFO.20150609-161050.1",
+		"cockroach.host.user.log.WARNING.20150609-161050.1",
+		"cockroach.host.user.log.ERROR.20150609-161049.1",
+		"cockroach.host.user.log.INFO.20150609-161048.1",
+		"cockroach.host.user.log.INFO.20150609-161047.1",
+	}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected %s; got %s", exp, names)
+	}
+}
+
+func TestGetLogReaderSecondDir(t *testing.T) {
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		dir, err := ioutil.TempDir("", "log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dirs = append(dirs, dir)
+	}
+	lg := NewLogger(dirs...)
+	defer lg.Close()
+	name := "cockroach.host.user.log.INFO.20150609-161048.1"
+	if err := ioutil.WriteFile(filepath.Join(dirs[1], name), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := lg.GetLogReader(name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != "data" {
+		t.Errorf("expected to read the file in the second dir; got %q, %v", data, err)
+	}
+
+	missing := "cockroach.host.user.log.INFO.20150609-161049.1"
+	if _, err := lg.GetLogReader(missing, false); err == nil ||
+		!strings.Contains(err.Error(), "not found in any log dir") {
+		t.Errorf("expected a not found error; got %v", err)
+	}
+}
+
+func TestGetLogReaderAllowedDirs(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Infoc(nil, "x")
+	name, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(name)
+	other, err := ioutil.TempDir("", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(other)
+	// Symlinks are judged by the location of their target.
+	link := filepath.Join(other, filepath.Base(name))
+	if err := os.Symlink(name, link); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(previous []string) { AllowedDirs = previous }(AllowedDirs)
+	for i, test := range []struct {
+		allowed  []string
+		filename string
+		expErr   bool
+	}{
+		{nil, name, false},
+		{[]string{dir}, name, false},
+		{[]string{other, dir}, name, false},
+		{[]string{other}, name, true},
+		{[]string{other}, link, true},
+		{[]string{dir}, link, false},
+		{[]string{dir + "x"}, name, true},
+	} {
+		AllowedDirs = test.allowed
+		reader, err := lg.GetLogReader(test.filename, true /* allowAbsolute */)
+		if (err != nil) != test.expErr {
+			t.Errorf("%d: expected error %t; got %v", i, test.expErr, err)
+		}
+		if reader != nil {
+			reader.Close()
+		}
+	}
+}
+
+func TestFetchEntriesUpToDepth(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	defer func(previous bool) { logging.stackDepth = previous }(logging.stackDepth)
+
+	lg.Infoc(nil, "unrecorded")
+	logging.stackDepth = true
+	var recurse func(n int)
+	recurse = func(n int) {
+		lg.Infoc(nil, "level %d", n)
+		if n < 3 {
+			recurse(n + 1)
+		}
+	}
+	recurse(0)
+	lg.Flush()
+
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	depths := map[string]int{}
+	for i := range entries {
+		depths[formatMessage(&entries[i])] = int(entries[i].GetStackDepth())
+	}
+	if depths["unrecorded"] != 0 {
+		t.Errorf("expected no depth without the flag; got %d", depths["unrecorded"])
+	}
+	for n := 1; n <= 3; n++ {
+		if d, prev := depths[fmt.Sprintf("level %d", n)], depths[fmt.Sprintf("level %d", n-1)]; d != prev+1 {
+			t.Errorf("level %d: expected depth %d; got %d", n, prev+1, d)
+		}
+	}
+
+	entries, err = lg.FetchEntriesUpToDepth(InfoLevel, depths["level 1"], 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for i := range entries {
+		msgs = append(msgs, formatMessage(&entries[i]))
+	}
+	if exp := []string{"level 1", "level 0"}; !reflect.DeepEqual(msgs, exp) {
+		t.Errorf("expected %q; got %q", exp, msgs)
+	}
+}
+
+// TestUniqueFiles forces rotations to reuse the same file name and
+// verifies that every one gets its own file with UniqueFiles.
+func TestUniqueFiles(t *testing.T) {
+	for _, unique := range []bool{false, true} {
+		func() {
+			lg, cleanup := newTestLogger(t)
+			defer cleanup()
+			lg.UniqueFiles = unique
+			lg.Infoc(nil, "x")
+
+			// A time distinct from that of the initial file.
+			now := time.Date(2015, 6, 9, 16, 10, 48, 0, time.Local)
+			sb := lg.file[InfoLevel].(*syncBuffer)
+			names := map[string]struct{}{}
+			for i := 0; i < 3; i++ {
+				lg.mu.Lock()
+				err := sb.rotateFile(now)
+				lg.mu.Unlock()
+				if err != nil {
+					t.Fatal(err)
+				}
+				names[filepath.Base(sb.file.Name())] = struct{}{}
+				active, err := lg.ActiveLogFile(InfoLevel)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if active != sb.file.Name() {
+					t.Errorf("unique=%t: expected active file %s; got %s", unique, sb.file.Name(), active)
+				}
+			}
+			exp := 1
+			if unique {
+				exp = 3
+			}
+			if len(names) != exp {
+				t.Errorf("unique=%t: expected %d distinct files; got %v", unique, exp, names)
+			}
+			files, err := lg.ListLogFiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			seqs := map[int]bool{}
+			for _, file := range files {
+				if _, ok := names[file.Name]; ok {
+					seqs[file.Details.Seq] = true
+				}
+			}
+			if exp := map[int]bool{0: true, 1: true, 2: true}; unique && !reflect.DeepEqual(seqs, exp) {
+				t.Errorf("unexpected sequence numbers %v", seqs)
+			}
+		}()
+	}
+}
+
+func TestDecodeErrorReport(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Warningc(nil, "x")
+	lg.Flush()
+
+	// An older file holding a valid entry, an entry which can't be
+	// unmarshaled and an incomplete last entry.
+	valid := encodeLogEntry(&proto.LogEntry{Severity: int32(warningLog), Time: 1, Format: "valid"})
+	var data []byte
+	data = append(data, valid...)
+	data = append(data, 0, 0, 0, 2, 0xff, 0xff)
+	data = append(data, valid...)
+	data = append(data, valid[:len(valid)-1]...)
+	name := "cockroach.host.user.log.WARNING.20150609-161048.1"
+	if err := ioutil.WriteFile(filepath.Join(lg.logDirs()[0], name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, stats, err := lg.FetchEntriesFromFilesWithStats(WarningLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var valids int
+	for _, entry := range entries {
+		if entry.Format == "valid" {
+			valids++
+		}
+	}
+	if valids != 2 {
+		t.Errorf("expected the 2 valid entries of the corrupt file; got %d", valids)
+	}
+	if stats.DecodeErrors != 2 {
+		t.Errorf("expected 2 decode errors; got %d", stats.DecodeErrors)
+	}
+	report := lg.DecodeErrorReport()
+	if len(report) != 1 || report[0].Name != name || report[0].Count != 2 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestFetchEntriesWithinBytes(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	for _, msg := range []string{"a", strings.Repeat("b", 100), "c", "d"} {
+		lg.Warningc(nil, msg)
+	}
+	lg.Flush()
+
+	defer func(previous int) { EntriesCutoff = previous }(EntriesCutoff)
+	for i, test := range []struct {
+		maxBytes, cutoff int
+		exp              []string
+		expTruncated     bool
+	}{
+		{2, 0, []string{"d", "c"}, true},
+		{101, 0, []string{"d", "c"}, true},
+		{102, 0, []string{"d", "c", strings.Repeat("b", 100)}, true},
+		// The entry count limit hits first.
+		{102, 1, []string{"d"}, true},
+	} {
+		EntriesCutoff = test.cutoff
+		entries, stats, err := lg.FetchEntriesWithinBytes(WarningLevel, test.maxBytes, 0, math.MaxInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msgs []string
+		for j := range entries {
+			msgs = append(msgs, formatMessage(&entries[j]))
+		}
+		if !reflect.DeepEqual(msgs, test.exp) || stats.Truncated != test.expTruncated {
+			t.Errorf("%d: expected %q, truncated=%t; got %q, %+v", i, test.exp, test.expTruncated, msgs, stats)
+		}
+	}
+}
+
+func TestShardedLayout(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Layout = ShardedLayout{Shards: 4}
+
+	// Rotate into files created in the following hours.
+	lg.Infoc(nil, "first")
+	sb := lg.file[InfoLevel].(*syncBuffer)
+	start := time.Now()
+	subdirs := map[string]bool{lg.Layout.Subdir(start): true}
+	for i := 1; i <= 8; i++ {
+		now := start.Add(time.Duration(i) * time.Hour)
+		subdirs[lg.Layout.Subdir(now)] = true
+		lg.mu.Lock()
+		err := sb.rotateFile(now)
+		lg.mu.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(subdirs) < 2 {
+		t.Fatalf("expected files to be spread over shards; got %v", subdirs)
+	}
+	lg.Infoc(nil, "last")
+	lg.Flush()
+
+	dir := lg.logDirs()[0]
+	for subdir := range subdirs {
+		if _, err := os.Stat(filepath.Join(dir, subdir)); err != nil {
+			t.Error(err)
+		}
+	}
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos int
+	for _, file := range files {
+		if file.Details.Level == InfoLevel {
+			infos++
+		}
+	}
+	if infos != 9 {
+		t.Errorf("expected 9 INFO files; got %d", infos)
+	}
+
+	active, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active != sb.file.Name() || filepath.Dir(active) == dir {
+		t.Errorf("expected active file %s in a shard; got %s", sb.file.Name(), active)
+	}
+	if _, err := lg.GetLogReader(filepath.Base(active), false /* !allowAbsolute */); err != nil {
+		t.Error(err)
+	}
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for _, entry := range entries {
+		if entry.Format == "first" || entry.Format == "last" {
+			msgs = append(msgs, entry.Format)
+		}
+	}
+	if exp := []string{"last", "first"}; !reflect.DeepEqual(msgs, exp) {
+		t.Errorf("expected %s; got %s", exp, msgs)
+	}
+}
+
+func TestRotationRateLimit(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.MaxSize = 1
+	lg.UniqueFiles = true
+	lg.MaxRotationsPerMinute = 3
+
+	for i := 0; i < 20; i++ {
+		lg.Infoc(nil, "entry %d", i)
+	}
+	lg.Flush()
+
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1+lg.MaxRotationsPerMinute {
+		t.Errorf("expected %d files; got %d", 1+lg.MaxRotationsPerMinute, len(files))
+	}
+	if rate := lg.RotationRate(); rate != lg.MaxRotationsPerMinute {
+		t.Errorf("expected rotation rate %d; got %d", lg.MaxRotationsPerMinute, rate)
+	}
+
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, 0, time.Now().UnixNano())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings, logged int
+	for _, e := range entries {
+		switch {
+		case strings.Contains(e.Format, "appending past the size limit"):
+			warnings++
+		case strings.HasPrefix(e.Format, "entry"):
+			logged++
+		}
+	}
+	if warnings != 1 || logged != 20 {
+		t.Errorf("expected 1 warning and 20 entries; got %d and %d", warnings, logged)
+	}
+}
+
+// TestRotationByAge verifies that files older than MaxAge are rotated
+// even though they're below MaxSize.
+func TestRotationByAge(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.MaxAge = 24 * time.Hour
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+
+	lg.Infoc(nil, "first")
+	first, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for _, tc := range []struct {
+		offset  time.Duration
+		rotated bool
+	}{
+		{time.Hour, false},
+		{25 * time.Hour, true},
+		{26 * time.Hour, false},
+		{49 * time.Hour, true},
+	} {
+		now := start.Add(tc.offset)
+		timeNow = func() time.Time { return now }
+		lg.Infoc(nil, "entry")
+		name, err := lg.ActiveLogFile(InfoLevel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rotated := name != first; rotated != tc.rotated {
+			t.Errorf("%s: expected rotated=%t; got %t", tc.offset, tc.rotated, rotated)
+		}
+		if tc.rotated {
+			// The new file is named after the time of the rotation.
+			details, err := parseLogFilename(filepath.Base(name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := now.Truncate(time.Second).UnixNano(); details.Time != exp {
+				t.Errorf("%s: expected file time %d; got %d", tc.offset, exp, details.Time)
+			}
+		}
+		first = name
+	}
+}
+
+func TestFetchEntriesWithGaps(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	start := time.Date(2015, 6, 9, 16, 10, 0, 0, time.UTC)
+	var data []byte
+	for _, offset := range []time.Duration{0, time.Second, time.Hour, time.Hour + time.Second} {
+		entry := proto.LogEntry{
+			Severity: int32(infoLog),
+			Time:     start.Add(offset).UnixNano(),
+			Format:   offset.String(),
+		}
+		data = append(data, encodeLogEntry(&entry)...)
+	}
+	name := filepath.Join(lg.logDirs()[0], "cockroach.host.user.log.INFO.20150609-161000.1")
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := lg.FetchEntriesWithGaps(InfoLevel, time.Minute, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for _, entry := range entries {
+		msg := formatMessage(&entry)
+		if Level(entry.Severity) == GapLevel {
+			msg = "[" + msg + "]"
+		}
+		msgs = append(msgs, msg)
+	}
+	if exp := []string{"1h0m1s", "1h0m0s", "[gap of 59m59s]", "1s", "0s"}; !reflect.DeepEqual(msgs, exp) {
+		t.Errorf("expected %q; got %q", exp, msgs)
+	}
+}
+
+func TestListLogFilesInRange(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	start := time.Date(2015, 6, 9, 16, 0, 0, 0, time.Local)
+	for _, fixture := range []struct {
+		name     string
+		modified time.Time
+	}{
+		// Entirely before the window.
+		{"cockroach.host.user.log.INFO.20150609-160000.1", start.Add(10 * time.Minute)},
+		// Straddling the start of the window.
+		{"cockroach.host.user.log.INFO.20150609-161000.1", start.Add(30 * time.Minute)},
+		// Inside the window.
+		{"cockroach.host.user.log.INFO.20150609-163000.1", start.Add(40 * time.Minute)},
+		// Straddling the end of the window.
+		{"cockroach.host.user.log.INFO.20150609-164000.1", start.Add(2 * time.Hour)},
+		// Entirely after the window.
+		{"cockroach.host.user.log.INFO.20150609-180000.1", start.Add(3 * time.Hour)},
+		// Unknown range, as the file was modified before its creation,
+		// up to the creation of the next file.
+		{"cockroach.host.user.log.INFO.20150609-165000.1", start},
+		// Of another level.
+		{"cockroach.host.user.log.ERROR.20150609-163000.1", start.Add(40 * time.Minute)},
+	} {
+		name := filepath.Join(lg.logDirs()[0], fixture.name)
+		if err := ioutil.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, fixture.modified, fixture.modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := lg.ListLogFilesInRange(InfoLevel,
+		start.Add(20*time.Minute).UnixNano(), start.Add(time.Hour).UnixNano())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	exp := []string{
+		"cockroach.host.user.log.INFO.20150609-165000.1",
+		"cockroach.host.user.log.INFO.20150609-164000.1",
+		"cockroach.host.user.log.INFO.20150609-163000.1",
+		"cockroach.host.user.log.INFO.20150609-161000.1",
+	}
+	if !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected %s; got %s", exp, names)
+	}
+}
+
+// TestListLogFilesInRangeUnknownSpans verifies that files copied without
+// their modification times, spanning days, are pruned by the creation
+// times of the next files of their processes.
+func TestListLogFilesInRangeUnknownSpans(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	start := time.Date(2015, 6, 9, 0, 0, 0, 0, time.Local)
+	write := func(t *testing.T, name string) {
+		name = filepath.Join(lg.logDirs()[0], name)
+		if err := ioutil.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Before the creation times of all the files.
+		modified := start.Add(-time.Hour)
+		if err := os.Chtimes(name, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hourly := func(pid, hour int) string {
+		return fmt.Sprintf("cockroach.host.user.log.INFO.%s.%d",
+			start.Add(time.Duration(hour)*time.Hour).Format("20060102-150405"), pid)
+	}
+	// Three days of hourly files of one process, and a file of another,
+	// the newest of its process.
+	for hour := 0; hour < 72; hour++ {
+		write(t, hourly(1, hour))
+	}
+	write(t, hourly(2, 10))
+
+	files, err := lg.ListLogFilesInRange(InfoLevel,
+		start.Add(30*time.Hour).UnixNano(), start.Add(31*time.Hour+30*time.Minute).UnixNano())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	// The file of hour 29 spans up to the creation of the next one, the
+	// start of the range.
+	exp := []string{hourly(1, 31), hourly(1, 30), hourly(1, 29), hourly(2, 10)}
+	if !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected %s; got %s", exp, names)
+	}
+}
+
+// TestFetchEntriesOfWorseLevels verifies that fetching the entries of a
+// level also returns those of worse levels whose files are the only ones
+// holding them, without duplicating those found in several files.
+func TestFetchEntriesOfWorseLevels(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	entry := func(sev severity, sec int, msg string) []byte {
+		return encodeLogEntry(&proto.LogEntry{
+			Severity: int32(sev),
+			Time:     time.Unix(int64(1433866200+sec), 0).UnixNano(),
+			Format:   msg,
+		})
+	}
+	both := entry(errorLog, 3, "error in both")
+	for name, data := range map[string][]byte{
+		"cockroach.host.user.log.INFO.20150609-161000.1":    entry(infoLog, 1, "info"),
+		"cockroach.host.user.log.WARNING.20150609-161000.1": append(entry(warningLog, 2, "warning"), both...),
+		"cockroach.host.user.log.ERROR.20150609-161000.1":   append(append([]byte(nil), both...), entry(errorLog, 4, "error only")...),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(lg.logDirs()[0], name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := lg.FetchEntriesFromFiles(WarningLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for _, entry := range entries {
+		msgs = append(msgs, entry.Format)
+	}
+	if exp := []string{"error only", "error in both", "warning"}; !reflect.DeepEqual(msgs, exp) {
+		t.Errorf("expected %q; got %q", exp, msgs)
+	}
+}
+
+// BenchmarkReadAllEntriesFromFile guards against reading a file taking
+// time quadratic in its number of entries.
+func BenchmarkReadAllEntriesFromFile(b *testing.B) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lg := NewLogger(dir)
+	defer lg.Close()
+
+	const numEntries = 100000
+	var data []byte
+	for i := 0; i < numEntries; i++ {
+		data = append(data, encodeLogEntry(&proto.LogEntry{
+			Severity: int32(infoLog),
+			Time:     int64(i),
+			File:     "file.go",
+			Line:     int32(i),
+			Format:   "entry %d",
+			Args:     []proto.LogEntry_Arg{{Str: strconv.Itoa(i)}},
+		})...)
+	}
+	name := "cockroach.host.user.log.INFO.20150609-161048.1"
+	if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		b.Fatal(err)
+	}
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		entries, _, err := lg.readAllEntriesFromFile(files[0], 0, math.MaxInt64, 0, fetchOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(entries) != numEntries {
+			b.Fatalf("expected %d entries; got %d", numEntries, len(entries))
+		}
+	}
+}
+
+func TestListLogFilesFiltered(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	names := []string{
+		"cockroach.host_a.user.log.INFO.20150609-161000.1",
+		"cockroach.host_a.user.log.ERROR.20150609-161000.1",
+		"cockroach.host_b.user.log.WARNING.20150609-161000.2",
+		"other.host_a.admin.log.INFO.20150609-161000.3",
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(lg.logDirs()[0], name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, test := range []struct {
+		filter FileFilter
+		exp    []int
+	}{
+		{FileFilter{}, []int{0, 1, 2, 3}},
+		{FileFilter{Program: "cockroach"}, []int{0, 1, 2}},
+		{FileFilter{Host: "host.a"}, []int{0, 1, 3}},
+		{FileFilter{UserName: "admin"}, []int{3}},
+		{FileFilter{MinLevel: WarningLevel}, []int{1, 2}},
+		{FileFilter{Program: "cockroach", Host: "host_a", MinLevel: ErrorLevel}, []int{1}},
+	} {
+		files, err := lg.ListLogFilesFiltered(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for _, file := range files {
+			got[file.Name] = true
+		}
+		exp := map[string]bool{}
+		for _, j := range test.exp {
+			exp[names[j]] = true
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("%d: expected %v; got %v", i, exp, got)
+		}
+	}
+}
+
+func TestFetchEntriesFromFilesContext(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Infoc(nil, "x")
+	lg.Flush()
+
+	entries, err := lg.FetchEntriesFromFilesContext(context.Background(), InfoLevel, 0, math.MaxInt64)
+	if err != nil || len(entries) == 0 {
+		t.Errorf("expected entries; got %+v, %v", entries, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := lg.FetchEntriesFromFilesContext(ctx, InfoLevel, 0, math.MaxInt64); err != context.Canceled {
+		t.Errorf("expected %v; got %v", context.Canceled, err)
+	}
+}
+
+func TestSplitLogDirs(t *testing.T) {
+	for _, test := range []struct {
+		s   string
+		exp []string
+	}{
+		{"", nil},
+		{"/a", []string{"/a"}},
+		{"/a,/b", []string{"/a", "/b"}},
+		{" /a , ,/b,", []string{"/a", "/b"}},
+	} {
+		if dirs := splitLogDirs(test.s); !reflect.DeepEqual(dirs, test.exp) {
+			t.Errorf("%q: expected %q; got %q", test.s, test.exp, dirs)
+		}
+	}
+}
+
+// TestCreateFallsBackToNextDir verifies that files are created in the
+// next log directory when one can't be written to.
+func TestCreateFallsBackToNextDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A regular file in place of the first directory can't hold files.
+	notDir := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(notDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	lg := NewLogger(notDir, dir)
+	defer lg.Close()
+	lg.Infoc(nil, "x")
+	name, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(name) != dir {
+		t.Errorf("expected the file in %s; got %s", dir, name)
+	}
+}
+
+// TestCreateSkipsReadOnlyDir verifies that files land in the second log
+// directory if the first one is read-only.
+func TestCreateSkipsReadOnlyDir(t *testing.T) {
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		dir, err := ioutil.TempDir("", "log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dirs = append(dirs, dir)
+	}
+	if err := os.Chmod(dirs[0], 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dirs[0], 0755)
+	if f, err := os.Create(filepath.Join(dirs[0], "probe")); err == nil {
+		f.Close()
+		t.Skip("permissions aren't enforced for this user")
+	}
+
+	lg := NewLogger(dirs...)
+	defer lg.Close()
+	lg.Infoc(nil, "x")
+	lg.Flush()
+	files, err := ioutil.ReadDir(dirs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logFiles int
+	for _, file := range files {
+		if logFileRE.MatchString(file.Name()) {
+			logFiles++
+		}
+	}
+	if logFiles != 1 {
+		t.Errorf("expected a log file in the second dir; got %d", logFiles)
+	}
+}
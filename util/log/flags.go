@@ -29,5 +29,9 @@ func init() {
 	// pf.Var(&logging.stderrThreshold, "log-threshold", "logs at or above this threshold go to stderr")
 	flag.Var(&logging.vmodule, "vmodule", "comma-separated list of file=N settings for file-filtered logging")
 	flag.Var(&logging.traceLocation, "log-backtrace-at", "when logging hits line file:N, emit a stack trace")
-	flag.StringVar(logDir, "log-dir", "", "if non-empty, write log files in this directory") // in util/log/file.go
+	flag.BoolVar(&logging.stackDepth, "log-stack-depth", false, "record the depth of the stack at each logging call")
+	flag.StringVar(logDir, "log-dir", "", "if non-empty, write log files in this directory, or in the first "+
+		"writable one of a comma-separated list of directories") // in util/log/file.go
+	flag.StringVar(&syslogAddr, "log-syslog", "", "if non-empty, also forward log entries to the syslog server "+
+		"at this address, given as [udp://|tcp://]host:port") // in util/log/syslog.go
 }
@@ -0,0 +1,120 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"golang.org/x/net/context"
+)
+
+// followPollInterval is how often TailEntries checks for new entries and
+// for rotations once it has caught up with the active file.
+var followPollInterval = 100 * time.Millisecond
+
+// TailEntries follows the active log file of the given level. See
+// Logger.TailEntries.
+func TailEntries(level Level, ctx context.Context) (<-chan proto.LogEntry, error) {
+	return defaultLogger.TailEntries(level, ctx)
+}
+
+// TailEntries follows the Logger's active log file of the given level,
+// like "tail -f": the entries already in the file are sent on the
+// returned channel, followed by the entries appended to it as they
+// appear. When the file is rotated, the rest of the old file is sent
+// and the new file is followed from its beginning. Entries only appear
+// once the Logger has flushed them; an entry flushed in part is sent once
+// the rest of it is (see EntryDecoder.Tailing). The channel is closed once ctx is
+// done or the file can't be read any longer.
+func (lg *Logger) TailEntries(level Level, ctx context.Context) (<-chan proto.LogEntry, error) {
+	name, err := lg.ActiveLogFile(level)
+	if err != nil {
+		return nil, err
+	}
+	f, err := lg.fileSystem().Open(name)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(chan proto.LogEntry)
+	go func() {
+		defer close(entries)
+		lg.follow(ctx, level, f, name, entries)
+	}()
+	return entries, nil
+}
+
+// follow sends the entries of the file on the channel, switching to the
+// new active file of the level on rotation, until ctx is done. It closes
+// the file it reads last.
+func (lg *Logger) follow(ctx context.Context, level Level, f io.ReadCloser, name string, entries chan<- proto.LogEntry) {
+	defer func() { f.Close() }()
+	decoder := &EntryDecoder{in: f, Tailing: true}
+	for {
+		var entry proto.LogEntry
+		err := decoder.Decode(&entry)
+		if err == nil {
+			select {
+			case entries <- entry:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err != io.EOF && err != ErrIncompleteEntry {
+			return
+		}
+		// Caught up with the file. The last entry may have been partially
+		// flushed, in which case the decoder reads it again later.
+		if active, err := lg.ActiveLogFile(level); err == nil && active != name {
+			// The file was rotated. The entries written to it between the
+			// last read and the rotation are sent before switching.
+			if err := lg.drain(ctx, decoder, entries); err != nil {
+				return
+			}
+			newFile, err := lg.fileSystem().Open(active)
+			if err != nil {
+				return
+			}
+			f.Close()
+			f, name = newFile, active
+			decoder = &EntryDecoder{in: f, Tailing: true}
+			continue
+		}
+		select {
+		case <-time.After(followPollInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// drain sends the remaining complete entries read by the decoder on the
+// channel. It returns an error if ctx is done first.
+func (lg *Logger) drain(ctx context.Context, decoder *EntryDecoder, entries chan<- proto.LogEntry) error {
+	for {
+		var entry proto.LogEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return nil
+		}
+		select {
+		case entries <- entry:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
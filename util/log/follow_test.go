@@ -0,0 +1,89 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"golang.org/x/net/context"
+)
+
+// receiveMessages receives entries until one with each of the messages
+// was seen, in order, skipping others, and fails the test on timeout.
+func receiveMessages(t *testing.T, entries <-chan proto.LogEntry, msgs ...string) {
+	timeout := time.After(5 * time.Second)
+	for len(msgs) > 0 {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				t.Fatalf("channel closed while waiting for %q", msgs)
+			}
+			if entry.Format == msgs[0] {
+				msgs = msgs[1:]
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %q", msgs)
+		}
+	}
+}
+
+func TestTailEntries(t *testing.T) {
+	defer func(previous time.Duration) { followPollInterval = previous }(followPollInterval)
+	followPollInterval = time.Millisecond
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Infoc(nil, "existing")
+	lg.Flush()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, err := lg.TailEntries(InfoLevel, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiveMessages(t, entries, "existing")
+
+	lg.Infoc(nil, "appended")
+	lg.Flush()
+	receiveMessages(t, entries, "appended")
+
+	// Rotate to a file with a later name, leaving an entry in the old one
+	// which is only flushed by the rotation.
+	lg.Infoc(nil, "before rotation")
+	lg.mu.Lock()
+	err = lg.file[infoLog].(*syncBuffer).rotateFile(time.Now().Add(time.Hour))
+	lg.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg.Infoc(nil, "after rotation")
+	lg.Flush()
+	receiveMessages(t, entries, "before rotation", "after rotation")
+
+	cancel()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-entries:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("channel not closed after cancellation")
+		}
+	}
+}
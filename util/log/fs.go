@@ -0,0 +1,126 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// A fileSystem is what the Logger creates, lists and reads its log files
+// on. Loggers use the operating system's by default; tests can inject an
+// in-memory one.
+type fileSystem interface {
+	// Open opens the named file for reading.
+	Open(name string) (io.ReadCloser, error)
+	// OpenFile opens the named file with the flags and, if it's created,
+	// the permissions of os.OpenFile.
+	OpenFile(name string, flag int, perm os.FileMode) (fsFile, error)
+	Stat(name string) (os.FileInfo, error)
+	// Lstat is like Stat, but describes symlinks rather than their targets.
+	Lstat(name string) (os.FileInfo, error)
+	// ReadDir returns the entries of the directory, sorted by name.
+	ReadDir(dirname string) ([]os.FileInfo, error)
+	MkdirAll(path string, perm os.FileMode) error
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+	Link(oldname, newname string) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+}
+
+// An fsFile is a file opened for writing by a fileSystem.
+type fsFile interface {
+	io.WriteCloser
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+}
+
+// osFileSystem is the fileSystem of the operating system.
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (io.ReadCloser, error) {
+	// The *os.File is returned as is, so that readers can still seek in it.
+	return os.Open(name)
+}
+
+func (osFileSystem) OpenFile(name string, flag int, perm os.FileMode) (fsFile, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		// Avoid returning a non-nil interface holding a nil *os.File.
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osFileSystem) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dirname)
+}
+
+func (osFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFileSystem) Symlink(oldname, newname string) error {
+	return symlink(oldname, newname)
+}
+
+func (osFileSystem) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (osFileSystem) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+func (osFileSystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// fileSystem returns the fileSystem the Logger's files are on.
+func (lg *Logger) fileSystem() fileSystem {
+	if lg.fs == nil {
+		return osFileSystem{}
+	}
+	return lg.fs
+}
+
+// writeFile writes data to the named file on fs like ioutil.WriteFile.
+func writeFile(fs fileSystem, name string, data []byte, perm os.FileMode) error {
+	f, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	return err
+}
@@ -0,0 +1,407 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// memFileSystem is an in-memory fileSystem. Symlinks are followed by
+// Open and Stat and listed by ReadDir, unlike directories. Files opened for reading see what is appended to them later,
+// so that they can be followed.
+type memFileSystem struct {
+	mu    sync.Mutex
+	files map[string]*memFileData
+	links map[string]string
+	dirs  map[string]bool
+}
+
+type memFileData struct {
+	data    []byte
+	modTime time.Time
+}
+
+func newMemFileSystem() *memFileSystem {
+	return &memFileSystem{
+		files: map[string]*memFileData{},
+		links: map[string]string{},
+		dirs:  map[string]bool{},
+	}
+}
+
+// resolve returns the name of the file a name refers to. mu must be held.
+func (fs *memFileSystem) resolve(name string) string {
+	if target, ok := fs.links[name]; ok {
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(name), target)
+		}
+		return target
+	}
+	return name
+}
+
+func (fs *memFileSystem) lookup(op, name string) (*memFileData, error) {
+	d, ok := fs.files[fs.resolve(name)]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return d, nil
+}
+
+func (fs *memFileSystem) Open(name string) (io.ReadCloser, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	d, err := fs.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &memReader{fs: fs, d: d}, nil
+}
+
+func (fs *memFileSystem) OpenFile(name string, flag int, perm os.FileMode) (fsFile, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	d, err := fs.lookup("open", name)
+	if err != nil {
+		if flag&os.O_CREATE == 0 {
+			return nil, err
+		}
+		d = &memFileData{modTime: time.Now()}
+		fs.files[fs.resolve(name)] = d
+	} else if flag&os.O_EXCL != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+	if flag&os.O_TRUNC != 0 {
+		d.data = nil
+	}
+	return &memFile{fs: fs, name: name, d: d}, nil
+}
+
+func (fs *memFileSystem) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.dirs[filepath.Clean(name)] {
+		return memFileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	d, err := fs.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return memFileInfo{name: filepath.Base(name), d: d}, nil
+}
+
+func (fs *memFileSystem) Lstat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	if _, ok := fs.links[name]; ok {
+		fs.mu.Unlock()
+		return memFileInfo{name: filepath.Base(name), link: true}, nil
+	}
+	fs.mu.Unlock()
+	return fs.Stat(name)
+}
+
+func (fs *memFileSystem) ReadDir(dirname string) ([]os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var infos []os.FileInfo
+	for name, d := range fs.files {
+		if filepath.Dir(name) == filepath.Clean(dirname) {
+			infos = append(infos, memFileInfo{name: filepath.Base(name), d: d})
+		}
+	}
+	for name := range fs.links {
+		if filepath.Dir(name) == filepath.Clean(dirname) {
+			infos = append(infos, memFileInfo{name: filepath.Base(name), link: true})
+		}
+	}
+	sort.Sort(byName(infos))
+	return infos, nil
+}
+
+func (fs *memFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for dir := filepath.Clean(path); !fs.dirs[dir]; dir = filepath.Dir(dir) {
+		fs.dirs[dir] = true
+	}
+	return nil
+}
+
+func (fs *memFileSystem) Symlink(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.links[newname] = oldname
+	return nil
+}
+
+func (fs *memFileSystem) Readlink(name string) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if target, ok := fs.links[name]; ok {
+		return target, nil
+	}
+	if _, ok := fs.files[name]; ok {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrNotExist}
+}
+
+func (fs *memFileSystem) Link(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	d, err := fs.lookup("link", oldname)
+	if err != nil {
+		return err
+	}
+	if _, ok := fs.files[newname]; ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	fs.files[newname] = d
+	return nil
+}
+
+func (fs *memFileSystem) Rename(oldpath, newpath string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if target, ok := fs.links[oldpath]; ok {
+		delete(fs.links, oldpath)
+		fs.links[newpath] = target
+		return nil
+	}
+	d, ok := fs.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	delete(fs.files, oldpath)
+	fs.files[newpath] = d
+	return nil
+}
+
+func (fs *memFileSystem) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.links[name]; ok {
+		delete(fs.links, name)
+		return nil
+	}
+	if _, ok := fs.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(fs.files, name)
+	return nil
+}
+
+// memFile is a file of a memFileSystem opened for writing.
+type memFile struct {
+	fs   *memFileSystem
+	name string
+	d    *memFileData
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.d.data = append(f.d.data, p...)
+	f.d.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Name() string { return f.name }
+func (f *memFile) Sync() error  { return nil }
+func (f *memFile) Close() error { return nil }
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return memFileInfo{name: filepath.Base(f.name), d: f.d}, nil
+}
+
+// memReader reads a file of a memFileSystem.
+type memReader struct {
+	fs  *memFileSystem
+	d   *memFileData
+	off int
+}
+
+func (r *memReader) Read(p []byte) (int, error) {
+	r.fs.mu.Lock()
+	defer r.fs.mu.Unlock()
+	if r.off >= len(r.d.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.d.data[r.off:])
+	r.off += n
+	return n, nil
+}
+
+func (r *memReader) Close() error { return nil }
+
+// memFileInfo describes a file, or a directory or symlink, of a
+// memFileSystem.
+type memFileInfo struct {
+	name string
+	d    *memFileData
+	dir  bool
+	link bool
+}
+
+func (fi memFileInfo) Name() string { return fi.name }
+func (fi memFileInfo) IsDir() bool  { return fi.dir }
+
+func (fi memFileInfo) Size() int64 {
+	if fi.d == nil {
+		return 0
+	}
+	return int64(len(fi.d.data))
+}
+
+func (fi memFileInfo) Mode() os.FileMode {
+	switch {
+	case fi.dir:
+		return os.ModeDir | 0775
+	case fi.link:
+		return os.ModeSymlink | 0777
+	}
+	return 0664
+}
+
+func (fi memFileInfo) ModTime() time.Time {
+	if fi.d == nil {
+		return time.Time{}
+	}
+	return fi.d.modTime
+}
+
+func (fi memFileInfo) Sys() interface{} { return nil }
+
+type byName []os.FileInfo
+
+func (a byName) Len() int           { return len(a) }
+func (a byName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool { return a[i].Name() < a[j].Name() }
+
+// TestInMemoryFileSystem verifies that a Logger on an injected
+// fileSystem creates, lists and reads its files on it alone.
+func TestInMemoryFileSystem(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	fs := newMemFileSystem()
+	lg.fs = fs
+	dir := lg.logDirs()[0]
+
+	lg.Infoc(nil, "in memory")
+	lg.Flush()
+
+	if infos, err := ioutil.ReadDir(dir); err != nil {
+		t.Fatal(err)
+	} else if len(infos) != 0 {
+		t.Errorf("expected no files on disk; got %d", len(infos))
+	}
+
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Details.Level != InfoLevel {
+		t.Fatalf("expected the INFO log file; got %+v", files)
+	}
+	if _, ok := fs.files[filepath.Join(dir, files[0].Name)]; !ok {
+		t.Errorf("expected %s on the in-memory file system", files[0].Name)
+	}
+	if _, ok := fs.links[filepath.Join(dir, lg.linkNames("INFO")[0])]; !ok {
+		t.Error("expected the INFO symlink on the in-memory file system")
+	}
+
+	rc, err := lg.GetLogReader(files[0].Name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, entry := range entries {
+		found = found || entry.Format == "in memory"
+	}
+	if !found {
+		t.Errorf("expected the logged entry among %+v", entries)
+	}
+}
+
+// TestInMemoryFileSystemActiveFile verifies that the active files are
+// looked up, followed and validated on an injected fileSystem.
+func TestInMemoryFileSystemActiveFile(t *testing.T) {
+	defer func(previous time.Duration) { followPollInterval = previous }(followPollInterval)
+	followPollInterval = time.Millisecond
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	fs := newMemFileSystem()
+	lg.fs = fs
+	dir := lg.logDirs()[0]
+
+	sub := filepath.Join(dir, "sub")
+	if err := lg.ValidateLogDir(sub); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sub); !os.IsNotExist(err) {
+		t.Errorf("expected %s not to be created on disk; got %v", sub, err)
+	}
+
+	lg.Infoc(nil, "existing")
+	lg.Flush()
+	active, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, lg.linkNames("INFO")[0])
+	if name, err := readLink(fs, link); err != nil || filepath.Join(dir, name) != active {
+		t.Errorf("expected the INFO symlink to point at %s; got %s, %v", active, name, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries, err := lg.TailEntries(InfoLevel, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiveMessages(t, entries, "existing")
+	lg.Infoc(nil, "appended")
+	lg.Flush()
+	receiveMessages(t, entries, "appended")
+
+	lg.mu.Lock()
+	err = lg.file[infoLog].(*syncBuffer).rotateFile(time.Now().Add(time.Hour))
+	lg.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg.Infoc(nil, "after rotation")
+	lg.Flush()
+	receiveMessages(t, entries, "after rotation")
+}
@@ -0,0 +1,216 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GCLogFiles removes old log files of the default Logger. See
+// Logger.GCLogFiles.
+func GCLogFiles(maxAgeNanos, maxTotalBytes int64, dryRun bool) ([]RemovedFile, error) {
+	return defaultLogger.GCLogFiles(maxAgeNanos, maxTotalBytes, dryRun)
+}
+
+// A RemovedFile describes a log file removed by GCLogFiles, or which it
+// would remove in a dry run.
+type RemovedFile struct {
+	Name      string // base name
+	AgeNanos  int64  // time since the file was last modified
+	SizeBytes int64
+}
+
+// GCLogFiles applies a retention policy to the Logger's log files: the
+// files last modified more than maxAgeNanos ago are removed, and then, if
+// the log files still take up more than maxTotalBytes, the oldest ones
+// are removed until they don't. Either limit is disabled if not positive.
+// Only the files of this program are considered, as the log directory may
+// be shared with other programs, and the files of each host and user are
+// held to maxTotalBytes separately, so that a noisy process sharing the
+// directory doesn't push out the history of the others. The files targeted by any symlink or
+// pointer file in the directory, including those of other processes
+// sharing it, and the files the Logger writes to are never removed, even
+// if that leaves the files over budget. The removed files are
+// returned, with their ages and sizes, so that the caller can log them.
+// With dryRun, the files which would be removed are returned but left in
+// place, so that operators can check a policy before enabling it, and a
+// summary of them is logged through the package-level Infof, never
+// through the Logger whose files are collected.
+func (lg *Logger) GCLogFiles(maxAgeNanos, maxTotalBytes int64, dryRun bool) ([]RemovedFile, error) {
+	return lg.GCLogFilesWithRetention(Retention{DefaultMaxAgeNanos: maxAgeNanos}, maxTotalBytes, dryRun)
+}
+
+// A Retention gives the maximum ages of log files by their level, so
+// that, say, ERROR files can be kept for months while INFO files are kept
+// for days. A maximum age which isn't positive disables age-based removal.
+type Retention struct {
+	// MaxAgeNanos holds the maximum ages of the files of some levels.
+	MaxAgeNanos map[Level]int64
+	// DefaultMaxAgeNanos is the maximum age of the files of the levels
+	// missing from MaxAgeNanos.
+	DefaultMaxAgeNanos int64
+}
+
+// maxAge returns the maximum age of the files of the level.
+func (r Retention) maxAge(level Level) int64 {
+	if maxAge, ok := r.MaxAgeNanos[level]; ok {
+		return maxAge
+	}
+	return r.DefaultMaxAgeNanos
+}
+
+// GCLogFilesWithRetention removes old log files of the default Logger.
+// See Logger.GCLogFilesWithRetention.
+func GCLogFilesWithRetention(retention Retention, maxTotalBytes int64, dryRun bool) ([]RemovedFile, error) {
+	return defaultLogger.GCLogFilesWithRetention(retention, maxTotalBytes, dryRun)
+}
+
+// GCLogFilesWithRetention is like GCLogFiles, but removes the files
+// last modified longer ago than the maximum age the retention gives for
+// their level.
+func (lg *Logger) GCLogFilesWithRetention(retention Retention, maxTotalBytes int64, dryRun bool) ([]RemovedFile, error) {
+	fs := lg.fileSystem()
+	var files []gcFile
+	var totalBytes int64
+	groupBytes := map[gcGroup]int64{}
+	protected := lg.activeFiles()
+	for _, dir := range lg.searchDirs() {
+		infos, err := fs.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, info := range appendLogFiles(nil, infos, FileFilter{Program: program}) {
+			files = append(files, gcFile{filepath.Join(dir, info.Name), info})
+			totalBytes += info.SizeBytes
+			groupBytes[groupOf(info.Details)] += info.SizeBytes
+		}
+		for name := range linkedFiles(fs, dir, infos) {
+			protected[name] = true
+		}
+	}
+	sort.Sort(gcFilesByTime(files))
+
+	var removed []RemovedFile
+	var removedBytes int64
+	now := timeNow().UnixNano()
+	for _, file := range files {
+		if protected[file.path] {
+			continue
+		}
+		age := now - file.ModTimeNanos
+		maxAge := retention.maxAge(file.Details.Level)
+		expired := maxAge > 0 && age > maxAge
+		group := groupOf(file.Details)
+		overBudget := maxTotalBytes > 0 && groupBytes[group] > maxTotalBytes
+		if !expired && !overBudget {
+			continue
+		}
+		if !dryRun {
+			if err := fs.Remove(file.path); err != nil {
+				return removed, err
+			}
+			for _, suffix := range indexSuffixes {
+				_ = fs.Remove(file.path + suffix) // ignore err
+			}
+		}
+		removed = append(removed, RemovedFile{Name: file.Name, AgeNanos: age, SizeBytes: file.SizeBytes})
+		totalBytes -= file.SizeBytes
+		groupBytes[group] -= file.SizeBytes
+		removedBytes += file.SizeBytes
+	}
+	if dryRun {
+		Infof("log GC dry run: would remove %d of %d log files, %d bytes, leaving %d bytes",
+			len(removed), len(files), removedBytes, totalBytes)
+	}
+	return removed, nil
+}
+
+// activeFiles returns the paths of the files which must not be removed:
+// those targeted by the symlinks or pointer files of the levels and those
+// the Logger has open.
+func (lg *Logger) activeFiles() map[string]bool {
+	active := map[string]bool{}
+	for level := InfoLevel; level <= FatalLevel; level++ {
+		if name, err := lg.ActiveLogFile(level); err == nil {
+			active[filepath.Clean(name)] = true
+		}
+	}
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	for _, file := range lg.file {
+		if sb, ok := file.(*syncBuffer); ok && sb.file != nil {
+			active[filepath.Clean(sb.file.Name())] = true
+		}
+	}
+	return active
+}
+
+// linkedFiles returns the paths of the files in dir targeted by the
+// symlinks and pointer files among its entries, whichever program or
+// process wrote them.
+func linkedFiles(fs fileSystem, dir string, infos []os.FileInfo) map[string]bool {
+	linked := map[string]bool{}
+	for _, info := range infos {
+		var read func(fileSystem, string) (string, error)
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			read = readLink
+		case info.Mode().IsRegular() && strings.HasSuffix(info.Name(), pointerFileSuffix):
+			read = readPointerFile
+		default:
+			continue
+		}
+		name, err := read(fs, filepath.Join(dir, info.Name()))
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		linked[filepath.Clean(name)] = true
+	}
+	return linked
+}
+
+// A gcGroup is the program, host and user of a set of log files held to
+// a size budget together.
+type gcGroup struct {
+	program, host, userName string
+}
+
+// groupOf returns the gcGroup of a log file.
+func groupOf(details FileDetails) gcGroup {
+	return gcGroup{details.Program, details.Host, details.UserName}
+}
+
+// A gcFile is a log file considered for removal by GCLogFiles.
+type gcFile struct {
+	path string
+	FileInfo
+}
+
+// gcFilesByTime sorts gcFiles by the creation time encoded in their names.
+type gcFilesByTime []gcFile
+
+func (a gcFilesByTime) Len() int           { return len(a) }
+func (a gcFilesByTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a gcFilesByTime) Less(i, j int) bool { return a[i].Details.Time < a[j].Details.Time }
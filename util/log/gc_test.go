@@ -0,0 +1,322 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// writeGCFixtures writes log files of the given sizes, created an hour
+// apart and last modified when created, oldest first, and returns their
+// names.
+func writeGCFixtures(t *testing.T, dir string, sizes ...int) []string {
+	return writeGCLevelFixtures(t, dir, InfoLevel, sizes...)
+}
+
+// writeGCLevelFixtures is like writeGCFixtures, but writes files of the
+// given level.
+func writeGCLevelFixtures(t *testing.T, dir string, level Level, sizes ...int) []string {
+	return writeGCPrefixFixtures(t, dir, program+".host.user", level, sizes...)
+}
+
+// writeGCPrefixFixtures is like writeGCLevelFixtures, but writes files
+// of the given program, host and user, as "program.host.user".
+func writeGCPrefixFixtures(t *testing.T, dir, prefix string, level Level, sizes ...int) []string {
+	start := time.Now().Add(-time.Duration(len(sizes)) * time.Hour)
+	var names []string
+	for i, size := range sizes {
+		created := start.Add(time.Duration(i) * time.Hour)
+		name := prefix + ".log." + level.String() + "." + created.Format(logFileTimeFormat) + ".1"
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, created, created); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestGCLogFiles(t *testing.T) {
+	for i, test := range []struct {
+		maxAge        time.Duration
+		maxTotalBytes int64
+		// expRemoved holds the indexes of the fixtures removed.
+		expRemoved []int
+	}{
+		// Nothing to remove.
+		{0, 0, nil},
+		{10 * time.Hour, 1000, nil},
+		// Age-based eviction of the files older than 2.5 hours.
+		{150 * time.Minute, 0, []int{0, 1}},
+		// Size-based eviction, oldest first, down to 250 of 400 bytes.
+		{0, 250, []int{0, 1}},
+		{0, 300, []int{0}},
+		// Both: age removes one file, size another one.
+		{210 * time.Minute, 250, []int{0, 1}},
+	} {
+		func() {
+			lg, cleanup := newTestLogger(t)
+			defer cleanup()
+			names := writeGCFixtures(t, lg.logDirs()[0], 100, 100, 100, 100)
+			removed, err := lg.GCLogFiles(int64(test.maxAge), test.maxTotalBytes, false /* !dryRun */)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var exp []string
+			for _, j := range test.expRemoved {
+				exp = append(exp, names[j])
+			}
+			if names := removedNames(removed); !reflect.DeepEqual(names, exp) {
+				t.Errorf("%d: expected to remove %s; removed %s", i, exp, names)
+			}
+			files, err := lg.ListLogFiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(names)-len(exp) {
+				t.Errorf("%d: expected %d files left; got %d", i, len(names)-len(exp), len(files))
+			}
+		}()
+	}
+}
+
+// TestGCLogFilesKeepsActive verifies that the files targeted by symlinks
+// and the files being written are never removed.
+func TestGCLogFilesKeepsActive(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	names := writeGCFixtures(t, dir, 100, 100)
+	// Point the WARNING symlink at the oldest fixture.
+	if err := os.Symlink(names[0], filepath.Join(dir, program+".WARNING")); err != nil {
+		t.Fatal(err)
+	}
+	lg.Infoc(nil, "x")
+	lg.Flush()
+	active, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := lg.GCLogFiles(int64(time.Nanosecond), 1, false /* !dryRun */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{names[1]}; !reflect.DeepEqual(removedNames(removed), exp) {
+		t.Errorf("expected to remove %s; removed %s", exp, removedNames(removed))
+	}
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, file := range files {
+		left = append(left, file.Name)
+	}
+	sort.Strings(left)
+	exp := []string{names[0], filepath.Base(active)}
+	sort.Strings(exp)
+	if !reflect.DeepEqual(left, exp) {
+		t.Errorf("expected %s to be left; got %s", exp, left)
+	}
+}
+
+// TestGCLogFilesSharedDir verifies that the files of other programs, and
+// the files targeted by the symlinks and pointer files of other processes,
+// are never removed.
+func TestGCLogFilesSharedDir(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	others := writeGCPrefixFixtures(t, dir, "other.host.user", InfoLevel, 100, 100)
+	names := writeGCFixtures(t, dir, 100, 100, 100)
+	// Another process of this program, with its own link names, is writing
+	// to the oldest file and to the next one.
+	if err := os.Symlink(names[0], filepath.Join(dir, program+".node2.INFO")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, program+".node3.INFO"+pointerFileSuffix),
+		[]byte(names[1]+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lg.Infoc(nil, "x")
+	lg.Flush()
+
+	removed, err := lg.GCLogFiles(int64(time.Nanosecond), 1, false /* !dryRun */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{names[2]}; !reflect.DeepEqual(removedNames(removed), exp) {
+		t.Errorf("expected to remove %s; removed %s", exp, removedNames(removed))
+	}
+	for _, name := range append(others, names[:2]...) {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to be kept: %s", name, err)
+		}
+	}
+}
+
+// TestGCLogFilesPerHost verifies that the files of each host and user are
+// held to the size budget separately.
+func TestGCLogFilesPerHost(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	noisy := writeGCPrefixFixtures(t, dir, program+".host.user", InfoLevel, 100, 100, 100, 100)
+	quiet := writeGCPrefixFixtures(t, dir, program+".host2.user", InfoLevel, 100, 100)
+	lg.Infoc(nil, "x")
+	lg.Flush()
+
+	removed, err := lg.GCLogFiles(0, 200, false /* !dryRun */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := noisy[:2]; !reflect.DeepEqual(removedNames(removed), exp) {
+		t.Errorf("expected to remove %s; removed %s", exp, removedNames(removed))
+	}
+	for _, name := range quiet {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to be kept: %s", name, err)
+		}
+	}
+}
+
+// TestGCLogFilesInMemoryFileSystem verifies that the files are listed and
+// removed on the Logger's fileSystem.
+func TestGCLogFilesInMemoryFileSystem(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	fs := newMemFileSystem()
+	lg.fs = fs
+	dir := lg.logDirs()[0]
+	created := time.Now().Add(-time.Hour)
+	old := program + ".host.user.log.INFO." + created.Format(logFileTimeFormat) + ".1"
+	if err := writeFile(fs, filepath.Join(dir, old), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs.files[filepath.Join(dir, old)].modTime = created
+	lg.Infoc(nil, "x")
+	lg.Flush()
+
+	removed, err := lg.GCLogFiles(int64(time.Minute), 0, false /* !dryRun */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{old}; !reflect.DeepEqual(removedNames(removed), exp) {
+		t.Errorf("expected to remove %s; removed %s", exp, removedNames(removed))
+	}
+	if _, ok := fs.files[filepath.Join(dir, old)]; ok {
+		t.Errorf("expected %s to be removed from the in-memory file system", old)
+	}
+}
+
+// TestGCLogFilesWithRetention verifies that the maximum age of each file
+// is that of its level, and that active files are kept regardless.
+func TestGCLogFilesWithRetention(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	// Files of each level created 3, 2 and 1 hours ago.
+	infos := writeGCLevelFixtures(t, dir, InfoLevel, 100, 100, 100)
+	warnings := writeGCLevelFixtures(t, dir, WarningLevel, 100, 100, 100)
+	errors := writeGCLevelFixtures(t, dir, ErrorLevel, 100, 100, 100)
+	// Point the ERROR symlink at its oldest fixture.
+	if err := os.Symlink(errors[0], filepath.Join(dir, program+".ERROR")); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := lg.GCLogFilesWithRetention(Retention{
+		MaxAgeNanos: map[Level]int64{
+			InfoLevel:  int64(90 * time.Minute),
+			ErrorLevel: int64(time.Minute),
+		},
+		DefaultMaxAgeNanos: int64(150 * time.Minute),
+	}, 0, false /* !dryRun */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := removedNames(removed)
+	sort.Strings(names)
+	exp := []string{infos[0], infos[1], warnings[0], errors[1], errors[2]}
+	sort.Strings(exp)
+	if !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected to remove %s; removed %s", exp, names)
+	}
+}
+
+// removedNames returns the names of the removed files.
+func removedNames(removed []RemovedFile) []string {
+	var names []string
+	for _, file := range removed {
+		names = append(names, file.Name)
+	}
+	return names
+}
+
+// TestGCLogFilesDryRun verifies that a dry run reports the files it would
+// remove, with their ages and sizes, without removing them.
+func TestGCLogFilesDryRun(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	names := writeGCFixtures(t, lg.logDirs()[0], 100, 200, 300)
+
+	removed, err := lg.GCLogFiles(int64(90*time.Minute), 0, true /* dryRun */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := names[:2]; !reflect.DeepEqual(removedNames(removed), exp) {
+		t.Fatalf("expected to report %s; got %+v", exp, removed)
+	}
+	for i, file := range removed {
+		if expSize := int64(100 * (i + 1)); file.SizeBytes != expSize {
+			t.Errorf("%s: expected size %d; got %d", file.Name, expSize, file.SizeBytes)
+		}
+		if age := time.Duration(file.AgeNanos); age < time.Duration(3-i)*time.Hour || age > time.Duration(3-i)*time.Hour+time.Minute {
+			t.Errorf("%s: expected an age of about %d hours; got %s", file.Name, 3-i, age)
+		}
+	}
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(lg.logDirs()[0], name)); err != nil {
+			t.Errorf("expected %s to be kept: %s", name, err)
+		}
+	}
+	// The summary isn't logged through the Logger, which would create its
+	// files, or exit if it couldn't.
+	lg.mu.Lock()
+	created := lg.file[infoLog] != nil
+	lg.mu.Unlock()
+	if created {
+		t.Error("expected the dry run not to log through the Logger")
+	}
+
+	// The same policy without the dry run removes the same files.
+	removed, err = lg.GCLogFiles(int64(90*time.Minute), 0, false /* !dryRun */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := names[:2]; !reflect.DeepEqual(removedNames(removed), exp) {
+		t.Errorf("expected to remove %s; got %+v", exp, removed)
+	}
+}
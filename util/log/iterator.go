@@ -0,0 +1,225 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
+	gogoproto "github.com/gogo/protobuf/proto"
+)
+
+// An EntryIterator yields the log entries on disk of a level of severity
+// (or worse) whose times lie in a range, one at a time, so that result
+// sets of any size are read in bounded memory. See
+// Logger.NewEntryIterator.
+type EntryIterator struct {
+	lg                           *Logger
+	level                        Level
+	startTimestamp, endTimestamp int64
+
+	listed bool
+	files  []FileInfo    // the files not opened yet, newest first
+	rc     io.ReadCloser // the file being read, if any
+	reader *bufio.Reader // buffers rc
+	err    error         // the error which ended the iteration
+	// entryBeforeStart is set once an entry well before startTimestamp
+	// (see ClockJumpTolerance) was read, as the files older than the one
+	// being read then hold none of the entries.
+	entryBeforeStart bool
+}
+
+// NewEntryIterator returns an iterator over the log entries on disk which
+// are of the given level of severity (or worse) and whose times lie
+// between startTimestamp and endTimestamp, inclusive, in unix nanos.
+func NewEntryIterator(level Level, startTimestamp, endTimestamp int64) *EntryIterator {
+	return defaultLogger.NewEntryIterator(level, startTimestamp, endTimestamp)
+}
+
+// NewEntryIterator returns an iterator over the log entries in the
+// Logger's directories which are of the given level of severity (or
+// worse) and whose times lie between startTimestamp and endTimestamp,
+// inclusive, in unix nanos. Unlike FetchEntriesFromFiles, it holds no
+// more than one entry and one open file at a time, and applies no
+// EntriesCutoff.
+//
+// The files of the given level are opened lazily, newest first, and the
+// entries of each file are yielded in the order they were written, i.e.
+// in increasing time order. Only the files of the given level are read,
+// as they hold the entries of the worse levels too, so each entry is
+// yielded once. An invalid time range is reported by Err. The iterator
+// must be closed.
+func (lg *Logger) NewEntryIterator(level Level, startTimestamp, endTimestamp int64) *EntryIterator {
+	return &EntryIterator{
+		lg:             lg,
+		level:          level,
+		startTimestamp: startTimestamp,
+		endTimestamp:   endTimestamp,
+		err:            validateTimeRange(startTimestamp, endTimestamp),
+	}
+}
+
+// Next returns the next entry, or false once there are no more entries
+// or reading failed, in which case Err returns the error.
+func (it *EntryIterator) Next() (proto.LogEntry, bool) {
+	for it.err == nil {
+		if it.reader == nil && !it.open() {
+			break
+		}
+		data, err := readEntryData(it.reader)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// An incomplete last entry is skipped.
+			it.closeFile()
+			continue
+		} else if err != nil {
+			it.err = err
+			break
+		}
+		// Entries outside of the time range aren't fully decoded.
+		if t, err := entryTime(data); err == nil {
+			if t < it.startTimestamp {
+				it.entryBeforeStart = it.entryBeforeStart || wellBeforeRange(t, it.startTimestamp)
+				continue
+			} else if t > it.endTimestamp {
+				if wellAfterRange(t, it.endTimestamp) {
+					// The rest of the file is newer still.
+					it.closeFile()
+				}
+				continue
+			}
+		}
+		var entry proto.LogEntry
+		if err := gogoproto.Unmarshal(data, &entry); err != nil {
+			// Entries which can't be decoded are skipped, as in
+			// FetchEntriesFromFiles.
+			continue
+		}
+		if entry.Time < it.startTimestamp {
+			it.entryBeforeStart = it.entryBeforeStart || wellBeforeRange(entry.Time, it.startTimestamp)
+			continue
+		} else if entry.Time > it.endTimestamp {
+			continue
+		}
+		if it.lg.Redact != nil {
+			it.lg.Redact(&entry)
+		}
+		return entry, true
+	}
+	it.closeFile()
+	return proto.LogEntry{}, false
+}
+
+// open opens the next file to read, listing the files first if needed,
+// and returns whether there was one.
+func (it *EntryIterator) open() bool {
+	if !it.listed {
+		logFiles, err := it.lg.ListLogFiles()
+		if err != nil {
+			it.err = err
+			return false
+		}
+		for _, file := range selectFiles(logFiles, it.level, it.endTimestamp) {
+			if file.Details.Level == it.level {
+				it.files = append(it.files, file)
+			}
+		}
+		it.listed = true
+	}
+	if len(it.files) == 0 || it.entryBeforeStart {
+		return false
+	}
+	file := it.files[0]
+	it.files = it.files[1:]
+	rc, err := it.lg.GetLogReader(file.Name, false /* !allowAbsolute */)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if f, ok := rc.(*os.File); ok {
+		// Files with a time index (see BuildTimeIndex) are read from
+		// close to the start time.
+		if it.entryBeforeStart, err = seekTimeIndex(f, it.startTimestamp-int64(ClockJumpTolerance)); err != nil {
+			rc.Close()
+			it.err = err
+			return false
+		}
+	}
+	it.rc, it.reader = rc, bufio.NewReader(rc)
+	return true
+}
+
+// closeFile closes the file being read, if any.
+func (it *EntryIterator) closeFile() {
+	if it.rc != nil {
+		it.rc.Close()
+		it.rc, it.reader = nil, nil
+	}
+}
+
+// Err returns the error which ended the iteration, if any.
+func (it *EntryIterator) Err() error {
+	return it.err
+}
+
+// Close releases the file being read. Next returns false afterwards.
+func (it *EntryIterator) Close() {
+	it.closeFile()
+	it.files = nil
+	it.listed = true
+}
+
+// FetchEntriesStream reads the entries on disk which are of the given
+// level of severity (or worse) and whose times lie between
+// startTimestamp and endTimestamp, and passes them to the callback in
+// batches of up to chunkSize entries as they're read. See
+// Logger.FetchEntriesStream.
+func FetchEntriesStream(level Level, startTimestamp, endTimestamp int64, chunkSize int, callback func([]proto.LogEntry) error) error {
+	return defaultLogger.FetchEntriesStream(level, startTimestamp, endTimestamp, chunkSize, callback)
+}
+
+// FetchEntriesStream reads the Logger's entries as an EntryIterator does,
+// i.e. files newest first and the entries of each file in increasing time
+// order, and passes them to the callback in batches of up to chunkSize
+// entries, so that, e.g., an HTTP handler can write a chunked response
+// while the files are read, in bounded memory. The batch is reused once
+// the callback returns. An error returned by the callback stops reading
+// and is returned.
+func (lg *Logger) FetchEntriesStream(level Level, startTimestamp, endTimestamp int64, chunkSize int, callback func([]proto.LogEntry) error) error {
+	if chunkSize <= 0 {
+		return util.Errorf("invalid chunk size %d", chunkSize)
+	}
+	it := lg.NewEntryIterator(level, startTimestamp, endTimestamp)
+	defer it.Close()
+	batch := make([]proto.LogEntry, 0, chunkSize)
+	for {
+		entry, ok := it.Next()
+		if ok {
+			batch = append(batch, entry)
+		}
+		if len(batch) == chunkSize || (!ok && len(batch) > 0) {
+			if err := callback(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		if !ok {
+			return it.Err()
+		}
+	}
+}
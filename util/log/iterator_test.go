@@ -0,0 +1,170 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// writeTestLogFile writes a log file of the given name holding an entry
+// of the given severity for each of the times, in tenths of a second
+// after the creation time of the first file of the test below.
+func writeTestLogFile(t *testing.T, dir, name string, severity Level, times ...int64) {
+	var buf bytes.Buffer
+	for _, time := range times {
+		entry := proto.LogEntry{Severity: int32(severity), Time: testBaseTime(t) + time*1e8, Format: "entry"}
+		if err := ProtoEncoding.EncodeEntry(&buf, &entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testBaseTime(t *testing.T) int64 {
+	details, err := parseLogFilename("cockroach.host.user.log.INFO.20150609-161048.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return details.Time
+}
+
+func TestEntryIterator(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	// Nothing has been logged, so the files below are all there is.
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161048.1", InfoLevel, 10, 20, 30)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161049.1", InfoLevel, 40, 50)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161050.1", InfoLevel, 60, 70)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.WARNING.20150609-161049.1", WarningLevel, 50)
+
+	for _, test := range []struct {
+		level      Level
+		start, end int64
+		exp        []int64
+	}{
+		{InfoLevel, 0, math.MaxInt64, []int64{60, 70, 40, 50, 10, 20, 30}},
+		{InfoLevel, 25, 65, []int64{60, 40, 50, 30}},
+		{InfoLevel, 45, 55, []int64{50}},
+		{InfoLevel, 100, 200, nil},
+		{InfoLevel, 0, 5, nil},
+		{WarningLevel, 0, math.MaxInt64, []int64{50}},
+		{ErrorLevel, 0, math.MaxInt64, nil},
+	} {
+		start, end := test.start, test.end
+		if start > 0 {
+			start = testBaseTime(t) + start*1e8
+		}
+		if end != math.MaxInt64 {
+			end = testBaseTime(t) + end*1e8
+		}
+		it := lg.NewEntryIterator(test.level, start, end)
+		var times []int64
+		for {
+			entry, ok := it.Next()
+			if !ok {
+				break
+			}
+			times = append(times, (entry.Time-testBaseTime(t))/1e8)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		it.Close()
+		if !reflect.DeepEqual(times, test.exp) {
+			t.Errorf("%s [%d, %d]: expected %d; got %d", test.level, test.start, test.end, test.exp, times)
+		}
+	}
+
+	// Closing the iterator in the middle of a file releases it.
+	it := lg.NewEntryIterator(InfoLevel, 0, math.MaxInt64)
+	if _, ok := it.Next(); !ok {
+		t.Fatal("expected an entry")
+	}
+	if it.rc == nil {
+		t.Fatal("expected a file to be open")
+	}
+	it.Close()
+	if it.rc != nil {
+		t.Error("expected the file to be closed")
+	}
+	if _, ok := it.Next(); ok {
+		t.Error("expected no entries after Close")
+	}
+}
+
+func TestFetchEntriesStream(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161048.1", InfoLevel, 10, 20, 30)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161049.1", InfoLevel, 40, 50)
+
+	for _, test := range []struct {
+		chunkSize int
+		exp       [][]int64
+	}{
+		{1, [][]int64{{40}, {50}, {10}, {20}, {30}}},
+		{2, [][]int64{{40, 50}, {10, 20}, {30}}},
+		{5, [][]int64{{40, 50, 10, 20, 30}}},
+		{10, [][]int64{{40, 50, 10, 20, 30}}},
+	} {
+		var batches [][]int64
+		if err := lg.FetchEntriesStream(InfoLevel, 0, math.MaxInt64, test.chunkSize, func(entries []proto.LogEntry) error {
+			if len(entries) > test.chunkSize {
+				t.Errorf("chunk size %d: got a batch of %d", test.chunkSize, len(entries))
+			}
+			var times []int64
+			for _, entry := range entries {
+				times = append(times, (entry.Time-testBaseTime(t))/1e8)
+			}
+			batches = append(batches, times)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(batches, test.exp) {
+			t.Errorf("chunk size %d: expected %d; got %d", test.chunkSize, test.exp, batches)
+		}
+	}
+
+	// An error returned by the callback stops reading.
+	stop := errors.New("stop")
+	calls := 0
+	if err := lg.FetchEntriesStream(InfoLevel, 0, math.MaxInt64, 2, func([]proto.LogEntry) error {
+		calls++
+		return stop
+	}); err != stop {
+		t.Errorf("expected the callback's error; got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected reading to stop after 1 batch; got %d", calls)
+	}
+
+	if err := lg.FetchEntriesStream(InfoLevel, 0, math.MaxInt64, 0, nil); err == nil {
+		t.Error("expected an error for a zero chunk size")
+	}
+}
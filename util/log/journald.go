@@ -0,0 +1,112 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// journalSocket is the socket journald receives entries on in its native
+// protocol.
+var journalSocket = "/run/systemd/journal/socket"
+
+// A JournaldSink forwards entries to journald in its native protocol, as
+// structured entries with the fields PRIORITY, MESSAGE, CODE_FILE and
+// CODE_LINE, plus SYSLOG_IDENTIFIER. It does nothing on hosts without
+// journald, such as hosts not running Linux. Entries too large for a
+// datagram are dropped.
+type JournaldSink struct {
+	conn net.Conn // nil if journald isn't available
+}
+
+// NewJournaldSink returns a sink forwarding entries to journald, or doing
+// nothing if journald isn't available. Register it with Logger.AddSink.
+func NewJournaldSink() *JournaldSink {
+	s := &JournaldSink{}
+	if _, err := os.Stat(journalSocket); err != nil {
+		return s
+	}
+	if conn, err := net.Dial("unixgram", journalSocket); err == nil {
+		s.conn = conn
+	}
+	return s
+}
+
+// Available returns whether the sink is connected to journald.
+func (s *JournaldSink) Available() bool {
+	return s.conn != nil
+}
+
+// Write implements the EntrySink interface.
+func (s *JournaldSink) Write(entry proto.LogEntry) error {
+	if s.conn == nil {
+		return nil
+	}
+	_, err := s.conn.Write(formatJournalEntry(&entry))
+	return err
+}
+
+// Flush implements the EntrySink interface. Entries are sent as they're
+// written, so there's nothing to do.
+func (s *JournaldSink) Flush() error {
+	return nil
+}
+
+// Close closes the connection to journald.
+func (s *JournaldSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// formatJournalEntry formats the entry as a journald datagram.
+func formatJournalEntry(entry *proto.LogEntry) []byte {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "PRIORITY", strconv.Itoa(syslogSeverities[severity(entry.Severity)]))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", program)
+	writeJournalField(&buf, "CODE_FILE", entry.File)
+	writeJournalField(&buf, "CODE_LINE", strconv.Itoa(int(entry.Line)))
+	writeJournalField(&buf, "MESSAGE", strings.TrimSuffix(formatMessage(entry), "\n"))
+	return buf.Bytes()
+}
+
+// writeJournalField writes a field in the native protocol of journald:
+// "KEY=value\n", or, for values spanning several lines, the key and a
+// newline followed by the length of the value as a little-endian uint64,
+// the value and a newline.
+func writeJournalField(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.Write(size[:])
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// parseJournalEntry parses a datagram in the native protocol of journald.
+func parseJournalEntry(t *testing.T, data []byte) map[string]string {
+	fields := map[string]string{}
+	for len(data) > 0 {
+		i := strings.IndexAny(string(data), "=\n")
+		if i < 0 {
+			t.Fatalf("malformed field %q", data)
+		}
+		key := string(data[:i])
+		if data[i] == '=' {
+			j := strings.IndexByte(string(data), '\n')
+			fields[key], data = string(data[i+1:j]), data[j+1:]
+			continue
+		}
+		data = data[i+1:]
+		n := binary.LittleEndian.Uint64(data)
+		fields[key], data = string(data[8:8+n]), data[8+n+1:]
+	}
+	return fields
+}
+
+func TestJournaldSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(socket string) { journalSocket = socket }(journalSocket)
+
+	// Without a socket, the sink does nothing.
+	journalSocket = filepath.Join(dir, "socket")
+	s := NewJournaldSink()
+	if s.Available() {
+		t.Errorf("expected the sink to be unavailable")
+	}
+	if err := s.Write(proto.LogEntry{Format: "dropped"}); err != nil {
+		t.Error(err)
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unix datagram sockets unavailable: %s", err)
+	}
+	defer conn.Close()
+	s = NewJournaldSink()
+	defer s.Close()
+	if !s.Available() {
+		t.Fatal("expected the sink to be available")
+	}
+	if err := s.Write(proto.LogEntry{
+		Severity: int32(errorLog),
+		File:     "kv/txn.go",
+		Line:     42,
+		Format:   "line one\nline two",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := parseJournalEntry(t, buf[:n])
+	for key, exp := range map[string]string{
+		"PRIORITY":          "3",
+		"CODE_FILE":         "kv/txn.go",
+		"CODE_LINE":         "42",
+		"MESSAGE":           "line one\nline two",
+		"SYSLOG_IDENTIFIER": program,
+	} {
+		if fields[key] != exp {
+			t.Errorf("expected %s=%q; got %q", key, exp, fields[key])
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
+)
+
+// jsonEntry is the JSON representation of a log entry, meant for log
+// shipping pipelines rather than for round-tripping the full proto.
+type jsonEntry struct {
+	// Time is either an RFC3339 string or the unix nanos of the entry.
+	Time     interface{} `json:"time"`
+	Severity string      `json:"severity"`
+	File     string      `json:"file"`
+	Line     int32       `json:"line"`
+	Message  string      `json:"message"`
+	// Fields holds the structured fields of the entry, if any.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// makeJSONEntry converts the entry into its JSON representation.
+func makeJSONEntry(entry *proto.LogEntry, unixNanos bool) jsonEntry {
+	je := jsonEntry{
+		Severity: Level(entry.Severity).String(),
+		File:     entry.File,
+		Line:     entry.Line,
+		Message:  formatMessage(entry),
+	}
+	if len(entry.Fields) > 0 {
+		je.Fields = make(map[string]string, len(entry.Fields))
+		for _, f := range entry.Fields {
+			je.Fields[f.Key] = f.Value
+		}
+	}
+	if unixNanos {
+		je.Time = entry.Time
+	} else {
+		je.Time = time.Unix(0, entry.Time).UTC().Format(time.RFC3339Nano)
+	}
+	return je
+}
+
+// WriteEntriesJSON writes the entries to w as newline-delimited JSON
+// objects. Entry times are rendered as RFC3339 strings in UTC, unless
+// unixNanos is set, in which case the raw unix nanos are written, which
+// is easier for machine consumers to sort and join on.
+func WriteEntriesJSON(w io.Writer, entries []proto.LogEntry, unixNanos bool) error {
+	enc := json.NewEncoder(w)
+	for i := range entries {
+		if err := enc.Encode(makeJSONEntry(&entries[i], unixNanos)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A JSONEntryEncoder writes log entries as newline-delimited JSON objects,
+// as WriteEntriesJSON does with RFC3339 times.
+type JSONEntryEncoder struct {
+	enc *json.Encoder
+}
+
+// NewJSONEntryEncoder returns an encoder writing to w.
+func NewJSONEntryEncoder(w io.Writer) *JSONEntryEncoder {
+	return &JSONEntryEncoder{enc: json.NewEncoder(w)}
+}
+
+// Encode writes the entry as a JSON object followed by a newline.
+func (e *JSONEntryEncoder) Encode(entry *proto.LogEntry) error {
+	return e.enc.Encode(makeJSONEntry(entry, false /* !unixNanos */))
+}
+
+// A JSONEntryDecoder reads log entries written by JSONEntryEncoder or
+// WriteEntriesJSON. It has the same Decode method as EntryDecoder, so
+// that code reading entries can be given either.
+type JSONEntryDecoder struct {
+	dec *json.Decoder
+}
+
+// NewJSONEntryDecoder returns a decoder reading from r.
+func NewJSONEntryDecoder(r io.Reader) *JSONEntryDecoder {
+	return &JSONEntryDecoder{dec: json.NewDecoder(r)}
+}
+
+// Decode decodes the next entry. Only the fields present in the JSON
+// representation are set; the message becomes the only argument of a
+// "%s" format, so that it's rendered verbatim. It returns io.EOF at the
+// end of the input.
+func (d *JSONEntryDecoder) Decode(entry *proto.LogEntry) error {
+	var je struct {
+		jsonEntry
+		Time json.RawMessage `json:"time"`
+	}
+	if err := d.dec.Decode(&je); err != nil {
+		return err
+	}
+	level, ok := LevelFromString(je.Severity)
+	if !ok {
+		return util.Errorf("unknown log entry severity %q", je.Severity)
+	}
+	var nanos int64
+	if err := json.Unmarshal(je.Time, &nanos); err != nil {
+		var s string
+		if err := json.Unmarshal(je.Time, &s); err != nil {
+			return util.Errorf("invalid log entry time %s", je.Time)
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		nanos = t.UnixNano()
+	}
+	*entry = proto.LogEntry{
+		Severity: int32(level),
+		Time:     nanos,
+		File:     je.File,
+		Line:     je.Line,
+		Format:   "%s",
+		Args:     []proto.LogEntry_Arg{{Str: je.Message}},
+	}
+	// The order of the fields isn't kept in JSON, so they're decoded in
+	// the order of their keys.
+	for key, value := range je.Fields {
+		entry.Fields = append(entry.Fields, proto.LogEntry_Field{Key: key, Value: value})
+	}
+	sort.Sort(fieldsByKey(entry.Fields))
+	return nil
+}
+
+// fieldsByKey sorts structured fields by key.
+type fieldsByKey []proto.LogEntry_Field
+
+func (f fieldsByKey) Len() int           { return len(f) }
+func (f fieldsByKey) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f fieldsByKey) Less(i, j int) bool { return f[i].Key < f[j].Key }
@@ -0,0 +1,121 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func TestWriteEntriesJSON(t *testing.T) {
+	entry := proto.LogEntry{
+		Severity: int32(warningLog),
+		Time:     time.Date(2015, 6, 9, 16, 10, 48, 123456789, time.UTC).UnixNano(),
+		File:     "file.go",
+		Line:     42,
+		Format:   "value %s",
+		Args:     []proto.LogEntry_Arg{{Str: "x"}},
+	}
+
+	for _, test := range []struct {
+		unixNanos bool
+		exp       string
+	}{
+		{false, `{"time":"2015-06-09T16:10:48.123456789Z","severity":"WARNING","file":"file.go","line":42,"message":"value x"}` + "\n"},
+		{true, `{"time":1433866248123456789,"severity":"WARNING","file":"file.go","line":42,"message":"value x"}` + "\n"},
+	} {
+		var buf bytes.Buffer
+		if err := WriteEntriesJSON(&buf, []proto.LogEntry{entry}, test.unixNanos); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.exp {
+			t.Errorf("unixNanos=%t: expected %s; got %s", test.unixNanos, test.exp, buf.String())
+		}
+	}
+}
+
+func TestJSONEntryEncoderRoundTrip(t *testing.T) {
+	start := time.Date(2015, 6, 9, 16, 10, 48, 123456789, time.UTC).UnixNano()
+	entries := []proto.LogEntry{
+		{Severity: int32(infoLog), Time: start, File: "a.go", Line: 1, Format: "plain"},
+		{Severity: int32(errorLog), Time: start + 1, File: "b.go", Line: 2, Format: "%d%% done: %s",
+			Args: []proto.LogEntry_Arg{{Str: "50"}, {Str: "multi\nline"}}},
+	}
+	var buf bytes.Buffer
+	enc := NewJSONEntryEncoder(&buf)
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Entries written with unix nanos decode too.
+	if err := WriteEntriesJSON(&buf, entries[:1], true); err != nil {
+		t.Fatal(err)
+	}
+	entries = append(entries, entries[0])
+
+	dec := NewJSONEntryDecoder(&buf)
+	for i := range entries {
+		var entry proto.LogEntry
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		exp := &entries[i]
+		if entry.Severity != exp.Severity || entry.Time != exp.Time || entry.File != exp.File ||
+			entry.Line != exp.Line || formatMessage(&entry) != formatMessage(exp) {
+			t.Errorf("%d: expected %+v; got %+v", i, exp, entry)
+		}
+	}
+	var entry proto.LogEntry
+	if err := dec.Decode(&entry); err != io.EOF {
+		t.Errorf("expected EOF; got %v", err)
+	}
+}
+
+func TestJSONEntryFields(t *testing.T) {
+	entry := proto.LogEntry{
+		Severity: int32(infoLog),
+		Time:     time.Date(2015, 6, 9, 16, 10, 48, 0, time.UTC).UnixNano(),
+		File:     "file.go",
+		Line:     42,
+		Format:   "%s",
+		Args:     []proto.LogEntry_Arg{{Str: "committed"}},
+		Fields:   []proto.LogEntry_Field{{Key: "txn", Value: "abc"}, {Key: "epoch", Value: "2"}},
+	}
+	var buf bytes.Buffer
+	if err := NewJSONEntryEncoder(&buf).Encode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	const exp = `{"time":"2015-06-09T16:10:48Z","severity":"INFO","file":"file.go","line":42,"message":"committed","fields":{"epoch":"2","txn":"abc"}}` + "\n"
+	if buf.String() != exp {
+		t.Errorf("expected %s; got %s", exp, buf.String())
+	}
+
+	var decoded proto.LogEntry
+	if err := NewJSONEntryDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	// Fields are decoded in the order of their keys.
+	entry.Fields[0], entry.Fields[1] = entry.Fields[1], entry.Fields[0]
+	if !reflect.DeepEqual(decoded, entry) {
+		t.Errorf("expected %+v; got %+v", entry, decoded)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"hash/fnv"
+	"strconv"
+	"time"
+)
+
+// A DirLayout determines where below its log directories a Logger keeps
+// its log files. Symlinks and pointer files to the active files are
+// always kept in the log directories themselves.
+type DirLayout interface {
+	// Subdir returns the subdirectory of a log directory in which a log
+	// file created at t is written, as a relative path, or "" for the log
+	// directory itself.
+	Subdir(t time.Time) string
+	// Subdirs returns all the subdirectories Subdir may return, so that
+	// log files can be found without walking the log directories.
+	Subdirs() []string
+}
+
+// FlatLayout keeps all log files directly in the log directories. It is
+// the layout of Loggers which don't set one.
+type FlatLayout struct{}
+
+// Subdir implements the DirLayout interface.
+func (FlatLayout) Subdir(time.Time) string { return "" }
+
+// Subdirs implements the DirLayout interface.
+func (FlatLayout) Subdirs() []string { return []string{""} }
+
+// ShardedLayout spreads log files over Shards subdirectories, named "0"
+// to the hexadecimal Shards-1, by a hash of the hour in which they were
+// created. This bounds the size of the directories at very high log
+// volumes, when MaxSize is small.
+type ShardedLayout struct {
+	Shards int
+}
+
+// Subdir implements the DirLayout interface.
+func (l ShardedLayout) Subdir(t time.Time) string {
+	if l.Shards <= 1 {
+		return shardName(0)
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(t.UTC().Format("2006010215"))) // never fails
+	return shardName(h.Sum32() % uint32(l.Shards))
+}
+
+// Subdirs implements the DirLayout interface. The log directory itself
+// is included, so that the files written before the layout was
+// configured are still found.
+func (l ShardedLayout) Subdirs() []string {
+	subdirs := []string{""}
+	for i := 0; i == 0 || i < l.Shards; i++ {
+		subdirs = append(subdirs, shardName(uint32(i)))
+	}
+	return subdirs
+}
+
+func shardName(shard uint32) string {
+	return strconv.FormatUint(uint64(shard), 16)
+}
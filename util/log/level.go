@@ -0,0 +1,85 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import "strings"
+
+// A Level identifies the severity of log files and entries when reading
+// them back. Its values match the Severity field of proto.LogEntry.
+type Level int32
+
+// The severity levels, in order of increasing severity: INFO < WARNING <
+// ERROR < FATAL. Compare levels with Severity or LevelAtLeast.
+const (
+	InfoLevel    = Level(infoLog)
+	WarningLevel = Level(warningLog)
+	ErrorLevel   = Level(errorLog)
+	FatalLevel   = Level(fatalLog)
+)
+
+// GapLevel is the severity of the synthetic entries which
+// FetchEntriesWithGaps inserts to mark gaps in the log. No real entry has
+// it.
+const GapLevel Level = -1
+
+// String returns the name of the level as used in log file names, e.g.
+// "WARNING".
+func (l Level) String() string {
+	if l == GapLevel {
+		return "GAP"
+	}
+	if l < InfoLevel || l > FatalLevel {
+		return "UNKNOWN"
+	}
+	return severityName[l]
+}
+
+// Severity returns the ordinal of the level in the order of increasing
+// severity, from 0 for INFO to 3 for FATAL. GapLevel is below all of
+// them.
+func (l Level) Severity() int {
+	return int(l)
+}
+
+// LevelAtLeast returns whether level a is at least as severe as level b,
+// as in the "level or worse" selections of the fetch functions.
+func LevelAtLeast(a, b Level) bool {
+	return a.Severity() >= b.Severity()
+}
+
+// LevelFromString returns the level with the given name. The name is
+// case-insensitive and may also be the single letter which prefixes the
+// level's entries in text output, e.g. "W" for WARNING.
+func LevelFromString(s string) (Level, bool) {
+	if len(s) == 1 {
+		if i := strings.IndexByte(severityChar, strings.ToUpper(s)[0]); i >= 0 {
+			return Level(i), true
+		}
+		return 0, false
+	}
+	return levelFromName(strings.ToUpper(s))
+}
+
+// levelFromName returns the level with exactly the given name, as used in
+// log file names.
+func levelFromName(s string) (Level, bool) {
+	for i, name := range severityName {
+		if name == s {
+			return Level(i), true
+		}
+	}
+	return 0, false
+}
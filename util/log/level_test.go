@@ -0,0 +1,69 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import "testing"
+
+func TestLevelFromString(t *testing.T) {
+	for _, tc := range []struct {
+		s     string
+		level Level
+		ok    bool
+	}{
+		{"INFO", InfoLevel, true},
+		{"info", InfoLevel, true},
+		{"Warning", WarningLevel, true},
+		{"E", ErrorLevel, true},
+		{"f", FatalLevel, true},
+		{"", 0, false},
+		{"X", 0, false},
+		{"verbose", 0, false},
+	} {
+		level, ok := LevelFromString(tc.s)
+		if level != tc.level || ok != tc.ok {
+			t.Errorf("%q: expected %s, %t; got %s, %t", tc.s, tc.level, tc.ok, level, ok)
+		}
+		if ok {
+			if rt, _ := LevelFromString(level.String()); rt != level {
+				t.Errorf("%s doesn't round-trip; got %s", level, rt)
+			}
+		}
+	}
+	// Log file names must still use the exact level names.
+	if _, err := parseLogFilename("cockroach.host.user.log.info.20150609-161048.1"); err == nil {
+		t.Error("expected a lowercase level in a file name to be rejected")
+	}
+	if _, ok := levelFromName("Info"); ok {
+		t.Error("expected levelFromName to be case-sensitive")
+	}
+}
+
+func TestLevelOrdering(t *testing.T) {
+	levels := []Level{InfoLevel, WarningLevel, ErrorLevel, FatalLevel}
+	for i, a := range levels {
+		if a.Severity() != i {
+			t.Errorf("expected %s to have severity %d; got %d", a, i, a.Severity())
+		}
+		for j, b := range levels {
+			if atLeast := LevelAtLeast(a, b); atLeast != (i >= j) {
+				t.Errorf("expected LevelAtLeast(%s, %s) to be %t; got %t", a, b, i >= j, atLeast)
+			}
+		}
+		if !LevelAtLeast(a, GapLevel) || LevelAtLeast(GapLevel, a) {
+			t.Errorf("expected GapLevel to be below %s", a)
+		}
+	}
+}
@@ -17,7 +17,10 @@
 
 package log
 
-import "golang.org/x/net/context"
+import (
+	"github.com/cockroachdb/cockroach/proto"
+	"golang.org/x/net/context"
+)
 
 func init() {
 	// TODO(tschottdorf) this should go to our logger. Currently this will log
@@ -168,6 +171,40 @@ func FatalDepth(depth int, args ...interface{}) {
 	logDepth(nil, depth+1, fatalLog, "", args)
 }
 
+// logDepth formats the output string and writes the resulting entry to
+// the Logger's files.
+func (lg *Logger) logDepth(ctx context.Context, depth int, sev severity, format string, args []interface{}) {
+	file, line := Caller(depth + 1)
+	entry := &proto.LogEntry{
+		Severity: int32(sev),
+		Time:     timeNow().UnixNano(),
+		ThreadID: int32(pid), // TODO: should be TID
+		File:     file,
+		Line:     int32(line),
+	}
+	setLogEntry(ctx, format, args, entry)
+	setStackDepth(entry, depth+1)
+	lg.output(sev, entry)
+}
+
+// Infoc logs to the Logger's INFO log. It extracts values from the context
+// like the package-level Infoc.
+func (lg *Logger) Infoc(ctx context.Context, format string, args ...interface{}) {
+	lg.logDepth(ctx, 1, infoLog, format, args)
+}
+
+// Warningc logs to the Logger's WARNING and INFO logs. It extracts values
+// from the context like the package-level Warningc.
+func (lg *Logger) Warningc(ctx context.Context, format string, args ...interface{}) {
+	lg.logDepth(ctx, 1, warningLog, format, args)
+}
+
+// Errorc logs to the Logger's ERROR, WARNING, and INFO logs. It extracts
+// values from the context like the package-level Errorc.
+func (lg *Logger) Errorc(ctx context.Context, format string, args ...interface{}) {
+	lg.logDepth(ctx, 1, errorLog, format, args)
+}
+
 // V returns true if the logging verbosity is set to the specified level or
 // higher.
 func V(level level) bool {
@@ -0,0 +1,77 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"container/heap"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// MergeSortedEntries merges streams of entries, each sorted by increasing
+// time, such as those read from the files of the different levels, into
+// a single stream sorted by increasing time. Entries logged at the same
+// time are ordered like the streams they come from.
+func MergeSortedEntries(streams ...[]proto.LogEntry) []proto.LogEntry {
+	var h entryHeap
+	n := 0
+	for i, s := range streams {
+		if len(s) > 0 {
+			h = append(h, entryStream{entries: s, index: i})
+			n += len(s)
+		}
+	}
+	heap.Init(&h)
+	merged := make([]proto.LogEntry, 0, n)
+	for len(h) > 0 {
+		s := &h[0]
+		merged = append(merged, s.entries[0])
+		if s.entries = s.entries[1:]; len(s.entries) == 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return merged
+}
+
+// An entryStream is the remainder of a stream being merged, along with
+// the index of the stream, used to break ties.
+type entryStream struct {
+	entries []proto.LogEntry
+	index   int
+}
+
+// entryHeap is a min-heap of streams ordered by their next entry's time.
+type entryHeap []entryStream
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool {
+	ti, tj := h[i].entries[0].Time, h[j].entries[0].Time
+	return ti < tj || (ti == tj && h[i].index < h[j].index)
+}
+
+func (h entryHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *entryHeap) Push(x interface{}) { *h = append(*h, x.(entryStream)) }
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
@@ -0,0 +1,60 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func TestMergeSortedEntries(t *testing.T) {
+	entries := func(times ...int64) []proto.LogEntry {
+		var s []proto.LogEntry
+		for _, t := range times {
+			s = append(s, proto.LogEntry{Time: t})
+		}
+		return s
+	}
+	info := entries(1, 4, 4, 7, 10)
+	warning := entries(2, 4, 8)
+	errors := entries(3, 9)
+	merged := MergeSortedEntries(info, nil, warning, errors)
+
+	var times []int64
+	for _, e := range merged {
+		times = append(times, e.Time)
+	}
+	if exp := []int64{1, 2, 3, 4, 4, 4, 7, 8, 9, 10}; !reflect.DeepEqual(times, exp) {
+		t.Errorf("expected times %d; got %d", exp, times)
+	}
+
+	// Ties are broken by the order of the streams.
+	info[1].Line, info[2].Line, warning[1].Line = 1, 2, 3
+	merged = MergeSortedEntries(info, warning, errors)
+	var lines []int32
+	for _, e := range merged[3:6] {
+		lines = append(lines, e.Line)
+	}
+	if exp := []int32{1, 2, 3}; !reflect.DeepEqual(lines, exp) {
+		t.Errorf("expected lines %d; got %d", exp, lines)
+	}
+
+	if merged := MergeSortedEntries(); len(merged) != 0 {
+		t.Errorf("expected no entries; got %d", len(merged))
+	}
+}
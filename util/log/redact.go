@@ -0,0 +1,45 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"regexp"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// A RedactFunc masks sensitive data in a log entry in place.
+type RedactFunc func(entry *proto.LogEntry)
+
+// emailRE matches email addresses.
+var emailRE = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+
+// redactedEmail replaces the email addresses masked by RedactEmails.
+const redactedEmail = "<redacted email>"
+
+// RedactEmails is a RedactFunc which masks the email addresses in the
+// format and arguments of an entry. The JSON representation of arguments
+// in which addresses were masked is dropped, as it may contain them too.
+func RedactEmails(entry *proto.LogEntry) {
+	entry.Format = emailRE.ReplaceAllLiteralString(entry.Format, redactedEmail)
+	for i := range entry.Args {
+		arg := &entry.Args[i]
+		if emailRE.MatchString(arg.Str) {
+			arg.Str = emailRE.ReplaceAllLiteralString(arg.Str, redactedEmail)
+			arg.Json = nil
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func TestRedactEmails(t *testing.T) {
+	entry := proto.LogEntry{
+		Format: "mail to jane.doe@example.com: %s",
+		Args: []proto.LogEntry_Arg{
+			{Str: "cc j+smith@mail.example.org", Json: []byte(`"cc j+smith@mail.example.org"`)},
+			{Str: "no address", Json: []byte(`"no address"`)},
+		},
+	}
+	RedactEmails(&entry)
+	if exp := "mail to <redacted email>: %s"; entry.Format != exp {
+		t.Errorf("expected format %q; got %q", exp, entry.Format)
+	}
+	if arg := entry.Args[0]; arg.Str != "cc <redacted email>" || arg.Json != nil {
+		t.Errorf("expected redacted argument; got %+v", arg)
+	}
+	if arg := entry.Args[1]; arg.Str != "no address" || arg.Json == nil {
+		t.Errorf("expected argument to be left alone; got %+v", arg)
+	}
+}
+
+// TestFetchRedacted verifies that fetched entries are redacted while the
+// log files are not.
+func TestFetchRedacted(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Redact = RedactEmails
+
+	lg.Infoc(nil, "signup from %s", "jane@example.com")
+	lg.Flush()
+
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for i := range entries {
+		msg := formatMessage(&entries[i])
+		if strings.Contains(msg, "jane@example.com") {
+			t.Errorf("unredacted entry returned: %s", msg)
+		}
+		found = found || strings.Contains(msg, "signup from <redacted email>")
+	}
+	if !found {
+		t.Errorf("redacted entry not found in %d entries", len(entries))
+	}
+
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(lg.logDirs()[0], files[0].Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "jane@example.com") {
+		t.Errorf("expected the log file to be left unchanged")
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/cockroachdb/cockroach/util"
+)
+
+// RelocateLogDir switches the default Logger to writing its files to
+// newDir, without losing entries. See Logger.RelocateLogDir.
+func RelocateLogDir(newDir string) error {
+	return defaultLogger.RelocateLogDir(newDir)
+}
+
+// MoveLogDir switches the default Logger to writing its files to newDir
+// and moves its existing files there. See Logger.MoveLogDir.
+func MoveLogDir(newDir string) error {
+	return defaultLogger.MoveLogDir(newDir)
+}
+
+// RelocateLogDir switches the Logger to writing its files to newDir, for
+// instance to move logging to a new volume without restarting. The
+// current files are flushed and closed, and new ones are started in
+// newDir by the next write. Writers block for the duration of the switch,
+// so no entry is lost. The existing files stay where they are; their
+// directories remain searched, so ListLogFiles and the fetch functions
+// keep finding them next to the new files.
+func (lg *Logger) RelocateLogDir(newDir string) error {
+	return lg.relocate(newDir, false /* !moveFiles */)
+}
+
+// MoveLogDir is like RelocateLogDir, but also moves the existing files of
+// the Logger to newDir, after which the old directories are no longer
+// searched. Files are renamed if possible and copied otherwise, as newDir
+// may be on another volume. Only the files of the Logger's program, host
+// and user are moved, except those the links of other processes target;
+// an old directory still holding other files remains searched. If a file
+// can't be moved, those already moved are moved back, and the Logger
+// keeps its directories.
+func (lg *Logger) MoveLogDir(newDir string) error {
+	return lg.relocate(newDir, true /* moveFiles */)
+}
+
+func (lg *Logger) relocate(newDir string, moveFiles bool) error {
+	fs := lg.fileSystem()
+	if err := fs.MkdirAll(newDir, 0755); err != nil {
+		return err
+	}
+	oldDirs := lg.logDirs()
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	if err := lg.closeFiles(); err != nil {
+		return err
+	}
+
+	dirs := []string{newDir}
+	var movedFrom []string
+	var moved []fileMove
+	for _, dir := range oldDirs {
+		if sameDir(fs, dir, newDir) {
+			continue
+		}
+		if moveFiles {
+			var left bool
+			var err error
+			if moved, left, err = lg.moveFiles(dir, newDir, moved); err != nil {
+				// Nothing is left half moved: the files are all either where
+				// they were or listed in the error.
+				return rollBack(fs, moved, err)
+			}
+			movedFrom = append(movedFrom, dir)
+			if !left {
+				continue
+			}
+		}
+		// The dir, or the files of others left in it, remains searched.
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range movedFrom {
+		lg.removeLinks(dir)
+	}
+	lg.setLogDirs(dirs)
+	return nil
+}
+
+// sameDir returns whether both paths name the same directory.
+func sameDir(fs fileSystem, a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	aInfo, err := fs.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := fs.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
+
+// A fileMove is a file moved from src to dst by MoveLogDir.
+type fileMove struct {
+	src, dst string
+}
+
+// moveFiles moves the log files of the Logger in oldDir and the files
+// kept next to them to the same place below newDir, appending them to
+// moved. The Logger's files are those of its program, host and user
+// which no symlink or pointer file of another process targets; the other
+// files stay, in which case left is true. lg.mu is held and the files are
+// closed.
+func (lg *Logger) moveFiles(oldDir, newDir string, moved []fileMove) (_ []fileMove, left bool, _ error) {
+	fs := lg.fileSystem()
+	rootInfos, err := readDirIfExists(fs, oldDir)
+	if err != nil {
+		return moved, false, err
+	}
+	own := map[string]bool{}
+	for _, sevName := range severityName {
+		for _, link := range lg.linkNames(sevName) {
+			own[link] = true
+			own[link+pointerFileSuffix] = true
+		}
+	}
+	var others []os.FileInfo
+	for _, info := range rootInfos {
+		if !own[info.Name()] {
+			others = append(others, info)
+		}
+	}
+	linked := linkedFiles(fs, oldDir, others)
+	filter := FileFilter{Program: program, Host: host, UserName: userName}
+
+	for _, subdir := range lg.layout().Subdirs() {
+		infos, err := readDirIfExists(fs, filepath.Join(oldDir, subdir))
+		if err != nil {
+			return moved, false, err
+		}
+		if len(infos) == 0 {
+			continue
+		}
+		if err := fs.MkdirAll(filepath.Join(newDir, subdir), 0755); err != nil {
+			return moved, false, err
+		}
+		for _, info := range appendLogFiles(nil, infos, FileFilter{}) {
+			if !filter.matches(info.Details) || linked[filepath.Join(oldDir, subdir, info.Name)] {
+				left = true
+				continue
+			}
+			names := []string{info.Name}
+			for _, suffix := range indexSuffixes {
+				names = append(names, info.Name+suffix)
+			}
+			for _, name := range names {
+				src, dst := filepath.Join(oldDir, subdir, name), filepath.Join(newDir, subdir, name)
+				if err := moveFile(fs, src, dst); err != nil {
+					if os.IsNotExist(err) {
+						continue
+					}
+					return moved, false, err
+				}
+				moved = append(moved, fileMove{src, dst})
+			}
+		}
+	}
+	return moved, left, nil
+}
+
+// removeLinks removes the links of the Logger to its active files from
+// dir, whose files were moved. lg.mu is held.
+func (lg *Logger) removeLinks(dir string) {
+	fs := lg.fileSystem()
+	for _, sevName := range severityName {
+		for _, link := range lg.linkNames(sevName) {
+			link = filepath.Join(dir, link)
+			_ = fs.Remove(link)                     // ignore err
+			_ = fs.Remove(link + pointerFileSuffix) // ignore err
+		}
+	}
+}
+
+// rollBack moves the files moved by MoveLogDir back, newest move first,
+// after err interrupted it. The error returned is err, naming the files
+// which couldn't be moved back, if any.
+func rollBack(fs fileSystem, moved []fileMove, err error) error {
+	var stranded []string
+	for i := len(moved) - 1; i >= 0; i-- {
+		if mErr := moveFile(fs, moved[i].dst, moved[i].src); mErr != nil {
+			stranded = append(stranded, moved[i].dst)
+		}
+	}
+	if len(stranded) > 0 {
+		return util.Errorf("%s; files left moved: %s", err, strings.Join(stranded, ", "))
+	}
+	return err
+}
+
+// readDirIfExists lists the directory on fs, which may not exist.
+func readDirIfExists(fs fileSystem, dir string) ([]os.FileInfo, error) {
+	infos, err := fs.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return infos, err
+}
+
+// moveFile renames src to dst on fs, falling back to copying it and
+// removing src if they are on different volumes.
+func moveFile(fs fileSystem, src, dst string) error {
+	if err := fs.Rename(src, dst); err == nil {
+		return nil
+	} else if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+	in, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := fs.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0664)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		fs.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		fs.Remove(dst)
+		return err
+	}
+	return fs.Remove(src)
+}
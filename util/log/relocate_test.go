@@ -0,0 +1,276 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForNextSecond sleeps until the wall clock enters a new second, so
+// that files created afterwards don't share a name with earlier ones.
+func waitForNextSecond() {
+	time.Sleep(time.Second - time.Duration(time.Now().Nanosecond()))
+}
+
+func testRelocate(t *testing.T, move bool) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	oldDir := lg.logDirs()[0]
+	newDir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(newDir)
+
+	start := time.Now().UnixNano()
+	lg.Infoc(nil, "before")
+	before, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForNextSecond()
+	relocate := lg.RelocateLogDir
+	if move {
+		relocate = lg.MoveLogDir
+	}
+	const concurrent = 100
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < concurrent; i++ {
+			lg.Infoc(nil, "during")
+		}
+	}()
+	if err := relocate(newDir); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	lg.Infoc(nil, "after")
+	lg.Flush()
+
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files; got %+v", files)
+	}
+	for _, file := range files {
+		_, err := os.Stat(filepath.Join(newDir, file.Name))
+		if inNew := err == nil; inNew != (move || file.Name != filepath.Base(before)) {
+			t.Errorf("%s: unexpectedly in new dir: %t", file.Name, inNew)
+		}
+	}
+	if old, err := filepath.Glob(filepath.Join(oldDir, "*.log.*")); err != nil {
+		t.Fatal(err)
+	} else if len(old) != map[bool]int{false: 1, true: 0}[move] {
+		t.Errorf("unexpected files left in old dir: %s", old)
+	}
+
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, start, time.Now().UnixNano())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	var during int
+	for _, entry := range entries {
+		switch entry.Format {
+		case "before", "after":
+			msgs = append(msgs, entry.Format)
+		case "during":
+			during++
+		}
+	}
+	if len(msgs) != 2 || msgs[0] != "after" || msgs[1] != "before" {
+		t.Errorf("expected both entries; got %s", msgs)
+	}
+	if during != concurrent {
+		t.Errorf("expected %d entries logged during the switch; got %d", concurrent, during)
+	}
+}
+
+func TestRelocateLogDir(t *testing.T) {
+	testRelocate(t, false)
+}
+
+func TestMoveLogDir(t *testing.T) {
+	testRelocate(t, true)
+}
+
+// TestRelocateConcurrentListing verifies that listing and reading log
+// files is safe while the Logger relocates.
+func TestRelocateConcurrentListing(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	oldDir := lg.logDirs()[0]
+	lg.Infoc(nil, "entry")
+	lg.Flush()
+
+	var newDirs []string
+	for i := 0; i < 5; i++ {
+		dir, err := ioutil.TempDir("", "log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		newDirs = append(newDirs, dir)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, dir := range append(newDirs, oldDir) {
+			if err := lg.RelocateLogDir(dir); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if _, err := lg.ListLogFiles(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestMoveFileError verifies that moveFile only falls back to copying
+// for renames across volumes, and returns the other errors.
+func TestMoveFileError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	if err := ioutil.WriteFile(src, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A file can't be renamed over a non-empty directory.
+	dst := filepath.Join(dir, "dst")
+	if err := os.MkdirAll(filepath.Join(dst, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveFile(osFileSystem{}, src, dst); err == nil {
+		t.Fatal("expected an error")
+	} else if _, ok := err.(*os.LinkError); !ok {
+		t.Errorf("expected the error of the rename; got %v", err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("expected %s to be left in place: %v", src, err)
+	}
+}
+
+// TestMoveLogDirSharedDir verifies that MoveLogDir leaves the files of
+// other programs and the active files of other processes in place, and
+// keeps finding them.
+func TestMoveLogDirSharedDir(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	oldDir := lg.logDirs()[0]
+	newDir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(newDir)
+	lg.Infoc(nil, "x")
+	lg.Flush()
+	own, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	others := writeGCPrefixFixtures(t, oldDir, "other."+escapePeriods(host)+"."+escapePeriods(userName), InfoLevel, 100)
+	// Another process of this program writes to this file.
+	active := writeGCPrefixFixtures(t, oldDir, program+"."+escapePeriods(host)+"."+escapePeriods(userName), WarningLevel, 100)
+	if err := os.Symlink(active[0], filepath.Join(oldDir, program+".node2.WARNING")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lg.MoveLogDir(newDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(newDir, filepath.Base(own))); err != nil {
+		t.Errorf("expected the Logger's file to be moved: %s", err)
+	}
+	for _, name := range append(others, active...) {
+		if _, err := os.Stat(filepath.Join(oldDir, name)); err != nil {
+			t.Errorf("expected %s to be left in place: %s", name, err)
+		}
+	}
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("expected the 3 files to be listed; got %+v", files)
+	}
+}
+
+// renameFailingFileSystem is an in-memory fileSystem on which renaming a
+// file fails.
+type renameFailingFileSystem struct {
+	*memFileSystem
+	fail string
+}
+
+func (fs renameFailingFileSystem) Rename(oldpath, newpath string) error {
+	if oldpath == fs.fail {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrPermission}
+	}
+	return fs.memFileSystem.Rename(oldpath, newpath)
+}
+
+// TestMoveLogDirRollBack verifies that the files already moved when a
+// file can't be are moved back, and that the Logger keeps its dirs.
+func TestMoveLogDirRollBack(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	oldDir := lg.logDirs()[0]
+	newDir := filepath.Join(oldDir, "new")
+	mem := newMemFileSystem()
+	prefix := program + "." + escapePeriods(host) + "." + escapePeriods(userName)
+	var names []string
+	for i := 2; i > 0; i-- {
+		created := time.Now().Add(-time.Duration(i) * time.Hour)
+		name := prefix + ".log.INFO." + created.Format(logFileTimeFormat) + ".1"
+		if err := writeFile(mem, filepath.Join(oldDir, name), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	lg.fs = renameFailingFileSystem{mem, filepath.Join(oldDir, names[1])}
+
+	if err := lg.MoveLogDir(newDir); err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, name := range names {
+		if _, ok := mem.files[filepath.Join(oldDir, name)]; !ok {
+			t.Errorf("expected %s to be in the old dir", name)
+		}
+		if _, ok := mem.files[filepath.Join(newDir, name)]; ok {
+			t.Errorf("expected %s not to be in the new dir", name)
+		}
+	}
+	if dirs := lg.logDirs(); len(dirs) != 1 || dirs[0] != oldDir {
+		t.Errorf("expected the Logger to keep %s; got %s", oldDir, dirs)
+	}
+}
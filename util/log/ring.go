@@ -0,0 +1,79 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"sync"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// A RingBufferSink retains the last entries written to it in memory, so
+// that a crash handler can dump them even if they never made it to the
+// files. Registered with Logger.AddSink, it's called inline while
+// logging rather than from a buffer, so it never misses an entry. Its
+// storage is allocated once: writing an entry only copies it into the
+// ring, overwriting the oldest entry once the ring is full.
+type RingBufferSink struct {
+	mu      sync.Mutex
+	entries []proto.LogEntry
+	next    int  // index of the slot written next
+	full    bool // whether every slot holds an entry
+}
+
+// NewRingBufferSink returns a sink retaining the last capacity entries.
+func NewRingBufferSink(capacity int) *RingBufferSink {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &RingBufferSink{entries: make([]proto.LogEntry, capacity)}
+}
+
+// Write implements the EntrySink interface.
+func (s *RingBufferSink) Write(entry proto.LogEntry) error {
+	s.mu.Lock()
+	s.entries[s.next] = entry
+	s.next++
+	if s.next == len(s.entries) {
+		s.next = 0
+		s.full = true
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Flush implements the EntrySink interface. Entries are retained as
+// they're written, so there's nothing to do.
+func (s *RingBufferSink) Flush() error {
+	return nil
+}
+
+// direct implements the directSink interface.
+func (s *RingBufferSink) direct() {}
+
+// Snapshot returns the retained entries, oldest first. It only holds the
+// sink's lock while copying the entries, which never panics, so it's
+// safe to call from a panic or signal handler.
+func (s *RingBufferSink) Snapshot() []proto.LogEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.full {
+		return append([]proto.LogEntry(nil), s.entries[:s.next]...)
+	}
+	snapshot := make([]proto.LogEntry, 0, len(s.entries))
+	snapshot = append(snapshot, s.entries[s.next:]...)
+	return append(snapshot, s.entries[:s.next]...)
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func TestRingBufferSink(t *testing.T) {
+	s := NewRingBufferSink(3)
+	formats := func() string {
+		var formats []string
+		for _, entry := range s.Snapshot() {
+			formats = append(formats, entry.Format)
+		}
+		return fmt.Sprint(formats)
+	}
+	if f := formats(); f != "[]" {
+		t.Errorf("expected an empty snapshot; got %s", f)
+	}
+	for i, expected := range []string{"[0]", "[0 1]", "[0 1 2]", "[1 2 3]", "[2 3 4]", "[3 4 5]", "[4 5 6]"} {
+		if err := s.Write(proto.LogEntry{Format: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+		if f := formats(); f != expected {
+			t.Errorf("%d: expected %s; got %s", i, expected, f)
+		}
+	}
+}
+
+// TestRingBufferSinkLogger verifies that a RingBufferSink registered with
+// a Logger receives every entry without flushing, even when it's logged
+// to faster than a buffered sink could keep up with.
+func TestRingBufferSinkLogger(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	s := NewRingBufferSink(10)
+	lg.AddSink(s)
+
+	const n = 2 * sinkBufferSize
+	for i := 0; i < n; i++ {
+		lg.Infoc(nil, "entry %d", i)
+	}
+	lg.Warningc(nil, "last")
+	snapshot := s.Snapshot()
+	if len(snapshot) != 10 {
+		t.Fatalf("expected 10 entries; got %d", len(snapshot))
+	}
+	if last := snapshot[9]; last.Format != "last" || last.Severity != int32(warningLog) {
+		t.Errorf("unexpected last entry %+v", last)
+	}
+	if first := snapshot[0]; len(first.Args) != 1 || first.Args[0].Str != fmt.Sprint(n-9) {
+		t.Errorf("unexpected first entry %+v", first)
+	}
+	if dropped := lg.DroppedSinkEntries(); dropped != 0 {
+		t.Errorf("expected no dropped entries; got %d", dropped)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// The reasons of rotations recorded by rotation markers.
+const (
+	// RotationBySize is the reason of rotations of files which reached
+	// the size limit.
+	RotationBySize = "size"
+	// RotationByAge is the reason of rotations of files older than
+	// Logger.MaxAge.
+	RotationByAge = "age"
+	// RotationRequested is the reason of other rotations.
+	RotationRequested = "requested"
+)
+
+// RegisterRotationCallback registers a function to be called with the
+// path of each log file the default Logger rotates out. See
+// Logger.RegisterRotationCallback.
+func RegisterRotationCallback(fn func(oldFile string)) {
+	defaultLogger.RegisterRotationCallback(fn)
+}
+
+// RegisterRotationCallback registers a function to be called with the
+// path of each log file the Logger rotates out, e.g. to archive or upload
+// it. The callbacks are called once the file has been flushed and closed
+// by a goroutine of the Logger, so that they don't block logging: one
+// file after the other, in the order they were rotated out, and for each
+// file in the order the callbacks were registered. Close waits for the
+// callbacks of the files rotated out before it, so they must not close
+// the Logger.
+func (lg *Logger) RegisterRotationCallback(fn func(oldFile string)) {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	lg.rotationCallbacks = append(lg.rotationCallbacks, fn)
+}
+
+// A rotatedFile is a file rotated out, queued for the callbacks
+// registered at the time.
+type rotatedFile struct {
+	name      string
+	callbacks []func(oldFile string)
+}
+
+// A rotationWorker calls the rotation callbacks of a Logger.
+type rotationWorker struct {
+	lg *Logger
+	// queue holds the files rotated out which the callbacks haven't been
+	// called with yet. It is protected by lg.mu.
+	queue []rotatedFile
+	wake  chan struct{} // signaled once files are queued
+	stop  chan struct{} // closed to stop the worker once the queue is empty
+	done  chan struct{} // closed once the worker has stopped
+}
+
+// runRotationCallbacks queues the file rotated out for the rotation
+// callbacks, starting the rotation worker if needed. lg.mu is held.
+func (lg *Logger) runRotationCallbacks(oldFile string) {
+	if len(lg.rotationCallbacks) == 0 {
+		return
+	}
+	w := lg.rotationWorker
+	if w == nil {
+		w = &rotationWorker{
+			lg:   lg,
+			wake: make(chan struct{}, 1),
+			stop: make(chan struct{}),
+			done: make(chan struct{}),
+		}
+		lg.rotationWorker = w
+		go w.run()
+	}
+	w.queue = append(w.queue, rotatedFile{oldFile, lg.rotationCallbacks})
+	select {
+	case w.wake <- struct{}{}:
+	default:
+		// The worker is already due to take the queue.
+	}
+}
+
+// run calls the rotation callbacks with the files queued, in order, until
+// the worker is stopped and the queue is empty.
+func (w *rotationWorker) run() {
+	defer close(w.done)
+	for {
+		w.lg.mu.Lock()
+		queued := w.queue
+		w.queue = nil
+		w.lg.mu.Unlock()
+		for _, file := range queued {
+			for _, fn := range file.callbacks {
+				fn(file.name)
+			}
+		}
+		select {
+		case <-w.wake:
+		case <-w.stop:
+			w.lg.mu.Lock()
+			empty := len(w.queue) == 0
+			w.lg.mu.Unlock()
+			if empty {
+				return
+			}
+		}
+	}
+}
+
+// stopRotationWorker stops the rotation worker, if it's running, once it
+// has called the callbacks of the files queued. lg.mu is held, and
+// released while waiting.
+func (lg *Logger) stopRotationWorker() {
+	w := lg.rotationWorker
+	if w == nil {
+		return
+	}
+	lg.rotationWorker = nil
+	close(w.stop)
+	lg.mu.Unlock()
+	<-w.done
+	lg.mu.Lock()
+}
+
+// processStart is the time the process started, as recorded by rotation
+// markers.
+var processStart = time.Now()
+
+// rotationMarkerPrefix starts the message of rotation markers.
+const rotationMarkerPrefix = "log file rotated"
+
+// A RotationMarker describes the rotation which started a log file. It's
+// recorded in an entry following the header entries of every file but
+// the first of a level, so that the boundaries between rotated files show
+// among the entries fetched from them.
+type RotationMarker struct {
+	PreviousFile string // base name of the previous file of the level
+	Reason       string // RotationBySize, RotationByAge or RotationRequested
+	ProcessStart int64  // time the process started, in unix nanos
+}
+
+// rotationMarkerEntry returns the entry recording the marker.
+func rotationMarkerEntry(marker RotationMarker, now time.Time, file string, line int) proto.LogEntry {
+	return proto.LogEntry{
+		Time:   now.UnixNano(),
+		File:   file,
+		Line:   int32(line),
+		Format: rotationMarkerPrefix + " (%s) from %s; process started at %s",
+		Args: []proto.LogEntry_Arg{
+			{Str: marker.Reason},
+			{Str: marker.PreviousFile},
+			{Str: time.Unix(0, marker.ProcessStart).Format(time.RFC3339Nano)},
+		},
+	}
+}
+
+// ParseRotationMarker returns the rotation marker recorded by the entry,
+// if it's a rotation marker.
+func ParseRotationMarker(entry *proto.LogEntry) (RotationMarker, bool) {
+	if !strings.HasPrefix(entry.Format, rotationMarkerPrefix) || len(entry.Args) != 3 {
+		return RotationMarker{}, false
+	}
+	start, err := time.Parse(time.RFC3339Nano, entry.Args[2].Str)
+	if err != nil {
+		return RotationMarker{}, false
+	}
+	return RotationMarker{
+		PreviousFile: entry.Args[1].Str,
+		Reason:       entry.Args[0].Str,
+		ProcessStart: start.UnixNano(),
+	}, true
+}
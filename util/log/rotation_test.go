@@ -0,0 +1,229 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRotationMarker verifies that a rotated file starts with a marker
+// naming the previous file and the reason of the rotation, and that the
+// first file of a level has none.
+func TestRotationMarker(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Infoc(nil, "before rotation")
+	lg.Flush()
+	first, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg.mu.Lock()
+	err = lg.file[infoLog].(*syncBuffer).rotate(time.Now().Add(time.Hour), RotationBySize)
+	lg.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg.Infoc(nil, "after rotation")
+	lg.Flush()
+
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var markers []RotationMarker
+	for i := range entries {
+		if marker, ok := ParseRotationMarker(&entries[i]); ok {
+			markers = append(markers, marker)
+		}
+	}
+	if len(markers) != 1 {
+		t.Fatalf("expected one rotation marker; got %+v", markers)
+	}
+	exp := RotationMarker{
+		PreviousFile: filepath.Base(first),
+		Reason:       RotationBySize,
+		ProcessStart: processStart.UnixNano(),
+	}
+	if markers[0] != exp {
+		t.Errorf("expected %+v; got %+v", exp, markers[0])
+	}
+	if _, ok := ParseRotationMarker(&entries[0]); ok {
+		t.Error("expected a logged entry not to be a rotation marker")
+	}
+}
+
+// TestRotationMockedClock verifies that the names of the files, the
+// times of their entries and the spans of the files all come from
+// timeNow.
+func TestRotationMockedClock(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.MaxAge = 24 * time.Hour
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	later := start.Add(25 * time.Hour)
+	timeNow = func() time.Time { return start }
+	lg.Infoc(nil, "before rotation")
+	timeNow = func() time.Time { return later }
+	lg.Infoc(nil, "after rotation")
+	lg.Flush()
+
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created []int64
+	for _, file := range files {
+		created = append(created, file.Details.Time)
+	}
+	if exp := []int64{later.UnixNano(), start.UnixNano()}; !reflect.DeepEqual(created, exp) {
+		t.Errorf("expected files created at %v; got %v", exp, created)
+	}
+
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headers, markers, logged []int64
+	for i := range entries {
+		if strings.HasSuffix(entries[i].Format, " rotation") {
+			logged = append(logged, entries[i].Time)
+		}
+		if _, ok := ParseRotationMarker(&entries[i]); ok {
+			markers = append(markers, entries[i].Time)
+		} else if strings.HasPrefix(entries[i].Format, "Running on machine") {
+			headers = append(headers, entries[i].Time)
+		}
+	}
+	if exp := []int64{later.UnixNano(), start.UnixNano()}; !reflect.DeepEqual(headers, exp) {
+		t.Errorf("expected header entries at %v; got %v", exp, headers)
+	}
+	if exp := []int64{later.UnixNano()}; !reflect.DeepEqual(markers, exp) {
+		t.Errorf("expected a rotation marker at %v; got %v", exp, markers)
+	}
+	if exp := []int64{later.UnixNano(), start.UnixNano()}; !reflect.DeepEqual(logged, exp) {
+		t.Errorf("expected entries logged at %v; got %v", exp, logged)
+	}
+
+	// The newest file, last modified before it was created by the mocked
+	// clock, spans up to the mocked now.
+	timeNow = func() time.Time { return later.Add(2 * time.Hour) }
+	at := later.Add(time.Hour).UnixNano()
+	if files, err := lg.ListLogFilesInRange(InfoLevel, at, at); err != nil {
+		t.Fatal(err)
+	} else if len(files) != 1 || files[0].Details.Time != later.UnixNano() {
+		t.Errorf("expected the newest file; got %+v", files)
+	}
+}
+
+// TestRotationCallback verifies that the rotation callbacks are called in
+// order with the complete file rotated out.
+func TestRotationCallback(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	type call struct {
+		callback int
+		file     string
+		found    bool
+	}
+	calls := make(chan call, 2)
+	for i := 0; i < 2; i++ {
+		i := i
+		lg.RegisterRotationCallback(func(oldFile string) {
+			data, err := ioutil.ReadFile(oldFile)
+			if err != nil {
+				t.Error(err)
+			}
+			calls <- call{i, oldFile, strings.Contains(string(data), "before rotation")}
+		})
+	}
+	lg.Infoc(nil, "before rotation")
+	first, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg.mu.Lock()
+	err = lg.file[infoLog].(*syncBuffer).rotateFile(time.Now().Add(time.Hour))
+	lg.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case c := <-calls:
+			if c.callback != i || c.file != first || !c.found {
+				t.Errorf("expected callback %d to be called with the complete %s; got %+v", i, first, c)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("callback %d wasn't called", i)
+		}
+	}
+}
+
+// TestRotationCallbackOrder verifies that the callbacks of rotations in
+// quick succession are called one file after the other, in order, and
+// that Close waits for them.
+func TestRotationCallbackOrder(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	var mu sync.Mutex
+	var calls []string
+	var running int32
+	lg.RegisterRotationCallback(func(oldFile string) {
+		if atomic.AddInt32(&running, 1) != 1 {
+			t.Error("expected the callbacks to run one at a time")
+		}
+		// Give a concurrent callback the chance to overtake this one.
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		calls = append(calls, oldFile)
+		mu.Unlock()
+		atomic.AddInt32(&running, -1)
+	})
+
+	var rotated []string
+	for i := 0; i < 3; i++ {
+		lg.Infoc(nil, "entry %d", i)
+		lg.mu.Lock()
+		sb := lg.file[infoLog].(*syncBuffer)
+		rotated = append(rotated, sb.file.Name())
+		err := sb.rotateFile(time.Now().Add(time.Duration(i+1) * time.Hour))
+		lg.mu.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lg.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(calls, rotated) {
+		t.Errorf("expected the callbacks to be called with %s, in order; got %s", rotated, calls)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// A FetchQuery selects log entries by the content of their messages and
+// by the thread which logged them. The entries returned match all of the
+// fields set.
+type FetchQuery struct {
+	// Pattern, if set, selects the entries whose messages it matches.
+	Pattern *regexp.Regexp
+	// Substring, if set, selects the entries whose messages contain it.
+	Substring string
+	// IgnoreCase makes both Pattern and Substring match regardless of
+	// case.
+	IgnoreCase bool
+	// ThreadID, if nonzero, selects the entries logged by the thread of
+	// that ID (see the ThreadID field of proto.LogEntry).
+	ThreadID int32
+	// MaxMessageBytes, if positive, truncates the message of each entry
+	// returned to that many bytes, followed by a "...(truncated N bytes)"
+	// suffix, so that enormous messages don't blow up the results. Entries
+	// are matched against their full messages.
+	MaxMessageBytes int
+	// Ascending makes the entries be returned in increasing time order,
+	// e.g. to render a transcript top to bottom, rather than in the
+	// decreasing time order of FetchEntriesFromFiles.
+	Ascending bool
+}
+
+// matcher returns a function reporting whether an entry matches the
+// query.
+func (q FetchQuery) matcher() (func(*proto.LogEntry) bool, error) {
+	pattern, substring := q.Pattern, q.Substring
+	if q.IgnoreCase {
+		if pattern != nil {
+			var err error
+			if pattern, err = regexp.Compile("(?i)" + pattern.String()); err != nil {
+				return nil, err
+			}
+		}
+		substring = strings.ToLower(substring)
+	}
+	return func(entry *proto.LogEntry) bool {
+		if q.ThreadID != 0 && entry.ThreadID != q.ThreadID {
+			return false
+		}
+		msg := formatMessage(entry)
+		if substring != "" {
+			s := msg
+			if q.IgnoreCase {
+				s = strings.ToLower(s)
+			}
+			if !strings.Contains(s, substring) {
+				return false
+			}
+		}
+		return pattern == nil || pattern.MatchString(msg)
+	}, nil
+}
+
+// FetchEntriesMatching is like FetchEntriesFromFiles, but only returns
+// the entries whose messages match the query. Entries are matched as
+// they're decoded, so memory is only used for those which match.
+func FetchEntriesMatching(level Level, query FetchQuery, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	return defaultLogger.FetchEntriesMatching(level, query, startTimestamp, endTimestamp)
+}
+
+// FetchEntriesMatching fetches the Logger's log entries matching the
+// query, as described by the package-level FetchEntriesMatching.
+func (lg *Logger) FetchEntriesMatching(level Level, query FetchQuery, startTimestamp, endTimestamp int64) ([]proto.LogEntry, error) {
+	match, err := query.matcher()
+	if err != nil {
+		return nil, err
+	}
+	entries, _, err := lg.fetchEntries(level, startTimestamp, endTimestamp, fetchOptions{
+		match:           match,
+		maxMessageBytes: query.MaxMessageBytes,
+		ascending:       query.Ascending,
+	})
+	return entries, err
+}
+
+// truncateMessage truncates the message of the entry to at most max
+// bytes, cut on a rune boundary, followed by a suffix giving the number
+// of bytes cut. The truncated message replaces the entry's format and
+// arguments. Messages which fit are left unchanged.
+func truncateMessage(entry *proto.LogEntry, max int) {
+	msg := formatMessage(entry)
+	if len(msg) <= max {
+		return
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+	entry.Format = "%s"
+	entry.Args = []proto.LogEntry_Arg{{
+		Type: "string",
+		Str:  fmt.Sprintf("%s...(truncated %d bytes)", msg[:cut], len(msg)-cut),
+	}}
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func TestFetchEntriesMatching(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	for _, msg := range []string{"range 1 split", "Range 2 merged", "store 3 ready"} {
+		lg.Infoc(nil, msg)
+	}
+	lg.Flush()
+
+	for i, test := range []struct {
+		query FetchQuery
+		exp   []string
+	}{
+		{FetchQuery{Substring: "range"}, []string{"range 1 split"}},
+		{FetchQuery{Substring: "range", IgnoreCase: true}, []string{"Range 2 merged", "range 1 split"}},
+		{FetchQuery{Pattern: regexp.MustCompile(`^\w+ \d (split|ready)$`)}, []string{"store 3 ready", "range 1 split"}},
+		{FetchQuery{Pattern: regexp.MustCompile(`^range`), IgnoreCase: true}, []string{"Range 2 merged", "range 1 split"}},
+		{FetchQuery{Pattern: regexp.MustCompile(`\d`), Substring: "merged"}, []string{"Range 2 merged"}},
+		// The header entries of the file have no thread ID.
+		{FetchQuery{ThreadID: int32(pid)}, []string{"store 3 ready", "Range 2 merged", "range 1 split"}},
+		{FetchQuery{ThreadID: int32(pid), Substring: "store"}, []string{"store 3 ready"}},
+		{FetchQuery{ThreadID: int32(pid) + 1}, nil},
+	} {
+		entries, err := lg.FetchEntriesMatching(InfoLevel, test.query, 0, math.MaxInt64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msgs []string
+		for j := range entries {
+			msgs = append(msgs, formatMessage(&entries[j]))
+		}
+		if !reflect.DeepEqual(msgs, test.exp) {
+			t.Errorf("%d: expected %q; got %q", i, test.exp, msgs)
+		}
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	for i, test := range []struct {
+		format string
+		args   []proto.LogEntry_Arg
+		max    int
+		exp    string
+	}{
+		{"short", nil, 5, "short"},
+		{"longer", nil, 5, "longe...(truncated 1 bytes)"},
+		{"%s and %s", []proto.LogEntry_Arg{{Str: "one"}, {Str: "two"}}, 7, "one and...(truncated 4 bytes)"},
+		// "é" takes two bytes and isn't split.
+		{"abcé", nil, 4, "abc...(truncated 2 bytes)"},
+		{"ééé", nil, 5, "éé...(truncated 2 bytes)"},
+		{"日本", nil, 2, "...(truncated 6 bytes)"},
+		// A format with verbs is replaced by the message.
+		{"100%% done", nil, 4, "100%...(truncated 5 bytes)"},
+	} {
+		entry := proto.LogEntry{Format: test.format, Args: test.args}
+		truncateMessage(&entry, test.max)
+		if msg := formatMessage(&entry); msg != test.exp {
+			t.Errorf("%d: expected %q; got %q", i, test.exp, msg)
+		}
+	}
+}
+
+func TestFetchEntriesMatchingMaxMessageBytes(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Infoc(nil, "a %s message", strings.Repeat("very ", 100))
+	lg.Infoc(nil, "short")
+	lg.Flush()
+
+	query := FetchQuery{ThreadID: int32(pid)}
+	entries, err := lg.FetchEntriesMatching(InfoLevel, query, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || len(formatMessage(&entries[1])) != 510 {
+		t.Fatalf("expected full messages without MaxMessageBytes; got %+v", entries)
+	}
+
+	// The query matches the full message.
+	query.MaxMessageBytes = 10
+	query.Substring = "message"
+	entries, err = lg.FetchEntriesMatching(InfoLevel, query, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry; got %+v", entries)
+	}
+	if msg, exp := formatMessage(&entries[0]), "a very ver...(truncated 500 bytes)"; msg != exp {
+		t.Errorf("expected %q; got %q", exp, msg)
+	}
+}
+
+func TestFetchEntriesMatchingAscending(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161048.1", InfoLevel, 10, 20, 30)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161049.1", InfoLevel, 40, 50)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.INFO.20150609-161050.1", InfoLevel, 60, 70)
+	writeTestLogFile(t, dir, "cockroach.host.user.log.WARNING.20150609-161049.1", WarningLevel, 45)
+
+	base := testBaseTime(t)
+	for _, test := range []struct {
+		level      Level
+		start, end int64
+		exp        []int64
+	}{
+		{InfoLevel, 0, math.MaxInt64, []int64{10, 20, 30, 40, 45, 50, 60, 70}},
+		{WarningLevel, 0, math.MaxInt64, []int64{45}},
+		// The ranges start and end at the boundaries of files.
+		{InfoLevel, 30, 60, []int64{30, 40, 45, 50, 60}},
+		{InfoLevel, 50, 70, []int64{50, 60, 70}},
+	} {
+		for _, ascending := range []bool{false, true} {
+			query := FetchQuery{Ascending: ascending}
+			start, end := test.start, test.end
+			if start > 0 {
+				start = base + start*1e8
+			}
+			if end < math.MaxInt64 {
+				end = base + end*1e8
+			}
+			entries, err := lg.FetchEntriesMatching(test.level, query, start, end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var times []int64
+			for _, entry := range entries {
+				times = append(times, (entry.Time-base)/1e8)
+			}
+			exp := append([]int64(nil), test.exp...)
+			if !ascending {
+				for i, j := 0, len(exp)-1; i < j; i, j = i+1, j-1 {
+					exp[i], exp[j] = exp[j], exp[i]
+				}
+			}
+			if !reflect.DeepEqual(times, exp) {
+				t.Errorf("%s [%d, %d] ascending=%t: expected %v; got %v", test.level, test.start, test.end, ascending, exp, times)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"sync/atomic"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// An EntrySink receives a copy of each entry a Logger writes to its
+// files, for instance to forward entries elsewhere or to capture them in
+// tests. See Logger.AddSink.
+type EntrySink interface {
+	// Write accepts an entry.
+	Write(entry proto.LogEntry) error
+	// Flush delivers the entries accepted so far.
+	Flush() error
+}
+
+// sinkBufferSize is the number of entries buffered for each sink.
+const sinkBufferSize = 1000
+
+// AddSink registers the sink with the default Logger. See
+// Logger.AddSink.
+func AddSink(sink EntrySink) {
+	defaultLogger.AddSink(sink)
+}
+
+// AddSink registers the sink with the Logger, which mirrors the entries
+// written to its files to it from then on, until the Logger is closed and
+// the sink flushed a last time. The sink is called from a
+// goroutine of its own, fed by a buffer of sinkBufferSize entries, so
+// that a slow sink never holds up logging: entries which find the buffer
+// full are dropped instead, and counted by DroppedSinkEntries. A
+// RingBufferSink is the exception: it's called inline. Errors returned
+// by the sink are ignored.
+func (lg *Logger) AddSink(sink EntrySink) {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	lg.sinks = append(lg.sinks, newBufferedSink(sink))
+}
+
+// A directSink is a sink cheap enough to be called inline while logging,
+// instead of from a buffer. Such sinks never miss entries.
+type directSink interface {
+	EntrySink
+	direct()
+}
+
+// DroppedSinkEntries returns the number of entries the Logger's sinks
+// missed because they didn't keep up, summed over the sinks.
+func (lg *Logger) DroppedSinkEntries() int64 {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	var dropped int64
+	for _, s := range lg.sinks {
+		dropped += atomic.LoadInt64(&s.dropped)
+	}
+	return dropped
+}
+
+// A sinkRequest asks a sink to write an entry or, if flush is set, to
+// flush.
+type sinkRequest struct {
+	entry proto.LogEntry
+	flush bool
+}
+
+// A bufferedSink feeds a sink from a bounded buffer, or, for a
+// directSink, calls it inline.
+type bufferedSink struct {
+	sink     EntrySink
+	requests chan sinkRequest // nil for a directSink
+	done     chan struct{}    // closed once run returns
+	dropped  int64            // accessed atomically
+	// flushPending is set, atomically, when a flush didn't fit in the
+	// buffer; the sink is flushed once the buffer drains.
+	flushPending int32
+}
+
+func newBufferedSink(sink EntrySink) *bufferedSink {
+	if _, ok := sink.(directSink); ok {
+		return &bufferedSink{sink: sink}
+	}
+	s := &bufferedSink{
+		sink:     sink,
+		requests: make(chan sinkRequest, sinkBufferSize),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// write buffers the entry, or drops it if the buffer is full.
+func (s *bufferedSink) write(entry *proto.LogEntry) {
+	if s.requests == nil {
+		_ = s.sink.Write(*entry) // ignore err
+		return
+	}
+	select {
+	case s.requests <- sinkRequest{entry: *entry}:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// flush asks the sink to flush once the buffered entries are written.
+func (s *bufferedSink) flush() {
+	if s.requests == nil {
+		_ = s.sink.Flush() // ignore err
+		return
+	}
+	select {
+	case s.requests <- sinkRequest{flush: true}:
+	default:
+		atomic.StoreInt32(&s.flushPending, 1)
+	}
+}
+
+// stop writes the buffered entries to the sink, flushes it and stops the
+// goroutine feeding it. Nothing may be written to s afterwards.
+func (s *bufferedSink) stop() {
+	if s.requests == nil {
+		_ = s.sink.Flush() // ignore err
+		return
+	}
+	close(s.requests)
+	<-s.done
+}
+
+func (s *bufferedSink) run() {
+	defer close(s.done)
+	defer func() {
+		_ = s.sink.Flush() // ignore err
+	}()
+	for req := range s.requests {
+		if req.flush {
+			_ = s.sink.Flush() // ignore err
+			continue
+		}
+		_ = s.sink.Write(req.entry) // ignore err
+		if len(s.requests) == 0 && atomic.CompareAndSwapInt32(&s.flushPending, 1, 0) {
+			_ = s.sink.Flush() // ignore err
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// captureSink records the entries written to it. If block is set, writes
+// wait until it's closed.
+type captureSink struct {
+	block chan struct{}
+
+	mu      sync.Mutex
+	entries []proto.LogEntry
+	flushes int
+}
+
+func (s *captureSink) Write(entry proto.LogEntry) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *captureSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	return nil
+}
+
+// waitFor waits until the sink holds n entries and was flushed after
+// them.
+func (s *captureSink) waitFor(t *testing.T, n int) []proto.LogEntry {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		s.mu.Lock()
+		entries, flushes := s.entries, s.flushes
+		s.mu.Unlock()
+		if len(entries) >= n && flushes > 0 {
+			return entries
+		}
+	}
+	t.Fatalf("sink didn't receive %d entries", n)
+	return nil
+}
+
+func TestAddSink(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	sink := &captureSink{}
+	lg.AddSink(sink)
+
+	lg.Infoc(nil, "one")
+	lg.Warningc(nil, "two")
+	lg.Flush()
+	entries := sink.waitFor(t, 2)
+	if len(entries) != 2 || entries[0].Format != "one" || entries[1].Format != "two" ||
+		entries[1].Severity != int32(warningLog) {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
+
+// TestSlowSink verifies that a sink which doesn't keep up doesn't hold
+// up logging, and that the entries it misses are counted.
+func TestSlowSink(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	sink := &captureSink{block: make(chan struct{})}
+	lg.AddSink(sink)
+
+	const n = 2 * sinkBufferSize
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < n; i++ {
+			lg.Infoc(nil, "entry %d", i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("logging blocked on the sink")
+	}
+	dropped := lg.DroppedSinkEntries()
+	if dropped < n-sinkBufferSize-1 {
+		t.Errorf("expected at least %d dropped entries; got %d", n-sinkBufferSize-1, dropped)
+	}
+
+	close(sink.block)
+	lg.Flush()
+	if entries := sink.waitFor(t, int(n-dropped)); int64(len(entries)) != n-dropped {
+		t.Errorf("expected %d entries; got %d", n-dropped, len(entries))
+	}
+}
+
+// TestSinkStoppedOnClose verifies that closing a Logger writes the
+// entries buffered for its sinks, flushes them and stops their
+// goroutines.
+func TestSinkStoppedOnClose(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	sink := &captureSink{}
+	lg.AddSink(sink)
+	lg.mu.Lock()
+	buffered := lg.sinks[0]
+	lg.mu.Unlock()
+
+	lg.Infoc(nil, "one")
+	lg.Infoc(nil, "two")
+	if err := lg.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-buffered.done:
+	default:
+		t.Fatal("expected the sink's goroutine to be stopped")
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.entries) != 2 || sink.flushes == 0 {
+		t.Errorf("expected 2 entries and a flush; got %+v and %d flushes", sink.entries, sink.flushes)
+	}
+}
+
+// TestAddSinkDefaultLogger verifies that the package-level AddSink
+// registers the sink with the default Logger.
+func TestAddSinkDefaultLogger(t *testing.T) {
+	sink := &captureSink{}
+	AddSink(sink)
+	defaultLogger.mu.Lock()
+	n := len(defaultLogger.sinks)
+	buffered := defaultLogger.sinks[n-1]
+	defaultLogger.sinks = defaultLogger.sinks[:n-1]
+	defaultLogger.mu.Unlock()
+	buffered.stop()
+	if buffered.sink != sink {
+		t.Errorf("expected the sink to be registered with the default Logger; got %+v", buffered.sink)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
+	gogoproto "github.com/gogo/protobuf/proto"
+)
+
+// entryStreamVersion is the version of the wire format written by
+// WriteEntryStream. Streams start with it, so that readers can reject
+// streams they don't understand.
+//
+// Version 1 streams consist of frames, each holding a uvarint followed
+// by that many bytes minus one of encoded proto.LogEntry. A frame with
+// uvarint zero ends the stream, telling a complete stream apart from a
+// broken connection. Unlike the on-disk format, there is no fixed-size
+// length prefix, which keeps small entries compact on the wire.
+const entryStreamVersion = 1
+
+// WriteEntryStream writes the entries received from the channel to w in
+// the wire format read by ReadEntryStream, until the channel is closed.
+// The stream is not buffered; w should be if it does expensive writes.
+func WriteEntryStream(w io.Writer, entries <-chan proto.LogEntry) error {
+	if _, err := w.Write([]byte{entryStreamVersion}); err != nil {
+		return err
+	}
+	var buf []byte
+	for entry := range entries {
+		data, err := gogoproto.Marshal(&entry)
+		if err != nil {
+			return err
+		}
+		buf = appendUvarint(buf[:0], uint64(len(data))+1)
+		if _, err := w.Write(append(buf, data...)); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(appendUvarint(buf[:0], 0))
+	return err
+}
+
+// appendUvarint appends the uvarint encoding of v to b.
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+// ReadEntryStream reads a stream written by WriteEntryStream from r and
+// sends its entries on the channel, which it closes when it returns. An
+// error is returned if the version of the stream is unknown or if r ends
+// before the end of the stream.
+func ReadEntryStream(r io.Reader, entries chan<- proto.LogEntry) error {
+	defer close(entries)
+	br := bufio.NewReader(r)
+	version, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != entryStreamVersion {
+		return util.Errorf("unsupported log entry stream version %d", version)
+	}
+	for {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		data := make([]byte, size-1)
+		if _, err := io.ReadFull(br, data); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		var entry proto.LogEntry
+		if err := gogoproto.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		entries <- entry
+	}
+}
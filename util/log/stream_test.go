@@ -0,0 +1,85 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// readAll reads the stream, returning a description of each entry and
+// the error.
+func readAll(data []byte) ([]string, error) {
+	ch := make(chan proto.LogEntry)
+	errCh := make(chan error, 1)
+	go func() { errCh <- ReadEntryStream(bytes.NewReader(data), ch) }()
+	var entries []string
+	for entry := range ch {
+		entries = append(entries, describeEntry(&entry))
+	}
+	return entries, <-errCh
+}
+
+func describeEntry(entry *proto.LogEntry) string {
+	return fmt.Sprintf("%d %d %s:%d %s", entry.Severity, entry.Time, entry.File, entry.Line, formatMessage(entry))
+}
+
+func TestEntryStream(t *testing.T) {
+	exp := []proto.LogEntry{
+		{Severity: int32(errorLog), Time: 1, File: "a.go", Line: 1, Format: "x"},
+		{},
+		{Severity: int32(infoLog), Time: 3, Format: "%s", Args: []proto.LogEntry_Arg{{Str: "y"}}},
+	}
+	ch := make(chan proto.LogEntry, len(exp))
+	var expDescs []string
+	for _, entry := range exp {
+		ch <- entry
+		expDescs = append(expDescs, describeEntry(&entry))
+	}
+	close(ch)
+	var buf bytes.Buffer
+	if err := WriteEntryStream(&buf, ch); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	entries, err := readAll(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, expDescs) {
+		t.Errorf("expected %q; got %q", expDescs, entries)
+	}
+
+	// A stream cut short is reported, after the entries read so far.
+	entries, err = readAll(data[:len(data)-1])
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF; got %v", err)
+	}
+	if len(entries) != len(exp) {
+		t.Errorf("expected %d entries before the error; got %d", len(exp), len(entries))
+	}
+
+	data[0] = entryStreamVersion + 1
+	if _, err := readAll(data); err == nil {
+		t.Error("expected error for unknown version")
+	}
+}
@@ -35,6 +35,7 @@ func AddStructured(ctx context.Context, s severity, depth int, format string, ar
 	file, line := Caller(depth + 1)
 	entry := &proto.LogEntry{}
 	setLogEntry(ctx, format, args, entry)
+	setStackDepth(entry, depth+1)
 	logging.outputLogEntry(s, file, line, false, entry)
 }
 
@@ -75,9 +76,14 @@ func setLogEntry(ctx context.Context, format string, args []interface{}, entry *
 					entry.Method = gogoproto.Int32(int32(v.(proto.Method)))
 				case Key:
 					entry.Key = v.(proto.Key)
+				case TraceID:
+					entry.TraceID = gogoproto.String(v.(string))
 				}
 			}
 		}
+		if fields := contextFields(ctx); len(fields) > 0 {
+			entry.Fields = append([]proto.LogEntry_Field(nil), fields...)
+		}
 	}
 }
 
@@ -39,7 +39,7 @@ func (t testArg) String() string {
 
 func testContext() context.Context {
 	ctx := context.Background()
-	return Add(ctx, NodeID, proto.NodeID(1), StoreID, proto.StoreID(2), RaftID, int64(3), Method, proto.Get, Key, proto.Key("key"))
+	return Add(ctx, NodeID, proto.NodeID(1), StoreID, proto.StoreID(2), RaftID, int64(3), Method, proto.Get, Key, proto.Key("key"), TraceID, "trace")
 }
 
 func TestSetLogEntry(t *testing.T) {
@@ -53,14 +53,14 @@ func TestSetLogEntry(t *testing.T) {
 	}{
 		{nil, "", []interface{}{}, proto.LogEntry{}},
 		{ctx, "", []interface{}{}, proto.LogEntry{
-			NodeID: gogoproto.Int32(1), StoreID: gogoproto.Int32(2), RaftID: gogoproto.Int64(3), Method: gogoproto.Int32((int32)(proto.Get)), Key: []byte("key"),
+			NodeID: gogoproto.Int32(1), StoreID: gogoproto.Int32(2), RaftID: gogoproto.Int64(3), Method: gogoproto.Int32((int32)(proto.Get)), Key: []byte("key"), TraceID: gogoproto.String("trace"),
 		}},
 		{ctx, "no args", []interface{}{}, proto.LogEntry{
-			NodeID: gogoproto.Int32(1), StoreID: gogoproto.Int32(2), RaftID: gogoproto.Int64(3), Method: gogoproto.Int32((int32)(proto.Get)), Key: []byte("key"),
+			NodeID: gogoproto.Int32(1), StoreID: gogoproto.Int32(2), RaftID: gogoproto.Int64(3), Method: gogoproto.Int32((int32)(proto.Get)), Key: []byte("key"), TraceID: gogoproto.String("trace"),
 			Format: "no args",
 		}},
 		{ctx, "1 arg %s", []interface{}{"foo"}, proto.LogEntry{
-			NodeID: gogoproto.Int32(1), StoreID: gogoproto.Int32(2), RaftID: gogoproto.Int64(3), Method: gogoproto.Int32((int32)(proto.Get)), Key: []byte("key"),
+			NodeID: gogoproto.Int32(1), StoreID: gogoproto.Int32(2), RaftID: gogoproto.Int64(3), Method: gogoproto.Int32((int32)(proto.Get)), Key: []byte("key"), TraceID: gogoproto.String("trace"),
 			Format: "1 arg %s",
 			Args: []proto.LogEntry_Arg{
 				{Type: "string", Str: "foo"},
@@ -104,3 +104,35 @@ func TestSetLogEntry(t *testing.T) {
 		}
 	}
 }
+
+// TestWithField verifies that the fields attached to a context are
+// recorded in the entries logged with it and round-trip through the
+// files, and that entries logged without fields don't gain any.
+func TestWithField(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	ctx := WithField(context.Background(), "txn", "abc")
+	ctx = WithField(ctx, "epoch", 1)
+	lg.Infoc(WithField(ctx, "epoch", 2), "committed")
+	lg.Infoc(nil, "plain")
+	lg.Flush()
+
+	entries, err := lg.FetchEntriesMatching(InfoLevel, FetchQuery{ThreadID: int32(pid)}, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries; got %+v", entries)
+	}
+	if entries[0].Fields != nil {
+		t.Errorf("expected no fields; got %+v", entries[0].Fields)
+	}
+	exp := []proto.LogEntry_Field{{Key: "txn", Value: "abc"}, {Key: "epoch", Value: "2"}}
+	if !reflect.DeepEqual(entries[1].Fields, exp) {
+		t.Errorf("expected fields %+v; got %+v", exp, entries[1].Fields)
+	}
+	// The context the field replaced in is unchanged.
+	if fields := contextFields(ctx); len(fields) != 2 || fields[1].Value != "1" {
+		t.Errorf("expected the original fields to be kept; got %+v", fields)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// syslogAddr is the address of the syslog server the default Logger
+// mirrors its entries to, as set by the --log-syslog flag.
+var syslogAddr string
+
+var onceSyslog sync.Once
+
+// createSyslogSink registers a SyslogSink with the default Logger if the
+// --log-syslog flag is set. defaultLogger.mu is held.
+func createSyslogSink() {
+	if syslogAddr == "" {
+		return
+	}
+	network, addr := "udp", syslogAddr
+	if i := strings.Index(syslogAddr, "://"); i >= 0 {
+		network, addr = syslogAddr[:i], syslogAddr[i+len("://"):]
+	}
+	defaultLogger.sinks = append(defaultLogger.sinks, newBufferedSink(NewSyslogSink(network, addr)))
+}
+
+// syslogFacility is the syslog facility entries are logged under: user.
+const syslogFacility = 1
+
+// syslogSeverities maps the severities of entries to syslog severities.
+var syslogSeverities = [numSeverity]int{
+	infoLog:    6, // informational
+	warningLog: 4, // warning
+	errorLog:   3, // error
+	fatalLog:   2, // critical
+}
+
+// maxSyslogBacklog bounds the number of messages a SyslogSink keeps while
+// it can't reach the server. Beyond it, the oldest messages are dropped
+// and counted.
+const maxSyslogBacklog = 10000
+
+// syslogRetryInterval is how long a SyslogSink waits before reconnecting
+// to a server it failed to reach or send to. The wait doubles with each
+// consecutive failure, up to syslogMaxRetryInterval.
+var syslogRetryInterval = time.Second
+
+// syslogMaxRetryInterval bounds the backoff of a SyslogSink.
+var syslogMaxRetryInterval = 30 * time.Second
+
+// A SyslogSink forwards entries to a syslog server in the format of RFC
+// 5424, over UDP or, framed by octet counting as per RFC 6587, over TCP.
+// Entries are sent by a goroutine of the sink, so that logging never
+// waits for the network. While the server can't be reached, messages are
+// kept and sent once it can be again, reconnecting as needed; if too many
+// accumulate, the oldest are dropped, and a message reporting how many is
+// sent in their place.
+type SyslogSink struct {
+	network, addr string
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	backlog [][]byte // the formatted messages not yet sent
+	dropped int      // the messages dropped from the backlog
+	closed  bool
+	closing chan struct{} // closed by Close, to cut a backoff short
+	done    chan struct{}
+
+	// failures counts the failed dials and sends. It's accessed
+	// atomically.
+	failures int64
+}
+
+// NewSyslogSink returns a sink forwarding entries to the syslog server at
+// the given address, where network is "udp" or "tcp".
+func NewSyslogSink(network, addr string) *SyslogSink {
+	s := &SyslogSink{
+		network: network,
+		addr:    addr,
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	go s.run()
+	return s
+}
+
+// Write implements the EntrySink interface.
+func (s *SyslogSink) Write(entry proto.LogEntry) error {
+	msg := formatSyslogMessage(&entry)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.backlog) == maxSyslogBacklog {
+		s.backlog = s.backlog[1:]
+		s.dropped++
+	}
+	s.backlog = append(s.backlog, msg)
+	s.cond.Signal()
+	return nil
+}
+
+// Flush implements the EntrySink interface. Messages are sent as soon as
+// possible anyway, so there's nothing to do.
+func (s *SyslogSink) Flush() error {
+	return nil
+}
+
+// Close stops the sink once it has sent the messages it holds, or failed
+// to.
+func (s *SyslogSink) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.closing)
+	}
+	s.cond.Signal()
+	s.mu.Unlock()
+	<-s.done
+}
+
+// formatSyslogMessage formats the entry as a syslog message.
+func formatSyslogMessage(entry *proto.LogEntry) []byte {
+	pri := syslogFacility*8 + syslogSeverities[severity(entry.Severity)]
+	t := time.Unix(0, entry.Time).UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+	msg := strings.TrimSuffix(formatMessage(entry), "\n")
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d - - %s:%d %s",
+		pri, t, host, program, pid, entry.File, entry.Line, msg))
+}
+
+// run sends the backlog until the sink is closed.
+func (s *SyslogSink) run() {
+	defer close(s.done)
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	retryInterval := syslogRetryInterval
+	// backOff waits before the next attempt after a failed one, unless
+	// the sink is closed, in which case it returns false.
+	backOff := func(closed bool) bool {
+		atomic.AddInt64(&s.failures, 1)
+		if closed {
+			return false
+		}
+		select {
+		case <-time.After(retryInterval):
+		case <-s.closing:
+		}
+		if retryInterval *= 2; retryInterval > syslogMaxRetryInterval {
+			retryInterval = syslogMaxRetryInterval
+		}
+		return true
+	}
+	for {
+		s.mu.Lock()
+		for len(s.backlog) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.backlog) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		msg := s.backlog[0]
+		if s.dropped > 0 {
+			msg = []byte(fmt.Sprintf("<%d>1 - %s %s %d - - dropped %d messages while the syslog server was unreachable",
+				syslogFacility*8+syslogSeverities[warningLog], host, program, pid, s.dropped))
+		}
+		closed := s.closed
+		s.mu.Unlock()
+
+		if conn == nil {
+			var err error
+			if conn, err = net.DialTimeout(s.network, s.addr, 5*time.Second); err != nil {
+				conn = nil
+				if !backOff(closed) {
+					return
+				}
+				continue
+			}
+		}
+		if err := s.send(conn, msg); err != nil {
+			// Over UDP, dialing succeeds whether or not a server listens,
+			// so the failed sends must be backed off from as well.
+			conn.Close()
+			conn = nil
+			if !backOff(closed) {
+				return
+			}
+			continue
+		}
+		retryInterval = syslogRetryInterval
+
+		s.mu.Lock()
+		if s.dropped > 0 {
+			s.dropped = 0
+		} else {
+			s.backlog = s.backlog[1:]
+		}
+		s.mu.Unlock()
+	}
+}
+
+// send writes the message to the connection, framed if it's a stream.
+func (s *SyslogSink) send(conn net.Conn, msg []byte) error {
+	if s.network == "tcp" {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "%d ", len(msg))
+		buf.Write(msg)
+		msg = buf.Bytes()
+	}
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := conn.Write(msg)
+	return err
+}
@@ -0,0 +1,152 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func syslogTestEntry(sev severity, msg string) *proto.LogEntry {
+	return &proto.LogEntry{
+		Severity: int32(sev),
+		Time:     time.Now().UnixNano(),
+		File:     "syslog_test.go",
+		Line:     42,
+		Format:   "%s",
+		Args:     []proto.LogEntry_Arg{{Str: msg}},
+	}
+}
+
+// TestSyslogSinkUDP verifies that entries are forwarded as RFC 5424
+// messages with the syslog severity matching theirs.
+func TestSyslogSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := NewSyslogSink("udp", conn.LocalAddr().String())
+	defer s.Close()
+	s.Write(*syslogTestEntry(errorLog, "disk on fire"))
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<11>1 ") {
+		t.Errorf("expected priority 11 (user.err), got %q", msg)
+	}
+	if !strings.HasSuffix(msg, " syslog_test.go:42 disk on fire") {
+		t.Errorf("expected message to end with the entry, got %q", msg)
+	}
+}
+
+// TestSyslogSinkReconnect verifies that entries written while the server
+// is unreachable are kept and sent once it is reachable.
+func TestSyslogSinkReconnect(t *testing.T) {
+	defer func(d time.Duration) { syslogRetryInterval = d }(syslogRetryInterval)
+	syslogRetryInterval = 10 * time.Millisecond
+
+	// Find a free port, then close the listener so that dialing fails.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	s := NewSyslogSink("tcp", addr)
+	defer s.Close()
+	for i := 0; i < 3; i++ {
+		s.Write(*syslogTestEntry(infoLog, "entry "+strconv.Itoa(i)))
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Skipf("couldn't listen on %s again: %s", addr, err)
+	}
+	defer ln.Close()
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(c)
+	for i := 0; i < 3; i++ {
+		l, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(l, " "))
+		if err != nil {
+			t.Fatalf("bad frame length %q", l)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(msg), "<14>1 ") {
+			t.Errorf("expected priority 14 (user.info), got %q", msg)
+		}
+		if want := "entry " + strconv.Itoa(i); !strings.HasSuffix(string(msg), want) {
+			t.Errorf("expected %q, got %q", want, msg)
+		}
+	}
+}
+
+// TestSyslogSinkBackoff verifies that a sink whose sends fail, as they do
+// over UDP to a closed port, waits between attempts rather than spinning.
+func TestSyslogSinkBackoff(t *testing.T) {
+	defer func(d, max time.Duration) {
+		syslogRetryInterval, syslogMaxRetryInterval = d, max
+	}(syslogRetryInterval, syslogMaxRetryInterval)
+	syslogRetryInterval, syslogMaxRetryInterval = 10*time.Millisecond, 20*time.Millisecond
+
+	// Find a free port, then close it so that sends are refused.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	s := NewSyslogSink("udp", addr)
+	for i := 0; i < 1000; i++ {
+		s.Write(*syslogTestEntry(infoLog, "entry "+strconv.Itoa(i)))
+	}
+	const wait = 200 * time.Millisecond
+	time.Sleep(wait)
+	s.Close()
+	// At most one failure per retry interval, allowing for slow timers.
+	// Without backoff, there would be thousands.
+	if failures, max := atomic.LoadInt64(&s.failures), int64(2*wait/syslogRetryInterval); failures > max {
+		t.Errorf("expected at most %d failed attempts; got %d", max, failures)
+	}
+}
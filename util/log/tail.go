@@ -0,0 +1,395 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
+	"github.com/cockroachdb/cockroach/util/encoding"
+	gogoproto "github.com/gogo/protobuf/proto"
+)
+
+// gzipMagic are the first bytes of gzip-compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// TailN returns the last n entries of the log file, in the order they
+// were written. The file name is interpreted as by GetLogReader, with
+// absolute paths allowed.
+//
+// The strategy depends on the file. Entries are framed by a length
+// prefix which can only be followed forward, so both strategies make a
+// forward pass; memory is bounded by n in either case:
+//   - For plain files, the pass only reads the length prefixes and seeks
+//     past the entries, remembering the offsets of the last n. Only
+//     those n entries are read and decoded, so memory is O(n) offsets
+//     plus the n entries returned.
+//   - Gzip-compressed files, recognized by their magic bytes, can't seek,
+//     so the pass decompresses the whole file and keeps the last n
+//     encoded entries in a ring, decoding only those. Memory is O(n)
+//     encoded entries plus the decompressor's window.
+//
+// A partially written entry at the end of the file is ignored.
+func TailN(filename string, n int) ([]proto.LogEntry, error) {
+	return defaultLogger.TailN(filename, n)
+}
+
+// TailN returns the last n entries of the log file, which is looked up in
+// the Logger's directories, as described by the package-level TailN.
+func (lg *Logger) TailN(filename string, n int) ([]proto.LogEntry, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	reader, err := lg.GetLogReader(filename, true /* allowAbsolute */)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	br := bufio.NewReader(reader)
+	head, err := br.Peek(len(gzipMagic))
+	if err == nil && bytes.Equal(head, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return tailStream(gz, n)
+	}
+	if f, ok := reader.(*os.File); ok {
+		// tailSeekable starts over at the beginning of the file.
+		return tailSeekable(f, n)
+	}
+	return tailStream(br, n)
+}
+
+// tailSeekable returns the last n entries of an uncompressed log file.
+func tailSeekable(f io.ReadSeeker, n int) ([]proto.LogEntry, error) {
+	size, err := f.Seek(0, os.SEEK_END)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+
+	offsets := make([]int64, 0, n)
+	var next int // the oldest offset in offsets once it is full
+	var szBuf [4]byte
+	for offset := int64(0); offset+int64(len(szBuf)) <= size; {
+		if _, err := io.ReadFull(f, szBuf[:]); err != nil {
+			return nil, err
+		}
+		if preamble, _, err := readPreamble(szBuf[:], f); err != nil {
+			return nil, err
+		} else if preamble > 0 {
+			offset += preamble
+			continue
+		}
+		_, sz := encoding.DecodeUint32(szBuf[:])
+		end := offset + int64(len(szBuf)) + int64(sz)
+		if end > size {
+			break
+		}
+		if len(offsets) < n {
+			offsets = append(offsets, offset)
+		} else {
+			offsets[next] = offset
+			next = (next + 1) % n
+		}
+		if _, err := f.Seek(end, os.SEEK_SET); err != nil {
+			return nil, err
+		}
+		offset = end
+	}
+	if len(offsets) == 0 {
+		return nil, nil
+	}
+
+	if _, err := f.Seek(offsets[next], os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	entries := make([]proto.LogEntry, len(offsets))
+	for i := range entries {
+		data, err := readEntryData(f)
+		if err != nil {
+			return nil, err
+		}
+		if err := gogoproto.Unmarshal(data, &entries[i]); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// tailStream returns the last n entries read from r, keeping only the
+// encoded data of the last n in memory.
+func tailStream(r io.Reader, n int) ([]proto.LogEntry, error) {
+	ring := make([][]byte, 0, n)
+	var next int // the oldest entry in ring once it is full
+	for {
+		data, err := readEntryData(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(ring) < n {
+			ring = append(ring, data)
+		} else {
+			ring[next] = data
+			next = (next + 1) % n
+		}
+	}
+
+	entries := make([]proto.LogEntry, len(ring))
+	for i := range entries {
+		if err := gogoproto.Unmarshal(ring[(next+i)%len(ring)], &entries[i]); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// ReadEntryAt reads the single entry at the given byte offset of the log
+// file, as reported by EntryDecoder.Offset. The file name is interpreted
+// as by GetLogReader, with absolute paths allowed. As entries can only be
+// located by following their length prefixes from the beginning of the
+// file, those are followed (without reading the entries) to validate
+// that the offset lies on an entry boundary. Compressed files are not
+// supported.
+func ReadEntryAt(filename string, offset int64) (proto.LogEntry, error) {
+	return defaultLogger.ReadEntryAt(filename, offset)
+}
+
+// ReadEntryAt reads the single entry at the given byte offset of the log
+// file, which is looked up in the Logger's directories, as described by
+// the package-level ReadEntryAt.
+func (lg *Logger) ReadEntryAt(filename string, offset int64) (proto.LogEntry, error) {
+	var entry proto.LogEntry
+	reader, err := lg.GetLogReader(filename, true /* allowAbsolute */)
+	if err != nil {
+		return entry, err
+	}
+	defer reader.Close()
+	f, ok := reader.(*os.File)
+	if !ok {
+		return entry, util.Errorf("%s: file is not seekable", filename)
+	}
+	var magic [2]byte
+	if _, err := io.ReadFull(f, magic[:]); err == nil && bytes.Equal(magic[:], gzipMagic) {
+		return entry, util.Errorf("%s: cannot read entries of compressed files by offset", filename)
+	}
+
+	var szBuf [4]byte
+	for pos := int64(0); pos != offset; {
+		if pos > offset {
+			return entry, util.Errorf("%s: offset %d is not at an entry boundary", filename, offset)
+		}
+		if _, err := f.Seek(pos, os.SEEK_SET); err != nil {
+			return entry, err
+		}
+		if _, err := io.ReadFull(f, szBuf[:]); err != nil {
+			return entry, util.Errorf("%s: offset %d is beyond the last entry", filename, offset)
+		}
+		if preamble, _, err := readPreamble(szBuf[:], f); err != nil {
+			return entry, err
+		} else if preamble > 0 {
+			pos += preamble
+			continue
+		}
+		_, sz := encoding.DecodeUint32(szBuf[:])
+		pos += int64(len(szBuf)) + int64(sz)
+	}
+	if _, err := f.Seek(offset, os.SEEK_SET); err != nil {
+		return entry, err
+	}
+	data, err := readEntryData(f)
+	if err == io.EOF {
+		return entry, util.Errorf("%s: offset %d is beyond the last entry", filename, offset)
+	} else if err != nil {
+		return entry, err
+	}
+	err = gogoproto.Unmarshal(data, &entry)
+	return entry, err
+}
+
+// readEntryData reads the next length-prefixed encoded entry from r. It
+// returns io.EOF at the end of the data and io.ErrUnexpectedEOF if the
+// last entry is incomplete.
+func readEntryData(r io.Reader) ([]byte, error) {
+	var szBuf [4]byte
+	if _, err := io.ReadFull(r, szBuf[:]); err != nil {
+		return nil, err
+	}
+	if preamble, _, err := readPreamble(szBuf[:], r); err != nil {
+		return nil, err
+	} else if preamble > 0 {
+		return readEntryData(r)
+	}
+	_, sz := encoding.DecodeUint32(szBuf[:])
+	data := make([]byte, sz)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// entryTime returns the Time field of an encoded entry without decoding
+// the rest of it. Time is the second field, so usually only the first two
+// fields are looked at.
+func entryTime(data []byte) (int64, error) {
+	_, t, _, err := entryHeader(data)
+	return t, err
+}
+
+// entryHeader returns the Severity and Time fields of an encoded entry
+// without decoding the rest of it. Fields are encoded in order, so it
+// stops at Time; found reports whether Time was reached before the end of
+// the data, which may be a prefix of the entry. Omitted fields are zero.
+func entryHeader(data []byte) (sev int32, t int64, found bool, err error) {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, 0, false, util.Errorf("invalid encoded log entry")
+		}
+		data = data[n:]
+		field, wireType := key>>3, key&0x7
+		if (field == 1 || field == 2) && wireType == 0 {
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return 0, 0, false, util.Errorf("invalid encoded log entry")
+			}
+			if field == 2 {
+				return sev, int64(v), true, nil
+			}
+			sev, data = int32(v), data[n:]
+			continue
+		}
+		var skip uint64
+		switch wireType {
+		case 0:
+			_, n = binary.Uvarint(data)
+			skip = uint64(n)
+		case 1:
+			skip = 8
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 {
+				return 0, 0, false, util.Errorf("invalid encoded log entry")
+			}
+			skip = uint64(n) + length
+		case 5:
+			skip = 4
+		default:
+			return 0, 0, false, util.Errorf("invalid wire type %d in encoded log entry", wireType)
+		}
+		if skip == 0 || skip > uint64(len(data)) {
+			return 0, 0, false, util.Errorf("invalid encoded log entry")
+		}
+		data = data[skip:]
+	}
+	// Time is zero and was thus omitted, or lies beyond the data.
+	return sev, 0, false, nil
+}
+
+// FirstEntries returns the first entry of each log file of the given
+// level, keyed by file name, reading only that entry from each file. This
+// gives per-file anchors for a timeline. Files without any complete entry
+// are reported with a zero entry.
+func FirstEntries(level Level) (map[string]proto.LogEntry, error) {
+	return defaultLogger.FirstEntries(level)
+}
+
+// FirstEntries returns the first entry of each of the Logger's log files
+// of the given level, as described by the package-level FirstEntries.
+func (lg *Logger) FirstEntries(level Level) (map[string]proto.LogEntry, error) {
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		return nil, err
+	}
+	entries := map[string]proto.LogEntry{}
+	for _, file := range files {
+		if file.Details.Level != level {
+			continue
+		}
+		entry, err := lg.firstEntry(file.Name)
+		if err != nil {
+			return nil, err
+		}
+		entries[file.Name] = entry
+	}
+	return entries, nil
+}
+
+// firstEntry reads the first entry of the log file, or returns a zero
+// entry if the file has no complete entry.
+func (lg *Logger) firstEntry(filename string) (proto.LogEntry, error) {
+	var entry proto.LogEntry
+	reader, err := lg.GetLogReader(filename, false /* !allowAbsolute */)
+	if err != nil {
+		return entry, err
+	}
+	defer reader.Close()
+	if err := NewEntryDecoder(reader).Decode(&entry); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return entry, err
+	}
+	return entry, nil
+}
+
+// A TimeRange is a span of time in unix nanos, inclusive.
+type TimeRange struct {
+	Start, End int64
+}
+
+// FileTimeRanges returns the times of the first and the last entry of each
+// log file of the given level, keyed by file name. Only those two entries
+// are decoded. Files without any complete entry are omitted.
+func FileTimeRanges(level Level) (map[string]TimeRange, error) {
+	return defaultLogger.FileTimeRanges(level)
+}
+
+// FileTimeRanges returns the time ranges of the Logger's log files of the
+// given level, as described by the package-level FileTimeRanges.
+func (lg *Logger) FileTimeRanges(level Level) (map[string]TimeRange, error) {
+	firsts, err := lg.FirstEntries(level)
+	if err != nil {
+		return nil, err
+	}
+	ranges := map[string]TimeRange{}
+	for name, first := range firsts {
+		// The last entry is read backward, or forward by TailN if the
+		// file can't be.
+		last, err := lg.ReadLastEntries(FileInfo{Name: name}, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(last) == 0 {
+			continue
+		}
+		ranges[name] = TimeRange{Start: first.Time, End: last[0].Time}
+	}
+	return ranges, nil
+}
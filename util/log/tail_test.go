@@ -0,0 +1,188 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func TestTailN(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	for i := 0; i < 5; i++ {
+		lg.Infoc(nil, "entry %d", i)
+	}
+	lg.Flush()
+	plain, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A compressed copy of the file, and a copy whose last entry is torn.
+	compressed := filepath.Join(filepath.Dir(plain), "cockroach.host.user.log.INFO.20150609-161048.1-gz")
+	f, err := os.Create(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	torn := filepath.Join(filepath.Dir(plain), "cockroach.host.user.log.INFO.20150609-161048.1-torn")
+	if err := ioutil.WriteFile(torn, append(data, 0, 0, 0, 10, 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{plain, compressed, torn} {
+		for _, test := range []struct {
+			n   int
+			exp []string
+		}{
+			{0, nil},
+			{2, []string{"entry 3", "entry 4"}},
+			{5, []string{"entry 0", "entry 1", "entry 2", "entry 3", "entry 4"}},
+		} {
+			entries, err := lg.TailN(name, test.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var msgs []string
+			for i := range entries {
+				msgs = append(msgs, formatMessage(&entries[i]))
+			}
+			if !reflect.DeepEqual(msgs, test.exp) {
+				t.Errorf("%s, n=%d: expected %q; got %q", filepath.Base(name), test.n, test.exp, msgs)
+			}
+		}
+		// Asking for more entries than there are includes the header.
+		if entries, err := lg.TailN(name, 100); err != nil {
+			t.Fatal(err)
+		} else if len(entries) != 7 {
+			t.Errorf("%s: expected 7 entries; got %d", filepath.Base(name), len(entries))
+		}
+	}
+}
+
+func TestReadEntryAt(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	for i := 0; i < 3; i++ {
+		lg.Infoc(nil, "entry %d", i)
+	}
+	lg.Flush()
+	name, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Collect the offsets of all entries while decoding the file.
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	decoder := NewEntryDecoder(f)
+	offsets := map[string]int64{}
+	for {
+		offset := decoder.Offset()
+		var entry proto.LogEntry
+		if err := decoder.Decode(&entry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatal(err)
+		}
+		offsets[formatMessage(&entry)] = offset
+	}
+	end := decoder.Offset()
+
+	for _, msg := range []string{"entry 0", "entry 1", "entry 2"} {
+		entry, err := lg.ReadEntryAt(name, offsets[msg])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatMessage(&entry); got != msg {
+			t.Errorf("offset %d: expected %q; got %q", offsets[msg], msg, got)
+		}
+	}
+	for _, offset := range []int64{offsets["entry 1"] + 1, end, end + 100, -1} {
+		if _, err := lg.ReadEntryAt(name, offset); err == nil {
+			t.Errorf("offset %d: expected error", offset)
+		}
+	}
+}
+
+func TestFirstEntriesAndTimeRanges(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.Warningc(nil, "x")
+	lg.Flush()
+	active, err := lg.ActiveLogFile(WarningLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := "cockroach.host.user.log.WARNING.20150609-161048.1"
+	if err := ioutil.WriteFile(filepath.Join(filepath.Dir(active), empty), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	firsts, err := lg.FirstEntries(WarningLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(firsts) != 2 {
+		t.Fatalf("expected 2 files; got %+v", firsts)
+	}
+	first, ok := firsts[filepath.Base(active)]
+	if !ok || !strings.HasPrefix(first.Format, "Running on machine") {
+		t.Errorf("expected the header as first entry; got %+v", first)
+	}
+	if entry, ok := firsts[empty]; !ok || entry.Time != 0 {
+		t.Errorf("expected empty file with zero entry; got %+v, %t", entry, ok)
+	}
+
+	ranges, err := lg.FileTimeRanges(WarningLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := lg.TailN(active, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]TimeRange{filepath.Base(active): {first.Time, last[0].Time}}
+	if !reflect.DeepEqual(ranges, exp) {
+		t.Errorf("expected %+v; got %+v", exp, ranges)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// A TemplateRule replaces the parts of log messages which match Pattern
+// by Placeholder when computing message templates.
+type TemplateRule struct {
+	Pattern     *regexp.Regexp
+	Placeholder string
+}
+
+// TemplateRules are the rules by which DistinctTemplates normalizes
+// messages, applied in order. By default, UUIDs become "<uuid>",
+// hexadecimal numbers (prefixed with "0x", or mixing decimal digits and
+// lowercase letters a-f) become "<hex>", and any remaining runs of
+// decimal digits become "<num>". The rules may be replaced, but not
+// while DistinctTemplates is running.
+var TemplateRules = []TemplateRule{
+	{regexp.MustCompile(`\b[0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b(?:0x[0-9a-fA-F]+|[0-9a-f]*(?:[0-9][0-9a-f]*[a-f]|[a-f][0-9a-f]*[0-9])[0-9a-f]*)\b`), "<hex>"},
+	{regexp.MustCompile(`[0-9]+`), "<num>"},
+}
+
+// A Template is a normalized log message and the number of entries
+// sharing it.
+type Template struct {
+	Template string
+	Count    int
+}
+
+// messageTemplate normalizes the message according to TemplateRules.
+func messageTemplate(msg string) string {
+	for _, rule := range TemplateRules {
+		msg = rule.Pattern.ReplaceAllLiteralString(msg, rule.Placeholder)
+	}
+	return msg
+}
+
+// DistinctTemplates returns the distinct templates of the messages of the
+// log entries on disk which are of the given level of severity (or worse)
+// and whose times lie between startTimestamp and endTimestamp, inclusive,
+// in unix nanos. Templates are sorted by decreasing count.
+func DistinctTemplates(level Level, startTimestamp, endTimestamp int64) ([]Template, error) {
+	return defaultLogger.DistinctTemplates(level, startTimestamp, endTimestamp)
+}
+
+// DistinctTemplates returns the distinct templates of the messages of the
+// log entries in the Logger's directories, as described by the
+// package-level DistinctTemplates. As entries are only counted, the
+// result is not limited by EntriesCutoff.
+func (lg *Logger) DistinctTemplates(level Level, startTimestamp, endTimestamp int64) ([]Template, error) {
+	counts := map[string]int{}
+	// Count every entry in range without retaining any.
+	count := func(entry *proto.LogEntry) bool {
+		counts[messageTemplate(formatMessage(entry))]++
+		return false
+	}
+	if _, _, err := lg.fetchEntries(level, startTimestamp, endTimestamp, fetchOptions{match: count}); err != nil {
+		return nil, err
+	}
+
+	templates := make([]Template, 0, len(counts))
+	for template, count := range counts {
+		templates = append(templates, Template{Template: template, Count: count})
+	}
+	sort.Sort(templatesByCount(templates))
+	return templates, nil
+}
+
+// templatesByCount sorts templates by decreasing count, and then by
+// template.
+type templatesByCount []Template
+
+func (t templatesByCount) Len() int      { return len(t) }
+func (t templatesByCount) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t templatesByCount) Less(i, j int) bool {
+	if t[i].Count != t[j].Count {
+		return t[i].Count > t[j].Count
+	}
+	return t[i].Template < t[j].Template
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMessageTemplate(t *testing.T) {
+	for _, test := range []struct {
+		msg, exp string
+	}{
+		{"range 12 split at key 1433866248", "range <num> split at key <num>"},
+		{"node3 joined", "node<num> joined"},
+		{"txn 6ba7b810-9dad-11d1-80b4-00c04fd430c8 aborted", "txn <uuid> aborted"},
+		{"pointer 0xc20801e000, checksum deadbeef42", "pointer <hex>, checksum <hex>"},
+		{"a decade of beef", "a decade of beef"},
+	} {
+		if template := messageTemplate(test.msg); template != test.exp {
+			t.Errorf("%q: expected %q; got %q", test.msg, test.exp, template)
+		}
+	}
+}
+
+func TestDistinctTemplates(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	for i := 0; i < 3; i++ {
+		lg.Warningc(nil, "range %d split", i)
+	}
+	lg.Warningc(nil, "gossip connected to node%d", 7)
+	lg.Flush()
+
+	templates, err := lg.DistinctTemplates(WarningLevel, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Ignore the templates of the file headers.
+	var logged []Template
+	for _, template := range templates {
+		if !strings.HasPrefix(template.Template, "Running on machine") && !strings.HasPrefix(template.Template, "Binary") {
+			logged = append(logged, template)
+		}
+	}
+	exp := []Template{
+		{"range <num> split", 3},
+		{"gossip connected to node<num>", 1},
+	}
+	if !reflect.DeepEqual(logged, exp) {
+		t.Errorf("expected %+v; got %+v", exp, logged)
+	}
+}
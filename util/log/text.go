@@ -0,0 +1,47 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// FormatEntry formats the entry in the layout of the lines logged to
+// stderr, "Lmmdd hh:mm:ss.uuuuuu threadid file:line] msg", in local time.
+// Multi-line messages and stacks, if any, follow on the next lines; no
+// final newline is added.
+func FormatEntry(entry proto.LogEntry) string {
+	return strings.TrimSuffix(string(formatLogEntry(&entry, nil)), "\n")
+}
+
+// A TextEntryEncoder writes log entries in the layout of FormatEntry,
+// each followed by a newline, as they're logged to stderr.
+type TextEntryEncoder struct {
+	w io.Writer
+}
+
+// NewTextEntryEncoder returns an encoder writing to w.
+func NewTextEntryEncoder(w io.Writer) *TextEntryEncoder {
+	return &TextEntryEncoder{w: w}
+}
+
+// Encode writes the entry followed by a newline.
+func (e *TextEntryEncoder) Encode(entry *proto.LogEntry) error {
+	return textEncoding{}.EncodeEntry(e.w, entry)
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+func TestFormatEntry(t *testing.T) {
+	entry := proto.LogEntry{
+		Severity: int32(warningLog),
+		Time:     time.Date(2015, 6, 9, 16, 10, 48, 123456789, time.Local).UnixNano(),
+		ThreadID: 4242,
+		File:     "kv/txn.go",
+		Line:     123,
+		Format:   "retrying %s",
+		Args:     []proto.LogEntry_Arg{{Str: "txn"}},
+	}
+	const exp = "W0609 16:10:48.123456    4242 kv/txn.go:123] retrying txn"
+	if s := FormatEntry(entry); s != exp {
+		t.Errorf("expected %q; got %q", exp, s)
+	}
+
+	var buf bytes.Buffer
+	enc := NewTextEntryEncoder(&buf)
+	for i := 0; i < 2; i++ {
+		if err := enc.Encode(&entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := buf.String(); s != exp+"\n"+exp+"\n" {
+		t.Errorf("expected two lines of %q; got %q", exp, s)
+	}
+}
+
+func TestFormatEntryFields(t *testing.T) {
+	entry := proto.LogEntry{
+		Severity: int32(infoLog),
+		Time:     time.Date(2015, 6, 9, 16, 10, 48, 123456789, time.Local).UnixNano(),
+		ThreadID: 4242,
+		File:     "kv/txn.go",
+		Line:     123,
+		Format:   "committed",
+		Fields:   []proto.LogEntry_Field{{Key: "txn", Value: "abc"}, {Key: "epoch", Value: "2"}},
+	}
+	const exp = "I0609 16:10:48.123456    4242 kv/txn.go:123] [txn=abc,epoch=2] committed"
+	if s := FormatEntry(entry); s != exp {
+		t.Errorf("expected %q; got %q", exp, s)
+	}
+}
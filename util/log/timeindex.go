@@ -0,0 +1,218 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// timeIndexSuffix is appended to the name of a log file to form the name
+// of its time index.
+const timeIndexSuffix = ".times"
+
+// indexSuffixes are the suffixes of the indexes kept next to log files,
+// which are removed and moved along with them.
+var indexSuffixes = []string{categoryIndexSuffix, timeIndexSuffix}
+
+// timeIndexGranularity is the interval of entry times a time index holds
+// a record for.
+var timeIndexGranularity = time.Minute
+
+// timeIndexSlack is how far out of order the entries of a file may be, as
+// happens when goroutines race to write. Fetches seek to a record at
+// least this much before their start time.
+const timeIndexSlack = time.Second
+
+// timeIndexRecordSize is the size of a record of a time index: the time
+// of an entry and its offset in the file, as big-endian int64s.
+const timeIndexRecordSize = 16
+
+// A timeIndexRecord locates the first entry of a file logged in an
+// interval of timeIndexGranularity.
+type timeIndexRecord struct {
+	time, offset int64
+}
+
+// BuildTimeIndex brings the time index of the log file up to date. See
+// Logger.BuildTimeIndex.
+func BuildTimeIndex(file FileInfo) error {
+	return defaultLogger.BuildTimeIndex(file)
+}
+
+// BuildTimeIndex brings the time index of one of the Logger's files up to
+// date. The index is kept next to the file and records the offset of the
+// first entry of each minute, so that fetches starting late in a long
+// file seek close to their start rather than read the file from its
+// beginning. Indexing is incremental: records for the entries appended
+// since the last call are appended to the index. Fetches read files whose
+// index is missing or doesn't match them from their beginning.
+func (lg *Logger) BuildTimeIndex(file FileInfo) error {
+	path, err := lg.findLogFile(file.Name)
+	if err != nil {
+		return err
+	}
+	records, err := loadTimeIndex(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if len(records) > 0 && !verifyTimeIndexRecord(f, records[len(records)-1]) {
+		// The file doesn't match the index, which is rebuilt.
+		records = nil
+	}
+
+	// Scanning resumes at the last record, whose interval may have grown.
+	var start int64
+	if len(records) > 0 {
+		start = records[len(records)-1].offset
+	}
+	if _, err := f.Seek(start, 0); err != nil {
+		return err
+	}
+	d := NewEntryDecoder(bufio.NewReader(f))
+	var added []timeIndexRecord
+	last := int64(-1)
+	if len(records) > 0 {
+		last = records[len(records)-1].time / int64(timeIndexGranularity)
+	}
+	for {
+		offset := start + d.Offset()
+		data, err := d.next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		t, err := entryTime(data)
+		if err != nil {
+			continue
+		}
+		if interval := t / int64(timeIndexGranularity); interval > last {
+			if len(records) == 0 && len(added) == 0 {
+				// The first record is for the beginning of the file, which
+				// may hold a preamble before the first entry.
+				offset = 0
+			}
+			added = append(added, timeIndexRecord{time: t, offset: offset})
+			last = interval
+		}
+	}
+	if records == nil {
+		return writeFileAtomically(osFileSystem{}, path+timeIndexSuffix, encodeTimeIndex(added))
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	idx, err := os.OpenFile(path+timeIndexSuffix, os.O_APPEND|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	if _, err := idx.Write(encodeTimeIndex(added)); err != nil {
+		idx.Close()
+		return err
+	}
+	return idx.Close()
+}
+
+// findLogFile returns the path of the log file of the given name in the
+// Logger's directories.
+func (lg *Logger) findLogFile(name string) (string, error) {
+	for _, dir := range lg.searchDirs() {
+		if path := filepath.Join(dir, name); verifyFile(lg.fileSystem(), path) == nil {
+			return path, nil
+		}
+	}
+	return "", readerErrorf(os.ErrNotExist, "log file %s not found in any log dir", name)
+}
+
+// encodeTimeIndex encodes the records of a time index.
+func encodeTimeIndex(records []timeIndexRecord) []byte {
+	data := make([]byte, 0, len(records)*timeIndexRecordSize)
+	var buf [timeIndexRecordSize]byte
+	for _, r := range records {
+		binary.BigEndian.PutUint64(buf[:8], uint64(r.time))
+		binary.BigEndian.PutUint64(buf[8:], uint64(r.offset))
+		data = append(data, buf[:]...)
+	}
+	return data
+}
+
+// loadTimeIndex reads the time index of the log file. A partially
+// written last record is ignored.
+func loadTimeIndex(path string) ([]timeIndexRecord, error) {
+	data, err := ioutil.ReadFile(path + timeIndexSuffix)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]timeIndexRecord, 0, len(data)/timeIndexRecordSize)
+	for ; len(data) >= timeIndexRecordSize; data = data[timeIndexRecordSize:] {
+		records = append(records, timeIndexRecord{
+			time:   int64(binary.BigEndian.Uint64(data[:8])),
+			offset: int64(binary.BigEndian.Uint64(data[8:])),
+		})
+	}
+	return records, nil
+}
+
+// verifyTimeIndexRecord returns whether the record matches the file: an
+// entry of the recorded time starts at the recorded offset, unless that
+// is the beginning of the file.
+func verifyTimeIndexRecord(f *os.File, r timeIndexRecord) bool {
+	if r.offset == 0 {
+		return true
+	}
+	data, err := readEntryData(io.NewSectionReader(f, r.offset, 1<<62))
+	if err != nil {
+		return false
+	}
+	t, err := entryTime(data)
+	return err == nil && t == r.time
+}
+
+// seekTimeIndex positions the log file at an entry before which all
+// entries are from before startTimestamp, according to its time index,
+// and returns whether it skipped any entries. Files without a matching
+// index are left at their beginning.
+func seekTimeIndex(f *os.File, startTimestamp int64) (bool, error) {
+	records, err := loadTimeIndex(f.Name())
+	if err != nil || len(records) == 0 {
+		return false, nil
+	}
+	var r timeIndexRecord
+	for _, rec := range records {
+		if rec.time > startTimestamp-int64(timeIndexSlack) {
+			break
+		}
+		r = rec
+	}
+	if r.offset == 0 || !verifyTimeIndexRecord(f, r) {
+		return false, nil
+	}
+	if _, err := f.Seek(r.offset, 0); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// timeIndexFixture returns the encoded entries logged every ten seconds
+// from start for the given duration.
+func timeIndexFixture(start time.Time, from, until time.Duration) []byte {
+	var data []byte
+	for d := from; d < until; d += 10 * time.Second {
+		data = append(data, encodeLogEntry(&proto.LogEntry{
+			Time:   start.Add(d).UnixNano(),
+			File:   "file.go",
+			Format: d.String(),
+		})...)
+	}
+	return data
+}
+
+func TestTimeIndex(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	start := time.Date(2015, 6, 9, 16, 10, 0, 0, time.Local)
+	name := "cockroach.host.user.log.INFO." + start.Format(logFileTimeFormat) + ".1"
+	path := filepath.Join(lg.logDirs()[0], name)
+	data := append(append([]byte(nil), filePrelude...), timeIndexFixture(start, 0, 10*time.Minute)...)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fetch := func(from time.Duration) []proto.LogEntry {
+		entries, err := lg.FetchEntriesFromFiles(InfoLevel, start.Add(from).UnixNano(), start.Add(time.Hour).UnixNano())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+	unindexed := fetch(5*time.Minute + 5*time.Second)
+
+	if err := lg.BuildTimeIndex(FileInfo{Name: name}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := loadTimeIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 10 || records[0].offset != 0 {
+		t.Fatalf("expected 10 records starting at offset 0; got %+v", records)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped, err := seekTimeIndex(f, start.Add(5*time.Minute+5*time.Second).UnixNano())
+	offset, _ := f.Seek(0, 1)
+	f.Close()
+	if err != nil || !skipped || offset != records[5].offset {
+		t.Errorf("expected to seek to %d; got %d, %t, %v", records[5].offset, offset, skipped, err)
+	}
+	if indexed := fetch(5*time.Minute + 5*time.Second); !reflect.DeepEqual(indexed, unindexed) {
+		t.Errorf("expected %d entries as without the index; got %d", len(unindexed), len(indexed))
+	}
+
+	// Entries appended later are indexed incrementally.
+	more := timeIndexFixture(start, 10*time.Minute, 15*time.Minute)
+	if err := ioutil.WriteFile(path, append(data, more...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := lg.BuildTimeIndex(FileInfo{Name: name}); err != nil {
+		t.Fatal(err)
+	}
+	grown, err := loadTimeIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grown) != 15 || !reflect.DeepEqual(grown[:10], records) {
+		t.Errorf("expected 5 records to be appended to %+v; got %+v", records, grown)
+	}
+
+	// A file which doesn't match its index is read from its beginning.
+	data = timeIndexFixture(start, 0, 12*time.Minute+3*time.Second)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries := fetch(11 * time.Minute)
+	if len(entries) != 7 || entries[len(entries)-1].Format != (11*time.Minute).String() {
+		t.Errorf("expected 7 entries from 11m on; got %+v", entries)
+	}
+}
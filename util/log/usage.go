@@ -0,0 +1,40 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+// LogDiskUsage returns the disk space used by the log files of the
+// default Logger. See Logger.LogDiskUsage.
+func LogDiskUsage() (map[Level]int64, int64, error) {
+	return defaultLogger.LogDiskUsage()
+}
+
+// LogDiskUsage returns the number of bytes the log files in the Logger's
+// directories take up on disk, by level and in total, as ListLogFiles
+// reports them. Compressed log files count for their compressed size.
+// Index files and links don't count.
+func (lg *Logger) LogDiskUsage() (map[Level]int64, int64, error) {
+	files, err := lg.ListLogFiles()
+	if err != nil {
+		return nil, 0, err
+	}
+	usage := map[Level]int64{}
+	var total int64
+	for _, file := range files {
+		usage[file.Details.Level] += file.SizeBytes
+		total += file.SizeBytes
+	}
+	return usage, total, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLogDiskUsage(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	for name, size := range map[string]int{
+		"cockroach.host.user.log.INFO.20150609-161048.1":        100,
+		"cockroach.host.user.log.INFO.20150609-161049.1.gz":     30,
+		"cockroach.host.user.log.WARNING.20150609-161048.1":     50,
+		"cockroach.host.user.log.WARNING.20150609-161048.1.bz2": 20,
+		"cockroach.host.user.log.ERROR.20150609-161048.1":       7,
+		// Neither index files nor other files count.
+		"cockroach.host.user.log.INFO.20150609-161048.1.times": 16,
+		"README": 1000,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usage, total, err := lg.LogDiskUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[Level]int64{InfoLevel: 130, WarningLevel: 70, ErrorLevel: 7}
+	if !reflect.DeepEqual(usage, exp) {
+		t.Errorf("expected %v; got %v", exp, usage)
+	}
+	if total != 207 {
+		t.Errorf("expected a total of 207 bytes; got %d", total)
+	}
+}
+
+// TestLogDiskUsageInMemoryFileSystem verifies that the files are listed
+// on the Logger's fileSystem.
+func TestLogDiskUsageInMemoryFileSystem(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	fs := newMemFileSystem()
+	lg.fs = fs
+	name := filepath.Join(lg.logDirs()[0], "cockroach.host.user.log.ERROR.20150609-161048.1.gz")
+	if err := writeFile(fs, name, make([]byte, 42), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, total, err := lg.LogDiskUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[Level]int64{ErrorLevel: 42}; !reflect.DeepEqual(usage, exp) || total != 42 {
+		t.Errorf("expected %v and a total of 42 bytes; got %v and %d", exp, usage, total)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/util"
+)
+
+// The on-disk format of log files is versioned so that files written
+// before an upgrade stay readable after it. The versions are:
+//   - 0: unversioned files, which consist of length-prefixed entries
+//     only. They were written before versioning was introduced.
+//   - 1: files which start with a four-byte prelude carrying the version
+//     and otherwise consist of length-prefixed entries like version 0.
+//
+// The prelude takes the place of a length prefix and is told apart from
+// one by its first byte, which no length prefix of a real entry has. It
+// may be preceded by a header line (see Logger.WriteHeaderLine), which
+// doesn't change the version.
+const (
+	logFormatVersion = 1
+	preludeMagic     = 0xce
+)
+
+// filePrelude is written at the beginning of every new log file.
+var filePrelude = []byte{preludeMagic, 'L', 'G', logFormatVersion}
+
+// headerLinePrefix starts the header line which precedes the prelude of
+// files written by Loggers with WriteHeaderLine set. Like the prelude, it
+// is told apart from a length prefix by its first byte.
+const headerLinePrefix = "#cockroach-log "
+
+// maxHeaderLineLen bounds the length of a header line, so that a corrupt
+// file isn't read to its end looking for one.
+const maxHeaderLineLen = 1024
+
+// headerLine returns the header line of a file created at time t for the
+// given level name. It describes the file with the same components as
+// its name, so that the two agree.
+func headerLine(tag string, t time.Time) []byte {
+	return []byte(fmt.Sprintf("%sversion=%d program=%s host=%s user=%s level=%s start=%s pid=%d run=%s\n",
+		headerLinePrefix, logFormatVersion, program, escapePeriods(host),
+		escapePeriods(userName), tag, t.Format(time.RFC3339), pid, runID))
+}
+
+// filePreamble returns what the Logger writes at the beginning of each
+// new file created at time t for the given level name, ahead of the
+// header entries.
+func (lg *Logger) filePreamble(tag string, t time.Time) []byte {
+	if !lg.WriteHeaderLine {
+		return filePrelude
+	}
+	return append(headerLine(tag, t), filePrelude...)
+}
+
+// readPreamble checks whether the four bytes read in place of a length
+// prefix start the preamble of a file, i.e. a header line or the format
+// prelude. If so, it reads the rest of the preamble from r and returns
+// its total size, including szBuf, and the format version it names.
+// Otherwise, it returns a size of zero. Versions this binary doesn't know
+// how to read are rejected. Checksum footers, which readers skip just the
+// same, are also recognized; their version is -1.
+func readPreamble(szBuf []byte, r io.Reader) (size int64, version int, err error) {
+	if isChecksumFooter(szBuf) {
+		var sum [4]byte
+		if _, err := io.ReadFull(r, sum[:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, -1, err
+		}
+		return checksumFooterSize, -1, nil
+	}
+	if string(szBuf) == headerLinePrefix[:len(szBuf)] {
+		n, err := skipLine(r)
+		if err != nil {
+			return 0, 0, err
+		}
+		var prelude [4]byte
+		if _, err := io.ReadFull(r, prelude[:]); err != nil {
+			return 0, 0, err
+		}
+		preludeSize, version, err := readPreamble(prelude[:], r)
+		if err == nil && preludeSize != int64(len(prelude)) {
+			err = util.Errorf("log file header line is not followed by a format prelude")
+		}
+		return int64(len(szBuf)+n) + preludeSize, version, err
+	}
+	if szBuf[0] != preludeMagic || szBuf[1] != filePrelude[1] || szBuf[2] != filePrelude[2] {
+		return 0, 0, nil
+	}
+	version = int(szBuf[3])
+	if version > logFormatVersion {
+		return 0, version, util.Errorf("unsupported log format version %d; "+
+			"at most version %d is supported", version, logFormatVersion)
+	}
+	return int64(len(szBuf)), version, nil
+}
+
+// skipLine reads up to and including the next newline from r and returns
+// the number of bytes read. r is read a byte at a time so that nothing
+// past the newline is consumed.
+func skipLine(r io.Reader) (int, error) {
+	var b [1]byte
+	for n := 1; n <= maxHeaderLineLen; n++ {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return n, err
+		}
+		if b[0] == '\n' {
+			return n, nil
+		}
+	}
+	return 0, util.Errorf("log file header line longer than %d bytes", maxHeaderLineLen)
+}
+
+// A FileHeader describes a log file as its header line does.
+type FileHeader struct {
+	// Version is the format version of the file.
+	Version int
+	// FileDetails are the details also encoded in the name of the file.
+	// Seq is always zero, as it's only chosen once the file is named.
+	FileDetails
+}
+
+// parseHeaderLine parses a header line, without its trailing newline.
+func parseHeaderLine(line string) (FileHeader, error) {
+	if !strings.HasPrefix(line, headerLinePrefix) {
+		return FileHeader{}, util.Errorf("not a log file header line: %q", line)
+	}
+	fields := map[string]string{}
+	for _, field := range strings.Fields(line[len(headerLinePrefix):]) {
+		if i := strings.IndexByte(field, '='); i >= 0 {
+			fields[field[:i]] = field[i+1:]
+		}
+	}
+	version, err := strconv.Atoi(fields["version"])
+	if err != nil {
+		return FileHeader{}, util.Errorf("invalid log file header line %q: %s", line, err)
+	}
+	level, ok := LevelFromString(fields["level"])
+	if !ok {
+		return FileHeader{}, util.Errorf("invalid log file header line %q: unknown level", line)
+	}
+	start, err := time.Parse(time.RFC3339, fields["start"])
+	if err != nil {
+		return FileHeader{}, util.Errorf("invalid log file header line %q: %s", line, err)
+	}
+	pid, err := strconv.Atoi(fields["pid"])
+	if err != nil {
+		return FileHeader{}, util.Errorf("invalid log file header line %q: %s", line, err)
+	}
+	return FileHeader{
+		Version: version,
+		FileDetails: FileDetails{
+			Program:  fields["program"],
+			Host:     fields["host"],
+			UserName: fields["user"],
+			Level:    level,
+			Time:     start.UnixNano(),
+			PID:      pid,
+			RunID:    fields["run"],
+		},
+	}, nil
+}
+
+// ReadFileHeader returns the header line of the log file, which only files
+// written with Logger.WriteHeaderLine set have. The file name is
+// interpreted as by GetLogReader, with absolute paths allowed.
+func ReadFileHeader(filename string) (FileHeader, error) {
+	return defaultLogger.ReadFileHeader(filename)
+}
+
+// ReadFileHeader returns the header line of the log file, which is looked
+// up in the Logger's directories, as described by the package-level
+// ReadFileHeader.
+func (lg *Logger) ReadFileHeader(filename string) (FileHeader, error) {
+	reader, err := lg.GetLogReader(filename, true /* allowAbsolute */)
+	if err != nil {
+		return FileHeader{}, err
+	}
+	defer reader.Close()
+	buf := make([]byte, maxHeaderLineLen)
+	n, err := io.ReadFull(reader, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return FileHeader{}, err
+	}
+	line := string(buf[:n])
+	i := strings.IndexByte(line, '\n')
+	if !strings.HasPrefix(line, headerLinePrefix) || i < 0 {
+		return FileHeader{}, util.Errorf("%s: log file has no header line", filename)
+	}
+	return parseHeaderLine(line[:i])
+}
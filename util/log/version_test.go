@@ -0,0 +1,169 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package log
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// formatFixture returns the contents of a log file of the given format
+// version holding the given messages.
+func formatFixture(version int, t time.Time, msgs ...string) []byte {
+	var data []byte
+	if version > 0 {
+		data = append(data, preludeMagic, 'L', 'G', byte(version))
+	}
+	for i, msg := range msgs {
+		entry := proto.LogEntry{
+			Severity: int32(infoLog),
+			Time:     t.Add(time.Duration(i) * time.Second).UnixNano(),
+			Format:   msg,
+		}
+		data = append(data, encodeLogEntry(&entry)...)
+	}
+	return data
+}
+
+func TestDecodeFormatVersions(t *testing.T) {
+	now := time.Now()
+	for version := 0; version <= logFormatVersion; version++ {
+		decoder := NewEntryDecoder(bytes.NewReader(formatFixture(version, now, "a", "b")))
+		var msgs []string
+		for {
+			var entry proto.LogEntry
+			if err := decoder.Decode(&entry); err != nil {
+				break
+			}
+			msgs = append(msgs, entry.Format)
+		}
+		if strings.Join(msgs, ",") != "a,b" {
+			t.Errorf("version %d: expected a,b; got %s", version, msgs)
+		}
+	}
+
+	var entry proto.LogEntry
+	err := NewEntryDecoder(bytes.NewReader(formatFixture(logFormatVersion+1, now, "a"))).Decode(&entry)
+	if err == nil || !strings.Contains(err.Error(), "unsupported log format version") {
+		t.Errorf("expected an unsupported version error; got %v", err)
+	}
+}
+
+func TestMixedFormatVersions(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	dir := lg.logDirs()[0]
+	start := time.Date(2015, 6, 9, 16, 10, 0, 0, time.UTC)
+	for _, fixture := range []struct {
+		name string
+		data []byte
+	}{
+		{"cockroach.host.user.log.INFO.20150609-161000.1", formatFixture(0, start, "v0 a", "v0 b")},
+		{"cockroach.host.user.log.INFO.20150609-161010.1", formatFixture(1, start.Add(10*time.Second), "v1 a", "v1 b")},
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, fixture.name), fixture.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := lg.FetchEntriesFromFiles(InfoLevel, start.UnixNano(), start.Add(time.Minute).UnixNano())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for _, entry := range entries {
+		msgs = append(msgs, entry.Format)
+	}
+	if exp := "v1 b,v1 a,v0 b,v0 a"; strings.Join(msgs, ",") != exp {
+		t.Errorf("expected %s; got %s", exp, msgs)
+	}
+
+	tail, err := lg.TailN("cockroach.host.user.log.INFO.20150609-161010.1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tail) != 2 || tail[0].Format != "v1 a" || tail[1].Format != "v1 b" {
+		t.Errorf("unexpected tail %+v", tail)
+	}
+}
+
+func TestHeaderLineRoundTrip(t *testing.T) {
+	lg, cleanup := newTestLogger(t)
+	defer cleanup()
+	lg.WriteHeaderLine = true
+	lg.IndexCategories = true
+	lg.Infoc(nil, "first")
+	lg.Infoc(nil, "second")
+	lg.Flush()
+
+	name, err := lg.ActiveLogFile(InfoLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(headerLinePrefix)) {
+		t.Fatalf("expected file to start with a header line; got %q", data[:20])
+	}
+
+	header, err := lg.ReadFileHeader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	details, err := parseLogFilename(filepath.Base(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != logFormatVersion || header.FileDetails != details {
+		t.Errorf("header %+v does not match file name details %+v", header, details)
+	}
+
+	decoder := NewEntryDecoder(bytes.NewReader(data))
+	var msgs []string
+	var secondOffset int64
+	for {
+		offset := decoder.Offset()
+		var entry proto.LogEntry
+		if err := decoder.Decode(&entry); err != nil {
+			break
+		}
+		if entry.Format == "second" {
+			secondOffset = offset
+		}
+		msgs = append(msgs, entry.Format)
+	}
+	if len(msgs) != 4 || msgs[2] != "first" || msgs[3] != "second" {
+		t.Errorf("expected the header entries and both entries; got %q", msgs)
+	}
+	if entry, err := lg.ReadEntryAt(name, secondOffset); err != nil || entry.Format != "second" {
+		t.Errorf("expected to read the second entry at %d; got %+v, %v", secondOffset, entry, err)
+	}
+	if tail, err := lg.TailN(name, 1); err != nil || len(tail) != 1 || tail[0].Format != "second" {
+		t.Errorf("expected the second entry as tail; got %+v, %v", tail, err)
+	}
+	if _, err := os.Stat(name + categoryIndexSuffix); err != nil {
+		t.Errorf("expected the file to be indexed: %s", err)
+	}
+}